@@ -0,0 +1,275 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/htetmyatthar/server-manager/internal/config"
+	"github.com/htetmyatthar/server-manager/internal/repository"
+	"github.com/htetmyatthar/server-manager/internal/utils"
+)
+
+// maxAPIBodyBytes is the maximum size of the JSON request bodies.
+const maxAPIBodyBytes int64 = 1 << 20
+
+// ErrInvalidClient is the error of a client that fails the validation in the middle of a change.
+var ErrInvalidClient = errors.New("Invalid client.")
+
+// ClientRequest is the JSON request body for creating and updating the clients.
+// The status of the client is derived from its dates, so it can't be set directly.
+type ClientRequest struct {
+	Id         string `json:"id"`
+	Username   string `json:"username"`
+	DeviceId   string `json:"deviceId"`
+	StartDate  string `json:"startDate"`
+	ExpireDate string `json:"expireDate"`
+}
+
+// RenewRequest is the JSON request body for renewing the clients. Either the new expire date
+// or the number of days to extend should be given. The days are added to the current expire date,
+// or to today if the client has already expired.
+type RenewRequest struct {
+	ExpireDate string `json:"expireDate"`
+	Days       int    `json:"days"`
+}
+
+// APIClientsGET responds all the clients in JSON format.
+func APIClientsGET(clients repository.ClientRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		users, err := clients.List()
+		if err != nil {
+			log.Println("Error listing the clients:", err)
+			respondRepositoryError(w, err)
+			return
+		}
+		if users == nil {
+			users = []utils.Client{}
+		}
+		utils.JSONRespond(w, http.StatusOK, users)
+	}
+}
+
+// APIClientGET responds the client with the {id} path value in JSON format.
+func APIClientGET(clients repository.ClientRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		client, err := clients.Get(r.PathValue("id"))
+		if err != nil {
+			log.Println("Error getting the client:", err)
+			respondRepositoryError(w, err)
+			return
+		}
+		utils.JSONRespond(w, http.StatusOK, client)
+	}
+}
+
+// APIClientsPOST creates a new client from the JSON request body, responding the created client.
+// A random server UUID is generated if the id is not given.
+func APIClientsPOST(clients repository.ClientRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request ClientRequest
+		if !decodeJSON(w, r, &request) {
+			return
+		}
+
+		if request.Id == "" {
+			id, err := utils.NewUUID()
+			if err != nil {
+				log.Println("uuid generation gone wrong.", err)
+				utils.JSONRespondError(w, http.StatusInternalServerError, "Internal Server Error")
+				return
+			}
+			request.Id = id
+		}
+
+		newClient := request.client()
+		if !validateClient(w, newClient) {
+			return
+		}
+
+		err := clients.Create(newClient)
+		if err != nil {
+			log.Println("Error creating a new client:", err)
+			respondRepositoryError(w, err)
+			return
+		}
+
+		notifyClient(r, " - New user is created", newClient, " is created by ")
+		utils.JSONRespond(w, http.StatusCreated, newClient)
+	}
+}
+
+// APIClientPUT replaces the client with the {id} path value by the JSON request body, responding
+// the updated client. The id of the client is kept if it is not given.
+func APIClientPUT(clients repository.ClientRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		var request ClientRequest
+		if !decodeJSON(w, r, &request) {
+			return
+		}
+		if request.Id == "" {
+			request.Id = id
+		}
+
+		modifiedClient := request.client()
+		if !validateClient(w, modifiedClient) {
+			return
+		}
+
+		err := clients.Update(id, modifiedClient)
+		if err != nil {
+			log.Println("Error updating the client:", err)
+			respondRepositoryError(w, err)
+			return
+		}
+
+		notifyClient(r, " - User is updated", modifiedClient, " is updated by ")
+		utils.JSONRespond(w, http.StatusOK, modifiedClient)
+	}
+}
+
+// APIClientDELETE deletes the client with the {id} path value, responding the deleted client.
+func APIClientDELETE(clients repository.ClientRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		deletedClient, err := clients.Delete(r.PathValue("id"), nil)
+		if err != nil {
+			log.Println("Error deleting the client:", err)
+			respondRepositoryError(w, err)
+			return
+		}
+
+		notifyClient(r, " - Existing user is deleted.", deletedClient, " is deleted by ")
+		utils.JSONRespond(w, http.StatusOK, deletedClient)
+	}
+}
+
+// APIClientRenewPOST extends the expire date of the client with the {id} path value by the JSON
+// request body, responding the renewed client. Expired clients are brought back to the v2ray inbound.
+func APIClientRenewPOST(clients repository.ClientRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		var request RenewRequest
+		if !decodeJSON(w, r, &request) {
+			return
+		}
+
+		switch {
+		case request.ExpireDate != "" && request.Days != 0:
+			utils.JSONRespondFieldErrors(w, http.StatusBadRequest, "Validation failed.", map[string]string{
+				"days": "can't be given together with the expire date",
+			})
+			return
+		case request.ExpireDate == "" && request.Days <= 0:
+			utils.JSONRespondFieldErrors(w, http.StatusBadRequest, "Validation failed.", map[string]string{
+				"expireDate": "either the expire date or the positive number of days is required",
+			})
+			return
+		}
+
+		// the days are added to the expire date in the same transaction, so that the concurrent renewals
+		// and edits of the client can't be lost.
+		var problems map[string]string
+		client, err := clients.Modify(id, func(client *utils.Client) error {
+			now := time.Now()
+			if request.ExpireDate != "" {
+				client.ExpireDate = request.ExpireDate
+			} else {
+				from, err := time.ParseInLocation(utils.DateLayout, client.ExpireDate, time.Local)
+				if err != nil || from.Before(now) {
+					from = now
+				}
+				client.ExpireDate = from.AddDate(0, 0, request.Days).Format(utils.DateLayout)
+			}
+			client.Status = client.StatusAt(now)
+
+			problems = client.Validate()
+			if len(problems) > 0 {
+				return ErrInvalidClient
+			}
+			return nil
+		})
+		if errors.Is(err, ErrInvalidClient) {
+			utils.JSONRespondFieldErrors(w, http.StatusBadRequest, "Validation failed.", problems)
+			return
+		}
+		if err != nil {
+			log.Println("Error renewing the client:", err)
+			respondRepositoryError(w, err)
+			return
+		}
+
+		notifyClient(r, " - User is renewed", client, " is renewed until "+client.ExpireDate+" by ")
+		utils.JSONRespond(w, http.StatusOK, client)
+	}
+}
+
+// client returns the client of the request with the default AlterId of value 1,
+// and the status derived from its dates.
+func (request ClientRequest) client() utils.Client {
+	client := utils.Client{
+		Id:         request.Id,
+		AlterId:    1,
+		Username:   request.Username,
+		DeviceId:   request.DeviceId,
+		StartDate:  request.StartDate,
+		ExpireDate: request.ExpireDate,
+	}
+	client.Status = client.StatusAt(time.Now())
+	return client
+}
+
+// decodeJSON decodes the JSON request body into v, rejecting the unknown fields.
+// Responds the error and returns false if the body is invalid.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		log.Println("Error decoding the request body:", err)
+		utils.JSONRespondError(w, http.StatusBadRequest, "Invalid request body")
+		return false
+	}
+	return true
+}
+
+// validateClient responds the validation errors and returns false if the client is invalid.
+func validateClient(w http.ResponseWriter, client utils.Client) bool {
+	problems := client.Validate()
+	if len(problems) == 0 {
+		return true
+	}
+	utils.JSONRespondFieldErrors(w, http.StatusBadRequest, "Validation failed.", problems)
+	return false
+}
+
+// respondRepositoryError responds the JSON error that matches the error returned from the client repository.
+func respondRepositoryError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repository.ErrClientNotFound):
+		utils.JSONRespondError(w, http.StatusNotFound, "User not found.")
+	case errors.Is(err, repository.ErrClientExists):
+		utils.JSONRespondFieldErrors(w, http.StatusConflict, "User with the same server UUID already exists.", map[string]string{
+			"id": "already exists",
+		})
+	case errors.Is(err, utils.ErrConfigRejected):
+		utils.JSONRespondError(w, http.StatusUnprocessableEntity, "V2ray rejected the new configuration. Nothing is changed.")
+	default:
+		utils.JSONRespondError(w, http.StatusInternalServerError, "Error saving the configuration. Nothing is changed.")
+	}
+}
+
+// notifyClient sends a push notification about the client change made by the requester.
+func notifyClient(r *http.Request, titleSuffix string, client utils.Client, verb string) {
+	ip, err := utils.RemoteIP(r)
+	if err != nil {
+		log.Println("Error getting the ip address of the requester.")
+		return
+	}
+	title := *config.WebHost + titleSuffix
+	message := client.Username + "@" + *config.WebHostIP + " with [[" + client.Id + "]]" + verb + ip
+	for _, key := range config.GotifyAPIKeys {
+		utils.SendNoti(*config.GotifyServer, key, title, message, 5)
+	}
+}
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/htetmyatthar/server-manager/internal/config"
+	"github.com/htetmyatthar/server-manager/internal/database"
+	"github.com/htetmyatthar/server-manager/internal/utils"
+)
+
+// bansPage is the data of the bans page.
+type bansPage struct {
+	Username      string
+	Role          data.Role
+	Bans          []data.Ban
+	Allowlist     []netip.Prefix
+	CSRFToken     string
+	CSRFTokenName string
+	Version       string
+}
+
+// AdminBansGET is to show the banned IP addresses and the allowlist of the admin panel.
+func AdminBansGET(banner *utils.IPBanner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, err := r.Cookie(config.SessionCookieName)
+		if err == http.ErrNoCookie { // if no cookies login again.
+			http.Redirect(w, r, "/admin/login", http.StatusFound)
+			return
+		}
+
+		token, err := utils.GenerateCSRF(session.Value)
+		if err != nil {
+			log.Println("csrf generation gone wrong.", err)
+			utils.RenderError(w, "CSRF token generation gone wrong", http.StatusInternalServerError)
+			return
+		}
+
+		bans, err := banner.Bans()
+		if err != nil {
+			log.Println("Error listing the bans:", err)
+			utils.RenderError(w, "Unable to read the bans.", http.StatusInternalServerError)
+			return
+		}
+
+		page := bansPage{
+			Username:      utils.RequestUsername(r),
+			Role:          utils.RequestRole(r),
+			Bans:          bans,
+			Allowlist:     banner.Allowlist(),
+			CSRFToken:     token,
+			CSRFTokenName: config.CSRFFormFieldName,
+			Version:       config.Version,
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		utils.RenderTemplate(w, "bans", page)
+	}
+}
+
+// AdminBansPOST is to ban the IP address or the CIDR range with the prefix form value for the duration form
+// value in minutes, empty to ban it until it's unbanned. The own IP address of the panel user can't be banned.
+func AdminBansPOST(banner *utils.IPBanner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		prefix, err := data.ParsePrefix(r.FormValue("prefix"))
+		if err != nil {
+			log.Println("Error banning the IP address:", err)
+			utils.RenderError(w, "Enter a valid IP address or CIDR range, e.g. 192.0.2.1 or 192.0.2.0/24!", http.StatusBadRequest)
+			return
+		}
+
+		var duration time.Duration
+		if value := strings.TrimSpace(r.FormValue("duration")); value != "" {
+			minutes, err := strconv.Atoi(value)
+			if err != nil || minutes < 0 {
+				log.Println("Error banning the IP address with invalid duration:", value)
+				utils.RenderError(w, "Duration should be the minutes, or empty to ban until it's unbanned!", http.StatusBadRequest)
+				return
+			}
+			duration = time.Duration(minutes) * time.Minute
+		}
+
+		// NOTE: banning the own IP address would lock the panel user out of the panel at once.
+		ip, _ := utils.RemoteIP(r)
+		if addr, err := netip.ParseAddr(ip); err == nil && prefix.Contains(addr.Unmap()) {
+			log.Println("Attempt to ban the own IP address:", ip)
+			utils.RenderError(w, "You can't ban your own IP address!", http.StatusBadRequest)
+			return
+		}
+
+		username := utils.RequestUsername(r)
+		ban, err := banner.Ban(prefix.String(), strings.TrimSpace(r.FormValue("reason")), username, duration)
+		if err != nil {
+			log.Println("Error banning the IP address:", err)
+			utils.RenderError(w, "Error saving the bans.", http.StatusInternalServerError)
+			return
+		}
+
+		notifySession(r, username, " banned "+ban.Prefix, ban.Prefix+" is banned by "+username+" using ")
+		http.Redirect(w, r, "/admin/bans", http.StatusFound)
+	}
+}
+
+// AdminBanDeletePOST is to unban the IP address or the CIDR range with the prefix form value.
+func AdminBanDeletePOST(banner *utils.IPBanner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		prefix := r.FormValue("prefix")
+		if err := banner.Unban(prefix); err != nil {
+			log.Println("Error unbanning the IP address:", err)
+			if errors.Is(err, data.ErrBanNotFound) {
+				utils.RenderError(w, "Ban not found, it might have expired already.", http.StatusNotFound)
+				return
+			}
+			utils.RenderError(w, "Error saving the bans.", http.StatusInternalServerError)
+			return
+		}
+
+		username := utils.RequestUsername(r)
+		notifySession(r, username, " unbanned "+prefix, prefix+" is unbanned by "+username+" using ")
+		http.Redirect(w, r, "/admin/bans", http.StatusFound)
+	}
+}
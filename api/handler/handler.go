@@ -1,19 +1,25 @@
 package handler
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"net"
+	"mime"
 	"net/http"
-	"os"
 	"strconv"
+	"time"
 
+	"github.com/htetmyatthar/server-manager/internal/captcha"
 	"github.com/htetmyatthar/server-manager/internal/config"
 	"github.com/htetmyatthar/server-manager/internal/database"
+	"github.com/htetmyatthar/server-manager/internal/repository"
 	"github.com/htetmyatthar/server-manager/internal/utils"
+	"github.com/htetmyatthar/server-manager/internal/vmess"
 )
 
+// ErrIncorrectClient is the error of a client deletion confirmed with another username.
+var ErrIncorrectClient = errors.New("Incorrect user information!")
+
 // added easter egg
 func Hello(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "Hello LoTone users.")
@@ -42,8 +48,9 @@ func ApologyHandler(w http.ResponseWriter, r *http.Request) {
 	utils.RenderError(w, "Not Found.", http.StatusNotFound)
 }
 
-// AdminLoginGET is to show the admin login page.
-func AdminLoginGET(sessionStore data.SessionStore) http.HandlerFunc {
+// AdminLoginGET is to show the admin login page, with the single sign-on button if sso is true.
+// The CAPTCHA of the captchaVerifier is shown after the -captchaafter failed attempts from the IP address.
+func AdminLoginGET(sessionStore data.SessionStore, userLocker *utils.LockedOutRateLimiter, captchaVerifier captcha.Verifier, sso bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		sessionCookie, err := r.Cookie(config.SessionCookieName)
 		var sessionId string
@@ -66,11 +73,27 @@ func AdminLoginGET(sessionStore data.SessionStore) http.HandlerFunc {
 			return
 		}
 
+		var widget *captcha.Widget
+		ip, _ := utils.RemoteIP(r)
+		if utils.CaptchaRequired(captchaVerifier, userLocker, ip) {
+			challenge, err := captchaVerifier.Widget()
+			if err != nil {
+				log.Println("Error creating the CAPTCHA:", err)
+				utils.RenderError(w, "CAPTCHA generation gone wrong", http.StatusInternalServerError)
+				return
+			}
+			widget = &challenge
+		}
+
 		data := struct {
+			SSO           bool
+			Captcha       *captcha.Widget
 			CSRFToken     string
 			CSRFTokenName string
 			Version       string
 		}{
+			SSO:           sso,
+			Captcha:       widget,
 			CSRFToken:     token,
 			CSRFTokenName: config.CSRFFormFieldName,
 			Version:       config.Version,
@@ -82,10 +105,11 @@ func AdminLoginGET(sessionStore data.SessionStore) http.HandlerFunc {
 	}
 }
 
-// AdminLoginPOST is a handler for logging into the admin dashboard.
-func AdminLoginPOST(sessionStore data.SessionStore, userLocker *utils.LockedOutRateLimiter) http.HandlerFunc {
+// AdminLoginPOST is a handler for logging into the admin dashboard. The CAPTCHA of the captchaVerifier has to be
+// solved after the -captchaafter failed attempts from the IP address.
+func AdminLoginPOST(sessionStore data.SessionStore, panelUsers data.PanelUserStore, userLocker *utils.LockedOutRateLimiter, captchaVerifier captcha.Verifier) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		_, err := r.Cookie(config.SessionCookieName)
+		publicSession, err := r.Cookie(config.SessionCookieName)
 		// if no cookies login again.
 		if err == http.ErrNoCookie {
 			log.Println("Attempt to access dashboard without the session cookie.")
@@ -96,32 +120,48 @@ func AdminLoginPOST(sessionStore data.SessionStore, userLocker *utils.LockedOutR
 		username := r.FormValue("username")
 		password := r.FormValue("password")
 
-		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		ip, err := utils.RemoteIP(r)
 		if err != nil {
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
-		if userLocker.IsLockedOut(username) {
-
+		if userLocker.IsLockedOut(username, ip) {
 			log.Println("Too many failed attempts, ", ip)
 			utils.RenderError(w, "Too many failed attempts. Try again later. Contact administrator if needed.", http.StatusTooManyRequests)
 			return
 		}
 
+		// NOTE: only the password form is guarded, the passkeys and the single sign-on can't be guessed.
+		// the CAPTCHA failures aren't counted, so that the bots can't lock the users out without solving it.
+		if utils.CaptchaRequired(captchaVerifier, userLocker, ip) {
+			if err := captchaVerifier.Verify(r.Context(), r.PostForm, ip); err != nil {
+				log.Println("Attempt without solving the CAPTCHA:", ip, err)
+				if errors.Is(err, captcha.ErrUnavailable) {
+					utils.RenderError(w, "CAPTCHA verification is unavailable. Try again later.", http.StatusServiceUnavailable)
+					return
+				}
+				utils.RenderError(w, "Please solve the CAPTCHA and try again.", http.StatusBadRequest)
+				return
+			}
+		}
+
 		if username == "" || password == "" {
 			log.Println("Attempt with empty password or username.")
 			utils.RenderError(w, "Invalid format.", http.StatusBadRequest)
 			return
 		}
 
-		if _, ok := utils.PanelUsers[username]; !ok {
+		user, err := panelUsers.GetUser(username)
+		if err != nil {
+			// only the IP address is counted, so that the store isn't filled with the made up usernames.
+			recordFailedLogin(userLocker, "", ip)
 			log.Println("Attempt with wrong username.")
 			utils.RenderError(w, "Unauthorized.", http.StatusUnauthorized)
 			return
 		}
 
-		correct, err := utils.VerifyPassword(password, utils.PanelUsers[username])
+		correct, err := utils.VerifyPassword(password, user.Hash)
 		// handle hashing errors.
 		if err != nil && err != utils.ErrWrongPassword {
 			log.Println("verifying user password gone wrong.", err)
@@ -131,422 +171,363 @@ func AdminLoginPOST(sessionStore data.SessionStore, userLocker *utils.LockedOutR
 
 		// incorrect password.
 		if correct != true {
-
-			err = userLocker.RecordFailedAttempt(username)
-			// prepare and send the noti if the user is being locked out.
-			if err != nil && err == utils.ErrUserLockedOut {
-				// prepare and send a notification
-				title := *config.WebHost + " - User locked out"
-				message := "User [[" + username + "]] is locked out for " + strconv.Itoa(*config.LockOutDuration) + " minutes"
-				for _, key := range config.GotifyAPIKeys {
-					utils.SendNoti(*config.GotifyServer, key, title, message, 9)
-				}
-			}
-
+			recordFailedLogin(userLocker, username, ip)
 			log.Println("Attempt with wrong password.")
 			http.Redirect(w, r, "/admin/login", http.StatusFound)
 			return
 		}
 
-		// reset password attempts.
-		userLocker.ResetAttempts(username)
-
-		// set the session.
-		err = utils.SessionSetPrivate(w, "/", sessionStore)
-		if err != nil {
-			log.Println("session setting gone wrong.", err)
-			utils.RenderError(w, "session setting gone wrong", http.StatusInternalServerError)
+		// NOTE: checked after the password so that the disabled users can't be found out.
+		if user.Disabled {
+			log.Println("Attempt with disabled panel user", username)
+			utils.RenderError(w, "Your account is disabled. Contact administrator if needed.", http.StatusForbidden)
 			return
 		}
 
-		// send a notification to the gotify server.
-		title := *config.WebHost + " - " + username + " logged in"
-		message := username + " logged into " + *config.WebHostIP + " using " + ip
-		for _, key := range config.GotifyAPIKeys {
-			utils.SendNoti(*config.GotifyServer, key, title, message, 9)
+		// upgrade the password hash of the older argon2id parameters now that the password is known.
+		if utils.NeedsRehash(user.Hash) {
+			newHash, err := utils.HashPassword(password)
+			if err == nil {
+				err = panelUsers.SetPassword(username, newHash)
+			}
+			if err != nil {
+				log.Println("Error upgrading the password hash:", err)
+			} else {
+				log.Println("Upgraded the password hash of the panel user", username)
+			}
 		}
 
-		http.Redirect(w, r, "/admin/dashboard", http.StatusFound)
-		return
-	}
-}
-
-// AdminDashboardGET is to show the admin dashboard.
-func AdminDashboardGET(w http.ResponseWriter, r *http.Request) {
-	session, err := r.Cookie(config.SessionCookieName)
-	if err == http.ErrNoCookie { // if no cookies login again.
-		http.Redirect(w, r, "/admin/login", http.StatusFound)
-		return
-	}
-
-	token, err := utils.GenerateCSRF(session.Value)
-	if err != nil {
-		log.Println("csrf generation gone wrong.", err)
-		utils.RenderError(w, "CSRF token generation gone wrong", http.StatusInternalServerError)
-		return
-	}
-
-	userData, err := os.ReadFile(*config.UserFile)
-	if err != nil {
-		fmt.Println("Error reading file:", err)
-		utils.RenderError(w, "Unable to read the config file.", http.StatusInternalServerError)
-		return
-	}
-
-	var userResult map[string]json.RawMessage
-	err = json.Unmarshal(userData, &userResult)
-	if err != nil {
-		log.Println(err)
-		return
-	}
-
-	var users []utils.Client
-	err = json.Unmarshal(userResult["clients"], &users)
-	if err != nil {
-		log.Println("marshalling into the utils.client gone wrong: ,", err)
-		return
-	}
+		// the TOTP code or the passkey is asked in the next step, the failed attempts are reset only after it
+		// so that the codes can't be guessed by logging in with the password again and again.
+		if user.SecondFactor() {
+			err = sessionStore.CreateSession(publicSession.Value, data.Session{TOTPPending: username})
+			if err != nil {
+				log.Println("session setting gone wrong.", err)
+				utils.RenderError(w, "session setting gone wrong", http.StatusInternalServerError)
+				return
+			}
+			http.Redirect(w, r, "/admin/login/totp", http.StatusFound)
+			return
+		}
 
-	data := struct {
-		Clients         []utils.Client
-		ServerRegion    string
-		ServerIP        string
-		V2rayServerPort string
-		CSRFToken       string
-		CSRFTokenName   string
-	}{
-		Clients:         users,
-		ServerRegion:    *config.WebHostRegion,
-		ServerIP:        *config.WebHostIP,
-		V2rayServerPort: *config.V2rayPort,
-		CSRFToken:       token,
-		CSRFTokenName:   config.CSRFFormFieldName,
+		// reset password attempts.
+		userLocker.ResetAttempts(username)
+		completeLogin(w, r, username, publicSession.Value, sessionStore, ip)
 	}
-
-	w.WriteHeader(http.StatusOK)
-	utils.RenderTemplate(w, "dashboard", data)
 }
 
-// AccountCreatePOST is to create an new user account and add it to the v2ray server configuration file.
-func AccountCreatePOST(w http.ResponseWriter, r *http.Request) {
-
-	// load the config file.
-	configData, err := os.ReadFile(*config.ConfigFile)
-	if err != nil {
-		fmt.Println("Error reading file:", err)
-		utils.RenderError(w, "Unable to read the config file.", http.StatusInternalServerError)
+// completeLogin logs the panel user in with a new private session, replacing the pre-session of the login form.
+func completeLogin(w http.ResponseWriter, r *http.Request, username, publicSessionId string, sessionStore data.SessionStore, ip string) {
+	if !startSession(w, r, username, publicSessionId, sessionStore, ip) {
 		return
 	}
+	http.Redirect(w, r, "/admin/dashboard", http.StatusFound)
+}
 
-	// load the users file.
-	userData, err := os.ReadFile(*config.UserFile)
+// startSession sets the new private session of the panel user and deletes the pre-session of the login.
+// Responds the error and returns false if the session can't be set.
+func startSession(w http.ResponseWriter, r *http.Request, username, publicSessionId string, sessionStore data.SessionStore, ip string) bool {
+	// set the session.
+	err := utils.SessionSetPrivate(w, r, username, sessionStore)
 	if err != nil {
-		fmt.Println("Error reading user data file: ", err)
-		utils.RenderError(w, "Unable to read the users file.", http.StatusInternalServerError)
-		return
+		log.Println("session setting gone wrong.", err)
+		utils.RenderError(w, "session setting gone wrong", http.StatusInternalServerError)
+		return false
 	}
 
-	// unmarshal the JSON config file into a map
-	var configResult map[string]json.RawMessage
-	err = json.Unmarshal(configData, &configResult)
-	if err != nil {
-		log.Println("Error unmarshalling JSON to map in config:", err)
-		utils.RenderError(w, "Error adding a new client to the existings configuration.", http.StatusInternalServerError)
-		return
-	}
+	// the pre-session for the login form is no longer needed.
+	sessionStore.DeleteSession(publicSessionId)
 
-	// unmarshal the JSON users file into a map
-	var userResult map[string]json.RawMessage
-	err = json.Unmarshal(userData, &userResult)
-	if err != nil {
-		log.Println("Error unmarshalling JSON to map in users:", err)
-		utils.RenderError(w, "Error adding a new client to the users file.", http.StatusInternalServerError)
-		return
-	}
-
-	// unmarshal the "inbounds" key into a slice of Inbound structs
-	var inbounds []utils.Inbound
-	err = json.Unmarshal(configResult["inbounds"], &inbounds)
-	if err != nil {
-		log.Println("Error unmarshalling 'inbounds':", err)
-		utils.RenderError(w, "Error adding a new client to the existings configuration.", http.StatusInternalServerError)
-		return
+	// send a notification to the gotify server.
+	title := *config.WebHost + " - " + username + " logged in"
+	message := username + " logged into " + *config.WebHostIP + " using " + ip
+	for _, key := range config.GotifyAPIKeys {
+		utils.SendNoti(*config.GotifyServer, key, title, message, 9)
 	}
+	return true
+}
 
-	// unmarshal the "users" key into a slice of clients.
-	var users []utils.Client
-	err = json.Unmarshal(userResult["clients"], &users)
-	if err != nil {
-		log.Println("Error unmarshalling 'users': ", err)
-		utils.RenderError(w, "Error adding a new client to the users file.", http.StatusInternalServerError)
-		return
+// recordFailedLogin counts the failed login attempt of the panel user from the IP address, sending a notification
+// if either is locked out. The username can be empty if it doesn't exist.
+func recordFailedLogin(userLocker *utils.LockedOutRateLimiter, username, ip string) {
+	for _, lockout := range userLocker.RecordFailedAttempt(username, ip) {
+		// prepare and send a notification
+		minutes := strconv.Itoa(int(time.Until(lockout.LockedUntil).Round(time.Minute).Minutes()))
+		title := *config.WebHost + " - User locked out"
+		message := "User [[" + lockout.Subject() + "]] is locked out for " + minutes + " minutes"
+		if lockout.Kind() == data.LockoutIP {
+			title = *config.WebHost + " - IP address locked out"
+			message = "IP address " + lockout.Subject() + " is locked out for " + minutes + " minutes, last tried username [[" + username + "]]"
+		}
+		for _, key := range config.GotifyAPIKeys {
+			utils.SendNoti(*config.GotifyServer, key, title, message, 9)
+		}
 	}
+}
 
-	// modify the inbounds by adding a new client with default AlterId of value 1.
-	newV2rayClient := utils.V2rayClient{
-		Id:      r.FormValue("serverUUID"),
-		AlterId: 1,
-	}
+// AdminDashboardGET is to show the admin dashboard.
+func AdminDashboardGET(clients repository.ClientRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, err := r.Cookie(config.SessionCookieName)
+		if err == http.ErrNoCookie { // if no cookies login again.
+			http.Redirect(w, r, "/admin/login", http.StatusFound)
+			return
+		}
 
-	// modify the users by adding a new user entity to the users file.
-	newClient := utils.Client{
-		Id:         r.FormValue("serverUUID"),
-		AlterId:    1,
-		Username:   r.FormValue("username"),
-		DeviceId:   r.FormValue("deviceUUID"),
-		StartDate:  r.FormValue("startDate"),
-		ExpireDate: r.FormValue("expireDate"),
-	}
+		token, err := utils.GenerateCSRF(session.Value)
+		if err != nil {
+			log.Println("csrf generation gone wrong.", err)
+			utils.RenderError(w, "CSRF token generation gone wrong", http.StatusInternalServerError)
+			return
+		}
 
-	inbounds[0].Settings.Clients = append(inbounds[0].Settings.Clients, newV2rayClient)
-	users = append(users, newClient)
+		users, err := clients.List()
+		if err != nil {
+			log.Println("Error listing the clients:", err)
+			utils.RenderError(w, "Unable to read the users file.", http.StatusInternalServerError)
+			return
+		}
 
-	// marshal the modified inbounds back to JSON
-	inboundBytes, err := json.Marshal(inbounds)
-	if err != nil {
-		log.Println("Error marshalling modified inbounds:", err)
-		utils.RenderError(w, "Error adding a new client to the existings configuration.", http.StatusInternalServerError)
-		return
-	}
-	// update the original result map with the modified inbounds
-	configResult["inbounds"] = inboundBytes
+		data := struct {
+			Username        string
+			Role            data.Role
+			Clients         []utils.Client
+			ServerRegion    string
+			ServerIP        string
+			V2rayServerPort string
+			CSRFToken       string
+			CSRFTokenName   string
+			Version         string
+		}{
+			Username:        utils.RequestUsername(r),
+			Role:            utils.RequestRole(r),
+			Clients:         users,
+			ServerRegion:    *config.WebHostRegion,
+			ServerIP:        *config.WebHostIP,
+			V2rayServerPort: *config.V2rayPort,
+			CSRFToken:       token,
+			CSRFTokenName:   config.CSRFFormFieldName,
+			Version:         config.Version,
+		}
 
-	// marshal the modified users back to JSON
-	usersBytes, err := json.Marshal(users)
-	if err != nil {
-		log.Println("Error marshalling modified users:", err)
-		utils.RenderError(w, "Error adding a new user to the users file.", http.StatusInternalServerError)
-		return
+		w.WriteHeader(http.StatusOK)
+		utils.RenderTemplate(w, "dashboard", data)
 	}
-	userResult["clients"] = usersBytes
+}
 
-	// marshal the entire result map back to JSON
-	finalConfigJSON, err := json.MarshalIndent(configResult, "", "  ")
-	if err != nil {
-		log.Println("Error marshalling final config JSON:", err)
-		utils.RenderError(w, "Error adding a new client to the existings configuration.", http.StatusInternalServerError)
-		return
-	}
+// AccountCreatePOST is to create an new user account and add it to the v2ray server configuration file.
+func AccountCreatePOST(clients repository.ClientRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// new client with default AlterId of value 1.
+		newClient := utils.Client{
+			Id:         r.FormValue("serverUUID"),
+			AlterId:    1,
+			Username:   r.FormValue("username"),
+			DeviceId:   r.FormValue("deviceUUID"),
+			StartDate:  r.FormValue("startDate"),
+			ExpireDate: r.FormValue("expireDate"),
+		}
+		newClient.Status = newClient.StatusAt(time.Now())
 
-	// marshal the entire users result map back to JSON
-	finalUserJSON, err := json.MarshalIndent(userResult, "", " ")
-	if err != nil {
-		log.Println("Error marshalling final users JSON:", err)
-		utils.RenderError(w, "Error adding a new user to the users file.", http.StatusInternalServerError)
-		return
-	}
+		if problems := newClient.Validate(); len(problems) > 0 {
+			log.Println("Error creating a new client with invalid fields:", problems)
+			utils.RenderError(w, "Invalid user information!", http.StatusBadRequest)
+			return
+		}
 
-	// Optional: Write the modified JSON back to a file
-	err = os.WriteFile(*config.ConfigFile, finalConfigJSON, 0644)
-	if err != nil {
-		log.Println("Error writing modified JSON to file:", err)
-		utils.RenderError(w, "Error adding a new client to the existings configuration.", http.StatusInternalServerError)
-		return
-	}
+		err := clients.Create(newClient)
+		if err != nil {
+			log.Println("Error creating a new client:", err)
+			renderRepositoryError(w, err)
+			return
+		}
 
-	// Optional: Write the modified JSON back to a file
-	err = os.WriteFile(*config.UserFile, finalUserJSON, 0644)
-	if err != nil {
-		log.Println("Error writing modified JSON to file:", err)
-		utils.RenderError(w, "Error adding a new user to the users file.", http.StatusInternalServerError)
-		return
-	}
+		// prepare and send a push notification
+		ip, err := utils.RemoteIP(r)
+		if err != nil {
+			log.Println("Error getting the ip address of the requester.")
+			utils.RenderError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		title := *config.WebHost + " - New user is created"
+		message := newClient.Username + "@" + *config.WebHostIP + " with [[" + newClient.Id + "]] is created by " + ip
+		for _, key := range config.GotifyAPIKeys {
+			utils.SendNoti(*config.GotifyServer, key, title, message, 5)
+		}
 
-	// prepare and send a push notification
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		log.Println("Error getting the ip address of the requester.")
-		utils.RenderError(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-	title := *config.WebHost + " - New user is created"
-	message := newClient.Username + "@" + *config.WebHostIP + " with [[" + newClient.Id + "]] is created by " + ip
-	for _, key := range config.GotifyAPIKeys {
-		utils.SendNoti(*config.GotifyServer, key, title, message, 5)
+		// since this has to be relative path there shouldn't be any "/" infront of(admin) the current path.
+		http.Redirect(w, r, "/admin/dashboard", http.StatusFound)
 	}
-
-	// since this has to be relative path there shouldn't be any "/" infront of(admin) the current path.
-	http.Redirect(w, r, "/admin/dashboard", http.StatusFound)
 }
 
-func AccountDeletePOST(w http.ResponseWriter, r *http.Request) {
-
-	// load the config file.
-	configData, err := os.ReadFile(*config.ConfigFile)
-	if err != nil {
-		fmt.Println("Error reading file:", err)
-		utils.RenderError(w, "Unable to read the config file.", http.StatusInternalServerError)
-		return
-	}
-
-	// load the users file.
-	userData, err := os.ReadFile(*config.UserFile)
-	if err != nil {
-		fmt.Println("Error reading user data file: ", err)
-		utils.RenderError(w, "Unable to read the users file.", http.StatusInternalServerError)
-		return
-	}
-
-	// unmarshal the JSON config file into a map
-	var configResult map[string]json.RawMessage
-	err = json.Unmarshal(configData, &configResult)
-	if err != nil {
-		log.Println("Error unmarshalling JSON to map in config:", err)
-		utils.RenderError(w, "Error adding a new client to the existings configuration.", http.StatusInternalServerError)
-		return
-	}
-
-	// unmarshal the JSON users file into a map
-	var userResult map[string]json.RawMessage
-	err = json.Unmarshal(userData, &userResult)
-	if err != nil {
-		log.Println("Error unmarshalling JSON to map in users:", err)
-		utils.RenderError(w, "Error adding a new client to the users file.", http.StatusInternalServerError)
-		return
-	}
+// AccountDeletePOST is to delete the user account with the {id} path value from both the v2ray
+// server configuration and the users file. The username form value should match the stored one
+// as a confirmation.
+func AccountDeletePOST(clients repository.ClientRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		username := r.FormValue("username")
 
-	// unmarshal the "inbounds" key into a slice of Inbound structs
-	var inbounds []utils.Inbound
-	err = json.Unmarshal(configResult["inbounds"], &inbounds)
-	if err != nil {
-		log.Println("Error unmarshalling 'inbounds':", err)
-		utils.RenderError(w, "Error adding a new client to the existings configuration.", http.StatusInternalServerError)
-		return
-	}
+		// the username is confirmed in the same transaction, so that the client can't change in between.
+		deletedUser, err := clients.Delete(id, func(client utils.Client) error {
+			if client.Username != username {
+				return ErrIncorrectClient
+			}
+			return nil
+		})
+		if errors.Is(err, ErrIncorrectClient) {
+			log.Println("Error invoking user deletion with incorrect information")
+			utils.RenderError(w, "Incorrect user information!", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Println("Error deleting the client:", err)
+			renderRepositoryError(w, err)
+			return
+		}
 
-	// unmarshal the "users" key into a slice of clients.
-	var users []utils.Client
-	err = json.Unmarshal(userResult["clients"], &users)
-	if err != nil {
-		log.Println("Error unmarshalling 'users': ", err)
-		utils.RenderError(w, "Error adding a new client to the users file.", http.StatusInternalServerError)
-		return
-	}
+		// prepare and send a push notification
+		ip, err := utils.RemoteIP(r)
+		if err != nil {
+			log.Println("Error getting the ip address of the requester.")
+			utils.RenderError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		title := *config.WebHost + " - Existing user is deleted."
+		message := deletedUser.Username + "@" + *config.WebHostIP + " with [[" + deletedUser.Id + "]] is deleted by " + ip
+		for _, key := range config.GotifyAPIKeys {
+			utils.SendNoti(*config.GotifyServer, key, title, message, 5)
+		}
 
-	username := r.FormValue("username")
-	serverUUID := r.FormValue("serverUUID")
-	userNumber, err := strconv.Atoi(r.FormValue("userNumber"))
-	if err != nil {
-		log.Println("Error getting the user number.")
-		utils.RenderError(w, "Error getting the user's order number in configuration.", http.StatusBadRequest)
-		return
+		http.Redirect(w, r, "/admin/dashboard", http.StatusFound)
 	}
+}
 
-	if inbounds[0].Settings.Clients[userNumber].Id != serverUUID && users[userNumber].Username != username && users[userNumber].Id != serverUUID {
-		log.Println("Error invoking user deletion with incorrect information")
-		utils.RenderError(w, "Incorrect user information!", http.StatusBadRequest)
-		return
+// AccountLinkGET responds the vmess link of the client with the {id} path value in JSON format.
+// The device-locked link is responded instead if the "locked" query value is "true".
+func AccountLinkGET(clients repository.ClientRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		locked := r.URL.Query().Get("locked") == "true"
+		_, uri, err := clientLink(clients, r.PathValue("id"), locked)
+		if err != nil {
+			log.Println("Error generating the client link:", err)
+			respondLinkError(w, err)
+			return
+		}
+		utils.JSONRespond(w, http.StatusOK, map[string]string{"uri": uri})
 	}
+}
 
-	// store for future references.
-	deletedUser := users[userNumber]
-
-	inbounds[0].Settings.Clients = append(inbounds[0].Settings.Clients[:userNumber], inbounds[0].Settings.Clients[userNumber+1:]...)
-	users = append(users[:userNumber], users[userNumber+1:]...)
+// AccountQRGET responds the QR code image of the client with the {id} path value, labelled with
+// the username and the remark. The "format" query value chooses between "png"(default) and "svg".
+// The device-locked QR code is responded instead if the "locked" query value is "true", and
+// the image is sent as an attachment if the "download" query value is "true".
+func AccountQRGET(clients repository.ClientRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		locked := query.Get("locked") == "true"
+		client, uri, err := clientLink(clients, r.PathValue("id"), locked)
+		if err != nil {
+			log.Println("Error generating the client link:", err)
+			respondLinkError(w, err)
+			return
+		}
 
-	// marshal the modified inbounds back to JSON
-	inboundBytes, err := json.Marshal(inbounds)
-	if err != nil {
-		log.Println("Error marshalling modified inbounds:", err)
-		utils.RenderError(w, "Error adding a new client to the existings configuration.", http.StatusInternalServerError)
-		return
-	}
-	// update the original result map with the modified inbounds
-	configResult["inbounds"] = inboundBytes
+		var image []byte
+		var contentType, ext string
+		switch query.Get("format") {
+		case "", "png":
+			image, err = vmess.PNG(uri, vmess.Label(client, locked), vmess.Remark(client))
+			contentType, ext = "image/png", ".png"
+		case "svg":
+			image, err = vmess.SVG(uri, vmess.Label(client, locked), vmess.Remark(client))
+			contentType, ext = "image/svg+xml", ".svg"
+		default:
+			utils.JSONRespondError(w, http.StatusBadRequest, "Unsupported QR code format.")
+			return
+		}
+		if err != nil {
+			log.Println("Error generating the QR code:", err)
+			utils.JSONRespondError(w, http.StatusInternalServerError, "Failed to generate QR code.")
+			return
+		}
 
-	// marshal the modified users back to JSON
-	usersBytes, err := json.Marshal(users)
-	if err != nil {
-		log.Println("Error marshalling modified users:", err)
-		utils.RenderError(w, "Error adding a new user to the users file.", http.StatusInternalServerError)
-		return
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Cache-Control", "no-store")
+		if query.Get("download") == "true" {
+			w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+				"filename": "qr-code-" + client.Username + ext,
+			}))
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write(image)
 	}
-	userResult["clients"] = usersBytes
+}
 
-	// marshal the entire result map back to JSON
-	finalConfigJSON, err := json.MarshalIndent(configResult, "", "  ")
+// clientLink returns the client with the given id and its vmess link.
+func clientLink(clients repository.ClientRepository, id string, locked bool) (utils.Client, string, error) {
+	client, err := clients.Get(id)
 	if err != nil {
-		log.Println("Error marshalling final config JSON:", err)
-		utils.RenderError(w, "Error adding a new client to the existings configuration.", http.StatusInternalServerError)
-		return
+		return utils.Client{}, "", err
 	}
-
-	// marshal the entire users result map back to JSON
-	finalUserJSON, err := json.MarshalIndent(userResult, "", " ")
+	inbound, err := clients.Inbound()
 	if err != nil {
-		log.Println("Error marshalling final users JSON:", err)
-		utils.RenderError(w, "Error adding a new user to the users file.", http.StatusInternalServerError)
-		return
+		return utils.Client{}, "", err
 	}
 
-	// Optional: Write the modified JSON back to a file
-	err = os.WriteFile(*config.ConfigFile, finalConfigJSON, 0644)
-	if err != nil {
-		log.Println("Error writing modified JSON to file:", err)
-		utils.RenderError(w, "Error adding a new client to the existings configuration.", http.StatusInternalServerError)
-		return
+	var uri string
+	if locked {
+		uri, err = vmess.LockedURI(client, inbound)
+	} else {
+		uri, err = vmess.URI(client, inbound)
 	}
+	return client, uri, err
+}
 
-	// Optional: Write the modified JSON back to a file
-	err = os.WriteFile(*config.UserFile, finalUserJSON, 0644)
-	if err != nil {
-		log.Println("Error writing modified JSON to file:", err)
-		utils.RenderError(w, "Error adding a new user to the users file.", http.StatusInternalServerError)
-		return
+// respondLinkError responds the JSON error that matches the error returned from clientLink.
+func respondLinkError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repository.ErrClientNotFound):
+		utils.JSONRespondError(w, http.StatusNotFound, "User not found.")
+	case errors.Is(err, vmess.ErrNoDeviceId):
+		utils.JSONRespondError(w, http.StatusBadRequest, err.Error())
+	default:
+		utils.JSONRespondError(w, http.StatusInternalServerError, "Failed to generate the link.")
 	}
+}
 
-	// prepare and send a push notification
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		log.Println("Error getting the ip address of the requester.")
-		utils.RenderError(w, "Internal Server Error", http.StatusInternalServerError)
-		return
+// renderRepositoryError renders the apology page that matches the error returned from the client repository.
+func renderRepositoryError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repository.ErrClientNotFound):
+		utils.RenderError(w, "User not found.", http.StatusNotFound)
+	case errors.Is(err, repository.ErrClientExists):
+		utils.RenderError(w, "User with the same server UUID already exists.", http.StatusConflict)
+	case errors.Is(err, utils.ErrConfigRejected):
+		utils.RenderError(w, "V2ray rejected the new configuration. Nothing is changed.", http.StatusUnprocessableEntity)
+	default:
+		utils.RenderError(w, "Error saving the configuration. Nothing is changed.", http.StatusInternalServerError)
 	}
-	title := *config.WebHost + " - Existing user is deleted."
-	message := deletedUser.Username + "@" + *config.WebHostIP + " with [[" + deletedUser.Id + "]] is deleted by " + ip
-	for _, key := range config.GotifyAPIKeys {
-		utils.SendNoti(*config.GotifyServer, key, title, message, 5)
-	}
-
-	http.Redirect(w, r, "/admin/dashboard", http.StatusFound)
 }
 
 func ServerIPHandlerGET(w http.ResponseWriter, r *http.Request) {
 	utils.JSONRespond(w, http.StatusOK, map[string]string{"ip": *config.WebHostIP})
 }
 
-// Request body structure
-type RestartRequest struct {
-	AdminUsername string `json:"adminUsername"`
-	AdminPassword string `json:"adminPassword"`
-}
-
-// ServerRestartPOST handles to restart the v2ray server when invoked with correct password.
+// ServerRestartPOST handles to restart the v2ray server for the logged in sessions.
+// CAUTION: should be wrapped by the StepUpRequired, as the v2ray server drops every connection.
 func ServerRestartPOST(w http.ResponseWriter, r *http.Request) {
-	var restartRequest RestartRequest
-
-	err := json.NewDecoder(r.Body).Decode(&restartRequest)
-	if err != nil {
-		utils.JSONRespondError(w, http.StatusBadRequest, "Invalid request body")
-		return
-	}
-
-	if _, ok := utils.PanelUsers[restartRequest.AdminUsername]; !ok {
-		log.Println("Attempt with wrong username.")
-		utils.JSONRespondError(w, http.StatusUnauthorized, "Unauthorized")
-		return
-	}
-
-	_, err = utils.VerifyPassword(restartRequest.AdminPassword, utils.PanelUsers[restartRequest.AdminUsername])
-	if err != nil {
-		utils.JSONRespondError(w, http.StatusUnauthorized, "Unauthorized")
-		log.Println("someone tries to restart the server with this password.", restartRequest.AdminPassword)
-		return
-	}
+	restartServer(w, r)
+}
 
-	// TODO: make the rate limit for each panel user and lock out the user for the wrong password.
+// APIServerRestartPOST handles to restart the v2ray server for the API tokens with the restart scope.
+func APIServerRestartPOST(w http.ResponseWriter, r *http.Request) {
+	restartServer(w, r)
+}
 
-	err = utils.ValidateConfig()
+// restartServer validates the v2ray config and restarts the v2ray server, responding the result in JSON format.
+func restartServer(w http.ResponseWriter, r *http.Request) {
+	err := utils.ValidateConfig()
 	if err != nil {
 		utils.JSONRespondError(w, http.StatusInternalServerError, "Config validation failed.")
 		log.Println("config failed.", err)
@@ -561,9 +542,9 @@ func ServerRestartPOST(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// prepare and send push notification
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	ip, err := utils.RemoteIP(r)
 	if err != nil {
-		utils.RenderError(w, "Internal Server Error", http.StatusInternalServerError)
+		utils.JSONRespondError(w, http.StatusInternalServerError, "Internal Server Error")
 		return
 	}
 	title := *config.WebHost + " - v2ray server " + *config.WebHostIP + " restarted."
@@ -575,156 +556,51 @@ func ServerRestartPOST(w http.ResponseWriter, r *http.Request) {
 	utils.JSONRespond(w, http.StatusOK, "V2ray service restarted successfully.")
 }
 
-func AccountEditPOST(w http.ResponseWriter, r *http.Request) {
-	// load the config file.
-	configData, err := os.ReadFile(*config.ConfigFile)
-	if err != nil {
-		fmt.Println("Error reading file:", err)
-		utils.RenderError(w, "Unable to read the config file.", http.StatusInternalServerError)
-		return
-	}
-
-	// load the users file.
-	userData, err := os.ReadFile(*config.UserFile)
-	if err != nil {
-		fmt.Println("Error reading user data file: ", err)
-		utils.RenderError(w, "Unable to read the users file.", http.StatusInternalServerError)
-		return
-	}
-
-	// unmarshal the JSON config file into a map
-	var configResult map[string]json.RawMessage
-	err = json.Unmarshal(configData, &configResult)
-	if err != nil {
-		log.Println("Error unmarshalling JSON to map in config:", err)
-		utils.RenderError(w, "Error adding a new client to the existings configuration.", http.StatusInternalServerError)
-		return
-	}
-
-	// unmarshal the JSON users file into a map
-	var userResult map[string]json.RawMessage
-	err = json.Unmarshal(userData, &userResult)
-	if err != nil {
-		log.Println("Error unmarshalling JSON to map in users:", err)
-		utils.RenderError(w, "Error adding a new client to the users file.", http.StatusInternalServerError)
-		return
-	}
-
-	// unmarshal the "inbounds" key into a slice of Inbound structs
-	var inbounds []utils.Inbound
-	err = json.Unmarshal(configResult["inbounds"], &inbounds)
-	if err != nil {
-		log.Println("Error unmarshalling 'inbounds':", err)
-		utils.RenderError(w, "Error adding a new client to the existings configuration.", http.StatusInternalServerError)
-		return
-	}
-
-	// unmarshal the "users" key into a slice of clients.
-	var users []utils.Client
-	err = json.Unmarshal(userResult["clients"], &users)
-	if err != nil {
-		log.Println("Error unmarshalling 'users': ", err)
-		utils.RenderError(w, "Error adding a new client to the users file.", http.StatusInternalServerError)
-		return
-	}
-
-	// modify the inbounds by adding a new client with default AlterId of value 1.
-	modifiedV2rayClient := utils.V2rayClient{
-		Id:      r.FormValue("serverUUID"),
-		AlterId: 1,
-	}
-
-	// modify the users by adding a new user entity to the users file.
-	modifiedClient := utils.Client{
-		Id:         r.FormValue("serverUUID"),
-		AlterId:    1,
-		Username:   r.FormValue("username"),
-		DeviceId:   r.FormValue("deviceUUID"),
-		StartDate:  r.FormValue("startDate"),
-		ExpireDate: r.FormValue("expireDate"),
-	}
-
-	userNumber, err := strconv.Atoi(r.FormValue("userNumber"))
-	if err != nil {
-		log.Println("Error converting usernumber into integer", err)
-		utils.RenderError(w, "Error adding a new client to the existings configuration.", http.StatusInternalServerError)
-		return
-	}
-
-	if userNumber >= len(inbounds[0].Settings.Clients) {
-		log.Println("Invalid userNumber is assessed.")
-		utils.RenderError(w, "Error adding a new client to the existings configuration.", http.StatusInternalServerError)
-		return
-	}
-
-	// change with the modified user.
-	inbounds[0].Settings.Clients[userNumber] = modifiedV2rayClient
-	users[userNumber] = modifiedClient
-
-	// marshal the modified inbounds back to JSON
-	inboundBytes, err := json.Marshal(inbounds)
-	if err != nil {
-		log.Println("Error marshalling modified inbounds:", err)
-		utils.RenderError(w, "Error adding a new client to the existings configuration.", http.StatusInternalServerError)
-		return
-	}
-	// update the original result map with the modified inbounds
-	configResult["inbounds"] = inboundBytes
-
-	// marshal the modified users back to JSON
-	usersBytes, err := json.Marshal(users)
-	if err != nil {
-		log.Println("Error marshalling modified users:", err)
-		utils.RenderError(w, "Error adding a new user to the users file.", http.StatusInternalServerError)
-		return
-	}
-	userResult["clients"] = usersBytes
-
-	// marshal the entire result map back to JSON
-	finalConfigJSON, err := json.MarshalIndent(configResult, "", "  ")
-	if err != nil {
-		log.Println("Error marshalling final config JSON:", err)
-		utils.RenderError(w, "Error adding a new client to the existings configuration.", http.StatusInternalServerError)
-		return
-	}
+// AccountEditPOST is to update the user account with the {id} path value in both the v2ray
+// server configuration and the users file. The server UUID itself can be changed with the form.
+func AccountEditPOST(clients repository.ClientRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+
+		// modified client with default AlterId of value 1.
+		modifiedClient := utils.Client{
+			Id:         r.FormValue("serverUUID"),
+			AlterId:    1,
+			Username:   r.FormValue("username"),
+			DeviceId:   r.FormValue("deviceUUID"),
+			StartDate:  r.FormValue("startDate"),
+			ExpireDate: r.FormValue("expireDate"),
+		}
+		// renewing the expire date brings the expired client back.
+		modifiedClient.Status = modifiedClient.StatusAt(time.Now())
 
-	// marshal the entire users result map back to JSON
-	finalUserJSON, err := json.MarshalIndent(userResult, "", " ")
-	if err != nil {
-		log.Println("Error marshalling final users JSON:", err)
-		utils.RenderError(w, "Error adding a new user to the users file.", http.StatusInternalServerError)
-		return
-	}
+		if problems := modifiedClient.Validate(); len(problems) > 0 {
+			log.Println("Error updating the client with invalid fields:", problems)
+			utils.RenderError(w, "Invalid user information!", http.StatusBadRequest)
+			return
+		}
 
-	// Optional: Write the modified JSON back to a file
-	err = os.WriteFile(*config.ConfigFile, finalConfigJSON, 0644)
-	if err != nil {
-		log.Println("Error writing modified JSON to file:", err)
-		utils.RenderError(w, "Error adding a new client to the existings configuration.", http.StatusInternalServerError)
-		return
-	}
+		err := clients.Update(id, modifiedClient)
+		if err != nil {
+			log.Println("Error updating the client:", err)
+			renderRepositoryError(w, err)
+			return
+		}
 
-	// Optional: Write the modified JSON back to a file
-	err = os.WriteFile(*config.UserFile, finalUserJSON, 0644)
-	if err != nil {
-		log.Println("Error writing modified JSON to file:", err)
-		utils.RenderError(w, "Error adding a new user to the users file.", http.StatusInternalServerError)
-		return
-	}
+		// prepare and send a push notification
+		ip, err := utils.RemoteIP(r)
+		if err != nil {
+			log.Println("Error getting the ip address of the requester.")
+			utils.RenderError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		title := *config.WebHost + " - User is updated"
+		message := modifiedClient.Username + "@" + *config.WebHostIP + " with [[" + modifiedClient.Id + "]] is updated by " + ip
+		for _, key := range config.GotifyAPIKeys {
+			utils.SendNoti(*config.GotifyServer, key, title, message, 5)
+		}
 
-	// prepare and send a push notification
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		log.Println("Error getting the ip address of the requester.")
-		utils.RenderError(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-	title := *config.WebHost + " - User is updated"
-	message := modifiedClient.Username + "@" + *config.WebHostIP + " with [[" + modifiedClient.Id + "]] is updated by " + ip
-	for _, key := range config.GotifyAPIKeys {
-		utils.SendNoti(*config.GotifyServer, key, title, message, 5)
+		// since this has to be relative path there shouldn't be any "/" infront of(admin) the current path.
+		http.Redirect(w, r, "/admin/dashboard", http.StatusFound)
 	}
-
-	// since this has to be relative path there shouldn't be any "/" infront of(admin) the current path.
-	http.Redirect(w, r, "/admin/dashboard", http.StatusFound)
 }
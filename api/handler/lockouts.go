@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/htetmyatthar/server-manager/internal/config"
+	"github.com/htetmyatthar/server-manager/internal/database"
+	"github.com/htetmyatthar/server-manager/internal/utils"
+)
+
+// lockoutsPage is the data of the lockouts page.
+type lockoutsPage struct {
+	Username      string
+	Role          data.Role
+	Lockouts      []data.Lockout
+	Now           time.Time
+	CSRFToken     string
+	CSRFTokenName string
+	Version       string
+}
+
+// AdminLockoutsGET is to show the usernames and the IP addresses with the failed login attempts, and
+// whether they are locked out.
+func AdminLockoutsGET(userLocker *utils.LockedOutRateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, err := r.Cookie(config.SessionCookieName)
+		if err == http.ErrNoCookie { // if no cookies login again.
+			http.Redirect(w, r, "/admin/login", http.StatusFound)
+			return
+		}
+
+		token, err := utils.GenerateCSRF(session.Value)
+		if err != nil {
+			log.Println("csrf generation gone wrong.", err)
+			utils.RenderError(w, "CSRF token generation gone wrong", http.StatusInternalServerError)
+			return
+		}
+
+		lockouts, err := userLocker.Lockouts()
+		if err != nil {
+			log.Println("Error listing the lockouts:", err)
+			utils.RenderError(w, "Unable to read the lockouts.", http.StatusInternalServerError)
+			return
+		}
+
+		page := lockoutsPage{
+			Username:      utils.RequestUsername(r),
+			Role:          utils.RequestRole(r),
+			Lockouts:      lockouts,
+			Now:           time.Now(),
+			CSRFToken:     token,
+			CSRFTokenName: config.CSRFFormFieldName,
+			Version:       config.Version,
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		utils.RenderTemplate(w, "lockouts", page)
+	}
+}
+
+// AdminLockoutUnlockPOST is to unlock the username or the IP address with the key form value, forgetting
+// its failed login attempts.
+func AdminLockoutUnlockPOST(userLocker *utils.LockedOutRateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.FormValue("key")
+		if err := userLocker.Unlock(key); err != nil {
+			log.Println("Error unlocking the lockout:", err)
+			if errors.Is(err, data.ErrLockoutNotFound) {
+				utils.RenderError(w, "Lockout not found, it might have been forgotten already.", http.StatusNotFound)
+				return
+			}
+			utils.RenderError(w, "Error saving the lockouts.", http.StatusInternalServerError)
+			return
+		}
+
+		username := utils.RequestUsername(r)
+		notifySession(r, username, " unlocked "+key, key+" is unlocked by "+username+" using ")
+		http.Redirect(w, r, "/admin/lockouts", http.StatusFound)
+	}
+}
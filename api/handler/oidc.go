@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/htetmyatthar/server-manager/internal/config"
+	"github.com/htetmyatthar/server-manager/internal/database"
+	"github.com/htetmyatthar/server-manager/internal/oidc"
+	"github.com/htetmyatthar/server-manager/internal/utils"
+)
+
+const (
+	// oidcLoginTimeout is how long the user has to log in at the identity provider.
+	oidcLoginTimeout time.Duration = 5 * time.Minute
+
+	// oidcRequestTimeout is how long the requests to the identity provider can take.
+	oidcRequestTimeout time.Duration = 10 * time.Second
+)
+
+// AdminLoginOIDCGET is to start the single sign-on, redirecting to the identity provider.
+// The state of the login is kept in a new pre-session with its own cookie, see oidcCookie.
+func AdminLoginOIDCGET(sessionStore data.SessionStore, provider *oidc.Provider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		login, err := oidc.NewLogin()
+		if err != nil {
+			log.Println("Error creating the single sign-on state:", err)
+			utils.RenderError(w, "Internal Server Error.", http.StatusInternalServerError)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), oidcRequestTimeout)
+		defer cancel()
+		authURL, err := provider.AuthURL(ctx, login)
+		if err != nil {
+			log.Println("Error discovering the identity provider:", err)
+			utils.RenderError(w, "Single sign-on is unavailable. Please log in with the password.", http.StatusBadGateway)
+			return
+		}
+
+		sessionId, err := utils.GenerateSessionId(32)
+		if err != nil {
+			log.Println("Error creating the single sign-on session:", err)
+			utils.RenderError(w, "Internal Server Error.", http.StatusInternalServerError)
+			return
+		}
+		err = sessionStore.CreateSession(sessionId, data.Session{OIDC: &data.OIDCLogin{
+			State:     login.State,
+			Nonce:     login.Nonce,
+			Verifier:  login.Verifier,
+			ExpiresAt: time.Now().Add(oidcLoginTimeout).UTC(),
+		}})
+		if err != nil {
+			log.Println("Error creating the single sign-on session:", err)
+			utils.RenderError(w, "session setting gone wrong", http.StatusInternalServerError)
+			return
+		}
+
+		http.SetCookie(w, oidcCookie(sessionId, int(oidcLoginTimeout.Seconds())))
+		http.Redirect(w, r, authURL, http.StatusFound)
+	}
+}
+
+// AdminLoginOIDCCallbackGET is to log the panel user in with the authorization code that the identity
+// provider redirects back with. The user is mapped onto a panel user by the mapping, and is created if
+// the mapping allows it.
+// NOTE: the TOTP and the passkeys of the panel user are not asked, the identity provider is trusted to
+// do its own two-factor authentication.
+func AdminLoginOIDCCallbackGET(sessionStore data.SessionStore, panelUsers data.PanelUserStore, provider *oidc.Provider, mapping utils.OIDCMapping) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie(config.OIDCCookieName)
+		if err != nil {
+			log.Println("Attempt to finish the single sign-on without its cookie.")
+			utils.RenderError(w, "Single sign-on expired. Please try again.", http.StatusBadRequest)
+			return
+		}
+
+		// the state can be used only once.
+		session, err := sessionStore.GetSession(cookie.Value)
+		sessionStore.DeleteSession(cookie.Value)
+		http.SetCookie(w, oidcCookie("", -1))
+		if err != nil || session.OIDC == nil || time.Now().After(session.OIDC.ExpiresAt) {
+			log.Println("Attempt to finish the single sign-on with a missing or expired session.", err)
+			utils.RenderError(w, "Single sign-on expired. Please try again.", http.StatusBadRequest)
+			return
+		}
+
+		query := r.URL.Query()
+		if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(session.OIDC.State)) != 1 {
+			log.Println("Attempt to finish the single sign-on with a wrong state.")
+			utils.RenderError(w, "Single sign-on expired. Please try again.", http.StatusBadRequest)
+			return
+		}
+		if query.Get("error") != "" {
+			log.Println("Single sign-on is denied by the identity provider:", query.Get("error"), query.Get("error_description"))
+			utils.RenderError(w, "Single sign-on is cancelled or denied.", http.StatusUnauthorized)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), oidcRequestTimeout)
+		defer cancel()
+		claims, err := provider.Exchange(ctx, query.Get("code"), oidc.Login{
+			State:    session.OIDC.State,
+			Nonce:    session.OIDC.Nonce,
+			Verifier: session.OIDC.Verifier,
+		})
+		if err != nil {
+			log.Println("Error finishing the single sign-on:", err)
+			utils.RenderError(w, "Single sign-on failed. Please try again.", http.StatusUnauthorized)
+			return
+		}
+
+		username, err := mapping.Username(claims)
+		if err != nil {
+			log.Println("Error mapping the single sign-on to a panel user:", err)
+			utils.RenderError(w, "Your account can't be used for the panel. Contact administrator if needed.", http.StatusForbidden)
+			return
+		}
+		role, hasRole, err := mapping.Role(claims)
+		if err != nil {
+			log.Println("Attempt of single sign-on without a panel role by", username)
+			utils.RenderError(w, "Your account has no panel role. Contact administrator if needed.", http.StatusForbidden)
+			return
+		}
+
+		user, err := panelUsers.GetUser(username)
+		if errors.Is(err, data.ErrPanelUserNotFound) && mapping.Provision {
+			if !hasRole {
+				role = mapping.DefaultRole
+			}
+			user, err = panelUsers.CreateUser(username, "", role)
+			if err == nil {
+				notifySession(r, username, " is created", "Panel user [["+username+"]] is created by the single sign-on as "+string(role)+" using ")
+			}
+		}
+		if err != nil {
+			log.Println("Error getting the panel user of the single sign-on:", username, err)
+			if errors.Is(err, data.ErrPanelUserNotFound) || errors.Is(err, data.ErrInvalidPanelUser) {
+				utils.RenderError(w, "There's no panel user for your account. Contact administrator if needed.", http.StatusForbidden)
+				return
+			}
+			utils.RenderError(w, "Internal Server Error.", http.StatusInternalServerError)
+			return
+		}
+
+		if user.Disabled {
+			log.Println("Attempt with disabled panel user", username)
+			utils.RenderError(w, "Your account is disabled. Contact administrator if needed.", http.StatusForbidden)
+			return
+		}
+
+		// the identity provider is the source of the roles if the role claim is configured.
+		if hasRole && role != user.Role {
+			if err := panelUsers.SetRole(username, role); err != nil {
+				log.Println("Error syncing the role of the panel user", username, "to", role, err)
+			} else {
+				log.Println("Synced the role of the panel user", username, "to", role)
+			}
+		}
+
+		ip, err := utils.RemoteIP(r)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !startSession(w, r, username, cookie.Value, sessionStore, ip) {
+			return
+		}
+
+		// NOTE: the session cookie is SameSite=Strict, so the browsers don't send it with the redirects
+		// that started at the identity provider. The dashboard is opened from this page instead.
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		utils.RenderTemplate(w, "login_redirect", struct{ Version string }{Version: config.Version})
+	}
+}
+
+// oidcCookie returns the cookie of the single sign-on pre-session. Unlike the session cookie it's
+// SameSite=Lax, so that it's sent with the redirect back from the identity provider. It's only sent
+// to the single sign-on paths.
+func oidcCookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     config.OIDCCookieName,
+		Value:    value,
+		Path:     "/admin/login/oidc",
+		Domain:   *config.WebHost,
+		MaxAge:   maxAge,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
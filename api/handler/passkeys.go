@@ -0,0 +1,383 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/htetmyatthar/server-manager/internal/config"
+	"github.com/htetmyatthar/server-manager/internal/database"
+	"github.com/htetmyatthar/server-manager/internal/utils"
+	"github.com/htetmyatthar/server-manager/internal/webauthn"
+)
+
+const (
+	// passkeyChallengeTimeout is how long the authenticator has to respond to a passkey challenge.
+	passkeyChallengeTimeout time.Duration = 5 * time.Minute
+
+	// maxPasskeyNameLength is the maximum length of the passkey names in characters.
+	maxPasskeyNameLength int = 64
+)
+
+// ErrPasskeyChallenge is the error of a passkey response without a valid challenge in the session.
+var ErrPasskeyChallenge = errors.New("Passkey challenge is missing or expired.")
+
+// passkeysPage is the data of the passkeys page.
+type passkeysPage struct {
+	Username      string
+	Role          data.Role
+	Passkeys      []data.Passkey
+	CSRFToken     string
+	CSRFTokenName string
+	Version       string
+}
+
+// passkeyRegistration is the request body of registering a new passkey.
+type passkeyRegistration struct {
+	Name       string                        `json:"name"`
+	Credential webauthn.RegistrationResponse `json:"credential"`
+}
+
+// AdminPasskeysGET is to show the passkeys of the current panel user.
+func AdminPasskeysGET(panelUsers data.PanelUserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, err := r.Cookie(config.SessionCookieName)
+		if err == http.ErrNoCookie { // if no cookies login again.
+			http.Redirect(w, r, "/admin/login", http.StatusFound)
+			return
+		}
+
+		user, err := panelUsers.GetUser(utils.RequestUsername(r))
+		if err != nil {
+			log.Println("Error getting the panel user:", err)
+			renderPanelUserError(w, err)
+			return
+		}
+
+		token, err := utils.GenerateCSRF(session.Value)
+		if err != nil {
+			log.Println("csrf generation gone wrong.", err)
+			utils.RenderError(w, "CSRF token generation gone wrong", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		utils.RenderTemplate(w, "passkeys", passkeysPage{
+			Username:      user.Username,
+			Role:          utils.RequestRole(r),
+			Passkeys:      user.Passkeys,
+			CSRFToken:     token,
+			CSRFTokenName: config.CSRFFormFieldName,
+			Version:       config.Version,
+		})
+	}
+}
+
+// AdminPasskeyOptionsPOST is to start registering a new passkey of the current panel user, responding
+// the options of navigator.credentials.create() in JSON.
+func AdminPasskeyOptionsPOST(sessionStore data.SessionStore, panelUsers data.PanelUserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := panelUsers.GetUser(utils.RequestUsername(r))
+		if err != nil {
+			log.Println("Error getting the panel user:", err)
+			utils.JSONRespondError(w, http.StatusNotFound, "Panel user not found.")
+			return
+		}
+
+		challenge, err := newPasskeyChallenge(r, sessionStore, "register")
+		if err != nil {
+			log.Println("Error creating the passkey challenge:", err)
+			utils.JSONRespondError(w, http.StatusInternalServerError, "Internal Server Error.")
+			return
+		}
+
+		existing := make([][]byte, 0, len(user.Passkeys))
+		for _, passkey := range user.Passkeys {
+			id, _ := base64.RawURLEncoding.DecodeString(passkey.Id)
+			existing = append(existing, id)
+		}
+		utils.JSONRespond(w, http.StatusOK, relyingParty().CreationOptions(challenge, user.Username, existing))
+	}
+}
+
+// AdminPasskeysPOST is to register a new passkey of the current panel user with the response of the
+// authenticator to the challenge of the AdminPasskeyOptionsPOST.
+func AdminPasskeysPOST(sessionStore data.SessionStore, panelUsers data.PanelUserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := utils.RequestUsername(r)
+
+		var request passkeyRegistration
+		if !decodeJSON(w, r, &request) {
+			return
+		}
+
+		challenge, err := takePasskeyChallenge(r, sessionStore, "register")
+		if err != nil {
+			log.Println("Error registering the passkey:", err)
+			utils.JSONRespondError(w, http.StatusBadRequest, "Passkey request expired. Please try again.")
+			return
+		}
+
+		name := strings.TrimSpace(request.Name)
+		if name == "" {
+			name = "Passkey"
+		}
+		if utf8.RuneCountInString(name) > maxPasskeyNameLength {
+			utils.JSONRespondFieldErrors(w, http.StatusBadRequest, "Validation failed.", map[string]string{"name": "Name is too long."})
+			return
+		}
+
+		credential, err := relyingParty().VerifyRegistration(challenge, request.Credential)
+		if err != nil {
+			log.Println("Error verifying the passkey registration:", err)
+			utils.JSONRespondError(w, http.StatusBadRequest, "Passkey can't be verified.")
+			return
+		}
+
+		passkey := data.Passkey{
+			Id:        credential.ID.String(),
+			Name:      name,
+			PublicKey: credential.PublicKey,
+			SignCount: credential.SignCount,
+		}
+		if err := panelUsers.AddPasskey(username, passkey); err != nil {
+			log.Println("Error adding the passkey:", err)
+			if errors.Is(err, data.ErrPasskeyExists) {
+				utils.JSONRespondError(w, http.StatusConflict, "Passkey is already registered.")
+				return
+			}
+			utils.JSONRespondError(w, http.StatusInternalServerError, "Error saving the passkey.")
+			return
+		}
+
+		notifySession(r, username, " added a passkey", username+" added the passkey ["+name+"] on "+*config.WebHostIP+" using ")
+		utils.JSONRespond(w, http.StatusCreated, map[string]string{"id": passkey.Id, "name": passkey.Name})
+	}
+}
+
+// AdminPasskeyDeletePOST is to delete the passkey with the {id} path value of the current panel user.
+func AdminPasskeyDeletePOST(panelUsers data.PanelUserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := utils.RequestUsername(r)
+		if err := panelUsers.DeletePasskey(username, r.PathValue("id")); err != nil {
+			log.Println("Error deleting the passkey:", err)
+			renderPanelUserError(w, err)
+			return
+		}
+
+		notifySession(r, username, " deleted a passkey", username+" deleted a passkey on "+*config.WebHostIP+" using ")
+		http.Redirect(w, r, "/admin/passkeys", http.StatusFound)
+	}
+}
+
+// AdminUserPasskeysResetPOST is to delete all the passkeys of the panel user with the {username} path value,
+// e.g. when the user lost the authenticators.
+func AdminUserPasskeysResetPOST(panelUsers data.PanelUserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := r.PathValue("username")
+		if username == utils.RequestUsername(r) {
+			log.Println("Attempt to reset the own passkeys of the panel user", username)
+			utils.RenderError(w, "Delete your own passkeys in their page.", http.StatusBadRequest)
+			return
+		}
+
+		user, err := panelUsers.GetUser(username)
+		if err != nil {
+			log.Println("Error getting the panel user:", err)
+			renderPanelUserError(w, err)
+			return
+		}
+		for _, passkey := range user.Passkeys {
+			if err := panelUsers.DeletePasskey(username, passkey.Id); err != nil && !errors.Is(err, data.ErrPasskeyNotFound) {
+				log.Println("Error resetting the passkeys of the panel user:", err)
+				renderPanelUserError(w, err)
+				return
+			}
+		}
+
+		notifyPanelUser(r, username, " has passkeys reset")
+		http.Redirect(w, r, "/admin/users", http.StatusFound)
+	}
+}
+
+// AdminLoginPasskeyOptionsPOST is to start a passkey login in the pre-session of the login form, responding
+// the options of navigator.credentials.get() in JSON.
+// If the panel user passed the password check already, the passkey is the second factor and only
+// the passkeys of that user are allowed. Otherwise it is a passwordless login with any passkey that
+// verifies the user, e.g. with the PIN or the fingerprint.
+func AdminLoginPasskeyOptionsPOST(sessionStore data.SessionStore, panelUsers data.PanelUserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		challenge, err := newPasskeyChallenge(r, sessionStore, "login")
+		if err != nil {
+			log.Println("Error creating the passkey challenge:", err)
+			utils.JSONRespondError(w, http.StatusBadRequest, "Login session expired. Please reload the page.")
+			return
+		}
+
+		allowed := [][]byte{}
+		userVerification := "required"
+		if _, username, ok := pendingTOTPLogin(r, sessionStore); ok {
+			user, err := panelUsers.GetUser(username)
+			if err != nil {
+				log.Println("Error getting the panel user:", err)
+				utils.JSONRespondError(w, http.StatusUnauthorized, "Unauthorized.")
+				return
+			}
+			for _, passkey := range user.Passkeys {
+				id, _ := base64.RawURLEncoding.DecodeString(passkey.Id)
+				allowed = append(allowed, id)
+			}
+			userVerification = "preferred"
+		}
+
+		utils.JSONRespond(w, http.StatusOK, relyingParty().RequestOptions(challenge, allowed, userVerification))
+	}
+}
+
+// AdminLoginPasskeyPOST is to log the panel user in with the response of the authenticator to the challenge
+// of the AdminLoginPasskeyOptionsPOST. Redirects to the dashboard on success like the AdminLoginPOST.
+func AdminLoginPasskeyPOST(sessionStore data.SessionStore, panelUsers data.PanelUserStore, userLocker *utils.LockedOutRateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		publicSession, err := r.Cookie(config.SessionCookieName)
+		if err != nil {
+			log.Println("Attempt to log in with a passkey without the session cookie.")
+			utils.JSONRespondError(w, http.StatusBadRequest, "Login session expired. Please reload the page.")
+			return
+		}
+
+		ip, err := utils.RemoteIP(r)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		var response webauthn.AssertionResponse
+		if !decodeJSON(w, r, &response) {
+			return
+		}
+
+		// the pending user has to be read before the challenge is taken, as it keeps the session.
+		_, pending, _ := pendingTOTPLogin(r, sessionStore)
+		challenge, err := takePasskeyChallenge(r, sessionStore, "login")
+		if err != nil {
+			log.Println("Error logging in with the passkey:", err)
+			utils.JSONRespondError(w, http.StatusBadRequest, "Passkey request expired. Please try again.")
+			return
+		}
+
+		// NOTE: the failed passkeys are counted on the username only as the second factor, where the password
+		// is known already. Otherwise anyone could lock the panel users out without knowing their passwords.
+		fail := func(message string, err error) {
+			recordFailedLogin(userLocker, pending, ip)
+			log.Println("Attempt with wrong passkey:", message, err)
+			utils.JSONRespondError(w, http.StatusUnauthorized, "Unauthorized.")
+		}
+
+		if userLocker.IsLockedOut(pending, ip) {
+			log.Println("Too many failed attempts, ", ip)
+			utils.JSONRespondError(w, http.StatusTooManyRequests, "Too many failed attempts. Try again later. Contact administrator if needed.")
+			return
+		}
+
+		user, passkey, err := panelUsers.FindPasskey(response.RawID.String())
+		if err != nil {
+			fail("unknown passkey", err)
+			return
+		}
+		if pending != "" && user.Username != pending {
+			fail("passkey of another panel user", nil)
+			return
+		}
+		if len(response.Response.UserHandle) > 0 && response.Response.UserHandle.String() != webauthn.UserID(user.Username).String() {
+			fail("user handle doesn't match", nil)
+			return
+		}
+
+		signCount, err := relyingParty().VerifyAssertion(challenge, response, passkey.PublicKey, passkey.SignCount, pending == "")
+		if err != nil {
+			fail("verification failed", err)
+			return
+		}
+
+		// NOTE: checked after the passkey so that the disabled users can't be found out.
+		if user.Disabled {
+			log.Println("Attempt with disabled panel user", user.Username)
+			utils.JSONRespondError(w, http.StatusForbidden, "Your account is disabled. Contact administrator if needed.")
+			return
+		}
+
+		if err := panelUsers.UsePasskey(user.Username, passkey.Id, signCount); err != nil {
+			log.Println("Error recording the passkey use:", err)
+			utils.JSONRespondError(w, http.StatusInternalServerError, "Internal Server Error.")
+			return
+		}
+
+		// reset password attempts.
+		userLocker.ResetAttempts(user.Username)
+		completeLogin(w, r, user.Username, publicSession.Value, sessionStore, ip)
+	}
+}
+
+// relyingParty returns the WebAuthn relying party of the panel, which is the configured host name.
+// CAUTION: the passkeys are bound to the host name, so they stop working if the -hostname is changed.
+func relyingParty() webauthn.RelyingParty {
+	return webauthn.RelyingParty{ID: *config.WebHost, Name: *config.WebHost, Origin: utils.PanelOrigin()}
+}
+
+// newPasskeyChallenge creates a new challenge for the given purpose in the session of the request,
+// replacing the previous one.
+func newPasskeyChallenge(r *http.Request, sessionStore data.SessionStore, purpose string) (string, error) {
+	cookie, err := r.Cookie(config.SessionCookieName)
+	if err != nil {
+		return "", err
+	}
+	session, err := sessionStore.GetSession(cookie.Value)
+	if err != nil {
+		return "", err
+	}
+
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return "", err
+	}
+	session.Challenge = &data.WebAuthnChallenge{
+		Value:     challenge,
+		Purpose:   purpose,
+		ExpiresAt: time.Now().Add(passkeyChallengeTimeout).UTC(),
+	}
+	if err := sessionStore.CreateSession(cookie.Value, session); err != nil {
+		return "", err
+	}
+	return challenge, nil
+}
+
+// takePasskeyChallenge returns the challenge for the given purpose from the session of the request, removing
+// it from the session so that the same response can't be used again.
+func takePasskeyChallenge(r *http.Request, sessionStore data.SessionStore, purpose string) (string, error) {
+	cookie, err := r.Cookie(config.SessionCookieName)
+	if err != nil {
+		return "", err
+	}
+	session, err := sessionStore.GetSession(cookie.Value)
+	if err != nil {
+		return "", err
+	}
+
+	challenge := session.Challenge
+	if challenge == nil {
+		return "", ErrPasskeyChallenge
+	}
+	session.Challenge = nil
+	if err := sessionStore.CreateSession(cookie.Value, session); err != nil {
+		return "", err
+	}
+
+	if challenge.Purpose != purpose || time.Now().After(challenge.ExpiresAt) {
+		return "", ErrPasskeyChallenge
+	}
+	return challenge.Value, nil
+}
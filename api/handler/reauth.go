@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"encoding/base64"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/htetmyatthar/server-manager/internal/config"
+	"github.com/htetmyatthar/server-manager/internal/database"
+	"github.com/htetmyatthar/server-manager/internal/utils"
+	"github.com/htetmyatthar/server-manager/internal/webauthn"
+)
+
+// reauthPage is the data of the step-up re-authentication page.
+type reauthPage struct {
+	Username       string
+	Role           data.Role
+	Next           string
+	ReauthDuration int
+	Password       bool // whether the panel user has a password, the single sign-on users don't.
+	Passkey        bool
+	SSO            bool
+	CSRFToken      string
+	CSRFTokenName  string
+	Version        string
+}
+
+// AdminReauthGET is to show the step-up re-authentication page, which the StepUpRequired middleware
+// redirects to before the sensitive actions. The next query value is the page to return to.
+func AdminReauthGET(panelUsers data.PanelUserStore, sso bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, err := r.Cookie(config.SessionCookieName)
+		if err == http.ErrNoCookie { // if no cookies login again.
+			http.Redirect(w, r, "/admin/login", http.StatusFound)
+			return
+		}
+
+		user, err := panelUsers.GetUser(utils.RequestUsername(r))
+		if err != nil {
+			log.Println("Error getting the panel user:", err)
+			renderPanelUserError(w, err)
+			return
+		}
+
+		token, err := utils.GenerateCSRF(session.Value)
+		if err != nil {
+			log.Println("csrf generation gone wrong.", err)
+			utils.RenderError(w, "CSRF token generation gone wrong", http.StatusInternalServerError)
+			return
+		}
+
+		page := reauthPage{
+			Username:       user.Username,
+			Role:           utils.RequestRole(r),
+			Next:           reauthNext(r.URL.Query().Get("next")),
+			ReauthDuration: *config.ReauthDuration,
+			Password:       user.Hash != "",
+			Passkey:        len(user.Passkeys) > 0,
+			SSO:            sso,
+			CSRFToken:      token,
+			CSRFTokenName:  config.CSRFFormFieldName,
+			Version:        config.Version,
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		utils.RenderTemplate(w, "reauth", page)
+	}
+}
+
+// AdminReauthPOST is to re-authenticate the current panel user with the currentPassword form value, unlocking
+// the sensitive actions for the -reauthduration. The wrong passwords are counted by the userLocker as the login does.
+// Redirects to the next form value.
+func AdminReauthPOST(sessionStore data.SessionStore, panelUsers data.PanelUserStore, userLocker *utils.LockedOutRateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := verifyCurrentPassword(w, r, panelUsers, userLocker)
+		if !ok {
+			return
+		}
+
+		if err := utils.SessionReauth(r, sessionStore); err != nil {
+			log.Println("Error recording the re-authentication:", err)
+			utils.RenderError(w, "session setting gone wrong", http.StatusInternalServerError)
+			return
+		}
+
+		log.Println("Panel user re-authenticated with the password:", user.Username)
+		http.Redirect(w, r, reauthNext(r.FormValue("next")), http.StatusSeeOther)
+	}
+}
+
+// AdminReauthPasskeyOptionsPOST is to start re-authenticating the current panel user with a passkey, responding
+// the options of navigator.credentials.get() in JSON. Only the passkeys of the user are allowed.
+func AdminReauthPasskeyOptionsPOST(sessionStore data.SessionStore, panelUsers data.PanelUserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := panelUsers.GetUser(utils.RequestUsername(r))
+		if err != nil {
+			log.Println("Error getting the panel user:", err)
+			utils.JSONRespondError(w, http.StatusNotFound, "Panel user not found.")
+			return
+		}
+		if len(user.Passkeys) == 0 {
+			utils.JSONRespondError(w, http.StatusBadRequest, "You have no passkeys.")
+			return
+		}
+
+		challenge, err := newPasskeyChallenge(r, sessionStore, "reauth")
+		if err != nil {
+			log.Println("Error creating the passkey challenge:", err)
+			utils.JSONRespondError(w, http.StatusInternalServerError, "Internal Server Error.")
+			return
+		}
+
+		allowed := make([][]byte, 0, len(user.Passkeys))
+		for _, passkey := range user.Passkeys {
+			id, _ := base64.RawURLEncoding.DecodeString(passkey.Id)
+			allowed = append(allowed, id)
+		}
+		utils.JSONRespond(w, http.StatusOK, relyingParty().RequestOptions(challenge, allowed, "required"))
+	}
+}
+
+// AdminReauthPasskeyPOST is to re-authenticate the current panel user with the response of the authenticator
+// to the challenge of the AdminReauthPasskeyOptionsPOST. The passkey has to verify the user, e.g. with the
+// PIN or the fingerprint, as it stands in for the password. The failures are counted by the userLocker.
+func AdminReauthPasskeyPOST(sessionStore data.SessionStore, panelUsers data.PanelUserStore, userLocker *utils.LockedOutRateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := utils.RequestUsername(r)
+		ip, _ := utils.RemoteIP(r)
+
+		var response webauthn.AssertionResponse
+		if !decodeJSON(w, r, &response) {
+			return
+		}
+
+		challenge, err := takePasskeyChallenge(r, sessionStore, "reauth")
+		if err != nil {
+			log.Println("Error re-authenticating with the passkey:", err)
+			utils.JSONRespondError(w, http.StatusBadRequest, "Passkey request expired. Please try again.")
+			return
+		}
+
+		if userLocker.IsLockedOut(username, ip) {
+			log.Println("Too many failed attempts, ", username)
+			utils.JSONRespondError(w, http.StatusTooManyRequests, "Too many failed attempts. Try again later. Contact administrator if needed.")
+			return
+		}
+
+		fail := func(message string, err error) {
+			recordFailedLogin(userLocker, username, ip)
+			log.Println("Attempt to re-authenticate with wrong passkey:", username, message, err)
+			utils.JSONRespondError(w, http.StatusUnauthorized, "Passkey can't be verified.")
+		}
+
+		user, passkey, err := panelUsers.FindPasskey(response.RawID.String())
+		if err != nil {
+			fail("unknown passkey", err)
+			return
+		}
+		if user.Username != username {
+			fail("passkey of another panel user", nil)
+			return
+		}
+
+		signCount, err := relyingParty().VerifyAssertion(challenge, response, passkey.PublicKey, passkey.SignCount, true)
+		if err != nil {
+			fail("verification failed", err)
+			return
+		}
+
+		if err := panelUsers.UsePasskey(username, passkey.Id, signCount); err != nil {
+			log.Println("Error recording the passkey use:", err)
+			utils.JSONRespondError(w, http.StatusInternalServerError, "Internal Server Error.")
+			return
+		}
+		if err := utils.SessionReauth(r, sessionStore); err != nil {
+			log.Println("Error recording the re-authentication:", err)
+			utils.JSONRespondError(w, http.StatusInternalServerError, "Internal Server Error.")
+			return
+		}
+
+		log.Println("Panel user re-authenticated with a passkey:", username)
+		utils.JSONRespond(w, http.StatusOK, "Re-authenticated.")
+	}
+}
+
+// reauthNext returns the panel page to return to after the re-authentication, the dashboard if the given
+// one is not a panel page, so that it can't redirect to the other sites.
+func reauthNext(next string) string {
+	if !strings.HasPrefix(next, "/admin/") || strings.ContainsAny(next, "\\\r\n") || strings.HasPrefix(next, "/admin/reauth") {
+		return "/admin/dashboard"
+	}
+	return next
+}
@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/htetmyatthar/server-manager/internal/config"
+	"github.com/htetmyatthar/server-manager/internal/database"
+	"github.com/htetmyatthar/server-manager/internal/utils"
+)
+
+// sessionsPage is the data of the active sessions page.
+type sessionsPage struct {
+	Username      string
+	Role          data.Role
+	Sessions      []data.Session
+	Current       string // handle of the session that is viewing the page.
+	Now           time.Time
+	CSRFToken     string
+	CSRFTokenName string
+	Version       string
+}
+
+// AdminLogoutPOST is to log out the current session and delete its cookies.
+func AdminLogoutPOST(sessionStore data.SessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, err := r.Cookie(config.SessionCookieName)
+		if err == nil {
+			if err := sessionStore.DeleteSession(session.Value); err != nil && !errors.Is(err, data.ErrSessionNotFound) {
+				log.Println("Error deleting the session:", err)
+				utils.RenderError(w, "Error logging out. Please try again.", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		log.Println(utils.RequestUsername(r), "logged out.")
+		utils.DeleteAllCookies(w, r)
+		http.Redirect(w, r, "/admin/login", http.StatusFound)
+	}
+}
+
+// AdminLogoutEverywherePOST is to log out every session of the current panel user including the current one.
+func AdminLogoutEverywherePOST(sessionStore data.SessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := utils.RequestUsername(r)
+		if err := sessionStore.DeleteUserSessions(username); err != nil {
+			log.Println("Error deleting the sessions of the user:", err)
+			utils.RenderError(w, "Error logging out. Please try again.", http.StatusInternalServerError)
+			return
+		}
+
+		notifySession(r, username, " logged out everywhere", username+" logged out of every session on "+*config.WebHostIP+" using ")
+		utils.DeleteAllCookies(w, r)
+		http.Redirect(w, r, "/admin/login", http.StatusFound)
+	}
+}
+
+// AdminSessionsGET is to show the active sessions of the current panel user.
+func AdminSessionsGET(sessionStore data.SessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, err := r.Cookie(config.SessionCookieName)
+		if err == http.ErrNoCookie { // if no cookies login again.
+			http.Redirect(w, r, "/admin/login", http.StatusFound)
+			return
+		}
+
+		token, err := utils.GenerateCSRF(session.Value)
+		if err != nil {
+			log.Println("csrf generation gone wrong.", err)
+			utils.RenderError(w, "CSRF token generation gone wrong", http.StatusInternalServerError)
+			return
+		}
+
+		username := utils.RequestUsername(r)
+		sessions, err := sessionStore.ListSessions(username)
+		if err != nil {
+			log.Println("Error listing the sessions:", err)
+			utils.RenderError(w, "Unable to read the sessions.", http.StatusInternalServerError)
+			return
+		}
+
+		page := sessionsPage{
+			Username:      username,
+			Role:          utils.RequestRole(r),
+			Sessions:      sessions,
+			Current:       data.SessionHandle(session.Value),
+			Now:           time.Now(),
+			CSRFToken:     token,
+			CSRFTokenName: config.CSRFFormFieldName,
+			Version:       config.Version,
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		utils.RenderTemplate(w, "sessions", page)
+	}
+}
+
+// AdminSessionDeletePOST is to revoke the session with the {handle} path value, which should be
+// one of the sessions of the current panel user. Revoking the current session logs out.
+func AdminSessionDeletePOST(sessionStore data.SessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		handle := r.PathValue("handle")
+		username := utils.RequestUsername(r)
+
+		// only the own sessions can be revoked.
+		sessions, err := sessionStore.ListSessions(username)
+		if err != nil {
+			log.Println("Error listing the sessions:", err)
+			utils.RenderError(w, "Unable to read the sessions.", http.StatusInternalServerError)
+			return
+		}
+		if !slices.ContainsFunc(sessions, func(s data.Session) bool { return s.Handle == handle }) {
+			log.Println("Attempt to revoke a session that is not owned by", username)
+			utils.RenderError(w, "Session not found.", http.StatusNotFound)
+			return
+		}
+
+		err = sessionStore.DeleteSessionHandle(handle)
+		if err != nil && !errors.Is(err, data.ErrSessionNotFound) {
+			log.Println("Error revoking the session:", err)
+			utils.RenderError(w, "Error revoking the session. Please try again.", http.StatusInternalServerError)
+			return
+		}
+
+		current, err := r.Cookie(config.SessionCookieName)
+		if err == nil && data.SessionHandle(current.Value) == handle {
+			utils.DeleteAllCookies(w, r)
+			http.Redirect(w, r, "/admin/login", http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, "/admin/sessions", http.StatusFound)
+	}
+}
+
+// notifySession sends a push notification about the session change made by the requester.
+func notifySession(r *http.Request, username, titleSuffix, message string) {
+	ip, err := utils.RemoteIP(r)
+	if err != nil {
+		log.Println("Error getting the ip address of the requester.")
+		return
+	}
+	title := *config.WebHost + " - " + username + titleSuffix
+	for _, key := range config.GotifyAPIKeys {
+		utils.SendNoti(*config.GotifyServer, key, title, message+ip, 9)
+	}
+}
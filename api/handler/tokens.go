@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/htetmyatthar/server-manager/internal/config"
+	"github.com/htetmyatthar/server-manager/internal/database"
+	"github.com/htetmyatthar/server-manager/internal/utils"
+)
+
+// tokensPage is the data of the API tokens page.
+type tokensPage struct {
+	Username      string
+	Role          data.Role
+	Tokens        []data.APIToken
+	Scopes        []string
+	NewToken      string // the token that is just created, shown only once.
+	Now           time.Time
+	CSRFToken     string
+	CSRFTokenName string
+	Version       string
+}
+
+// AdminTokensGET is to show the API tokens page.
+func AdminTokensGET(tokenStore data.TokenStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		renderTokens(w, r, tokenStore, "", http.StatusOK)
+	}
+}
+
+// AdminTokensPOST is to create a new API token with the name, scope and optional expire date form values.
+// The created token is shown only once in the response page.
+func AdminTokensPOST(tokenStore data.TokenStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimSpace(r.FormValue("name"))
+		if name == "" {
+			log.Println("Error creating API token without name.")
+			utils.RenderError(w, "Token name is required!", http.StatusBadRequest)
+			return
+		}
+
+		// the token is valid until the end of the expire date.
+		var expiresAt time.Time
+		if expireDate := r.FormValue("expireDate"); expireDate != "" {
+			date, err := time.ParseInLocation(utils.DateLayout, expireDate, time.Local)
+			if err != nil || !date.After(time.Now()) {
+				log.Println("Error creating API token with invalid expire date:", expireDate)
+				utils.RenderError(w, "Expire date should be a date in the future!", http.StatusBadRequest)
+				return
+			}
+			expiresAt = date.AddDate(0, 0, 1)
+		}
+
+		value, token, err := tokenStore.CreateToken(name, r.Form["scope"], expiresAt)
+		if err != nil {
+			log.Println("Error creating API token:", err)
+			if errors.Is(err, data.ErrInvalidScope) {
+				utils.RenderError(w, "Choose at least one valid scope!", http.StatusBadRequest)
+				return
+			}
+			utils.RenderError(w, "Error saving the API token.", http.StatusInternalServerError)
+			return
+		}
+
+		notifyToken(r, " - API token is created", token, " is created by ")
+		renderTokens(w, r, tokenStore, value, http.StatusCreated)
+	}
+}
+
+// AdminTokenDeletePOST is to revoke the API token with the {id} path value.
+func AdminTokenDeletePOST(tokenStore data.TokenStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		tokens, err := tokenStore.ListTokens()
+		if err != nil {
+			log.Println("Error listing API tokens:", err)
+			utils.RenderError(w, "Unable to read the API tokens.", http.StatusInternalServerError)
+			return
+		}
+
+		err = tokenStore.DeleteToken(id)
+		if err != nil {
+			log.Println("Error revoking API token:", err)
+			if errors.Is(err, data.ErrTokenNotFound) {
+				utils.RenderError(w, "API token not found.", http.StatusNotFound)
+				return
+			}
+			utils.RenderError(w, "Error saving the API tokens.", http.StatusInternalServerError)
+			return
+		}
+
+		for _, token := range tokens {
+			if token.Id == id {
+				notifyToken(r, " - API token is revoked", token, " is revoked by ")
+			}
+		}
+		http.Redirect(w, r, "/admin/tokens", http.StatusFound)
+	}
+}
+
+// renderTokens renders the API tokens page with the given status code.
+func renderTokens(w http.ResponseWriter, r *http.Request, tokenStore data.TokenStore, newToken string, status int) {
+	session, err := r.Cookie(config.SessionCookieName)
+	if err == http.ErrNoCookie { // if no cookies login again.
+		http.Redirect(w, r, "/admin/login", http.StatusFound)
+		return
+	}
+
+	token, err := utils.GenerateCSRF(session.Value)
+	if err != nil {
+		log.Println("csrf generation gone wrong.", err)
+		utils.RenderError(w, "CSRF token generation gone wrong", http.StatusInternalServerError)
+		return
+	}
+
+	tokens, err := tokenStore.ListTokens()
+	if err != nil {
+		log.Println("Error listing API tokens:", err)
+		utils.RenderError(w, "Unable to read the API tokens.", http.StatusInternalServerError)
+		return
+	}
+
+	page := tokensPage{
+		Username:      utils.RequestUsername(r),
+		Role:          utils.RequestRole(r),
+		Tokens:        tokens,
+		Scopes:        data.Scopes,
+		NewToken:      newToken,
+		Now:           time.Now(),
+		CSRFToken:     token,
+		CSRFTokenName: config.CSRFFormFieldName,
+		Version:       config.Version,
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	utils.RenderTemplate(w, "tokens", page)
+}
+
+// notifyToken sends a push notification about the API token change made by the requester.
+func notifyToken(r *http.Request, titleSuffix string, token data.APIToken, verb string) {
+	ip, err := utils.RemoteIP(r)
+	if err != nil {
+		log.Println("Error getting the ip address of the requester.")
+		return
+	}
+	title := *config.WebHost + titleSuffix
+	message := "API token " + token.Name + " [[" + strings.Join(token.Scopes, ",") + "]]" + verb + ip
+	for _, key := range config.GotifyAPIKeys {
+		utils.SendNoti(*config.GotifyServer, key, title, message, 9)
+	}
+}
@@ -0,0 +1,356 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+
+	"github.com/htetmyatthar/server-manager/internal/config"
+	"github.com/htetmyatthar/server-manager/internal/database"
+	"github.com/htetmyatthar/server-manager/internal/utils"
+)
+
+// totpLoginTimeout is how long the TOTP code can be typed in after the password check of the login.
+const totpLoginTimeout time.Duration = 5 * time.Minute
+
+// totpPage is the data of the two-factor authentication page.
+type totpPage struct {
+	Username      string
+	Role          data.Role
+	Enabled       bool
+	RecoveryLeft  int          // number of the unused recovery codes.
+	Secret        string       // the new secret to be enrolled, only if it's not enabled.
+	QRCode        template.URL // data URI of the QR code of the new secret.
+	RecoveryCodes []string     // the recovery codes that are just generated, shown only once.
+	CSRFToken     string
+	CSRFTokenName string
+	Version       string
+}
+
+// AdminLoginTOTPGET is to show the second step of the login for the panel users with the TOTP or the passkeys enabled.
+func AdminLoginTOTPGET(sessionStore data.SessionStore, panelUsers data.PanelUserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		publicSession, username, ok := pendingTOTPLogin(r, sessionStore)
+		if !ok {
+			http.Redirect(w, r, "/admin/login", http.StatusFound)
+			return
+		}
+
+		user, err := panelUsers.GetUser(username)
+		if err != nil {
+			log.Println("Error getting the panel user:", err)
+			sessionStore.DeleteSession(publicSession.Value)
+			http.Redirect(w, r, "/admin/login", http.StatusFound)
+			return
+		}
+
+		token, err := utils.GenerateCSRF(publicSession.Value)
+		if err != nil {
+			log.Println("csrf generation gone wrong.", err)
+			utils.RenderError(w, "CSRF token generation gone wrong", http.StatusInternalServerError)
+			return
+		}
+
+		data := struct {
+			Username      string
+			TOTP          bool
+			Passkey       bool
+			CSRFToken     string
+			CSRFTokenName string
+			Version       string
+		}{
+			Username:      username,
+			TOTP:          user.TOTPEnabled(),
+			Passkey:       len(user.Passkeys) > 0,
+			CSRFToken:     token,
+			CSRFTokenName: config.CSRFFormFieldName,
+			Version:       config.Version,
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		utils.RenderTemplate(w, "login_totp", data)
+	}
+}
+
+// AdminLoginTOTPPOST is to verify the TOTP code or a recovery code of the panel user that passed the
+// password check, and then log the user in. The wrong codes are counted by the userLocker as the wrong passwords.
+func AdminLoginTOTPPOST(sessionStore data.SessionStore, panelUsers data.PanelUserStore, userLocker *utils.LockedOutRateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		publicSession, username, ok := pendingTOTPLogin(r, sessionStore)
+		if !ok {
+			log.Println("Attempt to verify the TOTP code without the password.")
+			http.Redirect(w, r, "/admin/login", http.StatusFound)
+			return
+		}
+
+		ip, err := utils.RemoteIP(r)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if userLocker.IsLockedOut(username, ip) {
+			log.Println("Too many failed attempts, ", ip)
+			utils.RenderError(w, "Too many failed attempts. Try again later. Contact administrator if needed.", http.StatusTooManyRequests)
+			return
+		}
+
+		// disabled or reset in the meantime.
+		user, err := panelUsers.GetUser(username)
+		if err != nil || user.Disabled || !user.TOTPEnabled() {
+			log.Println("Attempt to verify the TOTP code of a missing, disabled or not enrolled panel user", username)
+			sessionStore.DeleteSession(publicSession.Value)
+			http.Redirect(w, r, "/admin/login", http.StatusFound)
+			return
+		}
+
+		if err := verifySecondFactor(panelUsers, user, r.FormValue("code")); err != nil {
+			recordFailedLogin(userLocker, username, ip)
+			log.Println("Attempt with wrong TOTP code:", err)
+			http.Redirect(w, r, "/admin/login/totp", http.StatusFound)
+			return
+		}
+
+		// reset password attempts.
+		userLocker.ResetAttempts(username)
+		completeLogin(w, r, username, publicSession.Value, sessionStore, ip)
+	}
+}
+
+// AdminTOTPGET is to show the two-factor authentication page of the current panel user, with a new
+// secret to be enrolled if it's not enabled yet.
+func AdminTOTPGET(panelUsers data.PanelUserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := panelUsers.GetUser(utils.RequestUsername(r))
+		if err != nil {
+			log.Println("Error getting the panel user:", err)
+			renderPanelUserError(w, err)
+			return
+		}
+
+		secret := ""
+		if !user.TOTPEnabled() {
+			secret, err = utils.GenerateTOTPSecret()
+			if err != nil {
+				log.Println("Error generating the TOTP secret:", err)
+				utils.RenderError(w, "Internal Server Error.", http.StatusInternalServerError)
+				return
+			}
+		}
+		renderTOTP(w, r, user, secret, nil, http.StatusOK)
+	}
+}
+
+// AdminTOTPPOST is to enable the two-factor authentication of the current panel user with the secret
+// form value that is shown in the AdminTOTPGET, confirmed by the code form value. The recovery codes
+// are shown only once in the response page.
+func AdminTOTPPOST(panelUsers data.PanelUserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := utils.RequestUsername(r)
+		secret := r.FormValue("secret")
+
+		// replacing the secret needs the password through the disabling first.
+		user, err := panelUsers.GetUser(username)
+		if err != nil {
+			log.Println("Error getting the panel user:", err)
+			renderPanelUserError(w, err)
+			return
+		}
+		if user.TOTPEnabled() {
+			utils.RenderError(w, "Two-factor authentication is already enabled.", http.StatusConflict)
+			return
+		}
+
+		step, correct, err := utils.VerifyTOTP(secret, r.FormValue("code"), time.Now())
+		if err != nil || !correct {
+			log.Println("Error enabling the TOTP with wrong code.", err)
+			utils.RenderError(w, "Wrong code, scan the QR code again and type in the current code.", http.StatusBadRequest)
+			return
+		}
+
+		codes, hashes, err := utils.GenerateRecoveryCodes()
+		if err != nil {
+			log.Println("Error generating the recovery codes:", err)
+			utils.RenderError(w, "Internal Server Error.", http.StatusInternalServerError)
+			return
+		}
+
+		err = panelUsers.SetTOTP(username, secret, hashes)
+		if err == nil {
+			err = panelUsers.UseTOTPStep(username, step)
+		}
+		if err != nil {
+			log.Println("Error enabling the TOTP:", err)
+			renderPanelUserError(w, err)
+			return
+		}
+
+		user, err = panelUsers.GetUser(username)
+		if err != nil {
+			log.Println("Error getting the panel user:", err)
+			renderPanelUserError(w, err)
+			return
+		}
+		notifySession(r, username, " enabled 2FA", username+" enabled the two-factor authentication on "+*config.WebHostIP+" using ")
+		renderTOTP(w, r, user, "", codes, http.StatusCreated)
+	}
+}
+
+// AdminTOTPRecoveryPOST is to replace the recovery codes of the current panel user, re-authenticating
+// with the currentPassword form value. The new codes are shown only once in the response page.
+func AdminTOTPRecoveryPOST(panelUsers data.PanelUserStore, userLocker *utils.LockedOutRateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := verifyCurrentPassword(w, r, panelUsers, userLocker)
+		if !ok {
+			return
+		}
+		if !user.TOTPEnabled() {
+			utils.RenderError(w, "Two-factor authentication is not enabled.", http.StatusBadRequest)
+			return
+		}
+
+		codes, hashes, err := utils.GenerateRecoveryCodes()
+		if err != nil {
+			log.Println("Error generating the recovery codes:", err)
+			utils.RenderError(w, "Internal Server Error.", http.StatusInternalServerError)
+			return
+		}
+		if err := panelUsers.SetTOTP(user.Username, user.TOTPSecret, hashes); err != nil {
+			log.Println("Error replacing the recovery codes:", err)
+			renderPanelUserError(w, err)
+			return
+		}
+		user.RecoveryCodes = hashes
+
+		notifySession(r, user.Username, " replaced 2FA recovery codes", user.Username+" replaced the recovery codes on "+*config.WebHostIP+" using ")
+		renderTOTP(w, r, user, "", codes, http.StatusCreated)
+	}
+}
+
+// AdminTOTPDisablePOST is to disable the two-factor authentication of the current panel user,
+// re-authenticating with the currentPassword form value.
+func AdminTOTPDisablePOST(panelUsers data.PanelUserStore, userLocker *utils.LockedOutRateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := verifyCurrentPassword(w, r, panelUsers, userLocker)
+		if !ok {
+			return
+		}
+		if err := panelUsers.SetTOTP(user.Username, "", nil); err != nil {
+			log.Println("Error disabling the TOTP:", err)
+			renderPanelUserError(w, err)
+			return
+		}
+
+		notifySession(r, user.Username, " disabled 2FA", user.Username+" disabled the two-factor authentication on "+*config.WebHostIP+" using ")
+		http.Redirect(w, r, "/admin/totp", http.StatusFound)
+	}
+}
+
+// AdminUserTOTPResetPOST is to disable the two-factor authentication of the panel user with the
+// {username} path value, e.g. when the user lost the phone and the recovery codes.
+func AdminUserTOTPResetPOST(panelUsers data.PanelUserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := r.PathValue("username")
+		if username == utils.RequestUsername(r) {
+			log.Println("Attempt to reset the own TOTP of the panel user", username)
+			utils.RenderError(w, "Disable your own two-factor authentication in its page.", http.StatusBadRequest)
+			return
+		}
+
+		if err := panelUsers.SetTOTP(username, "", nil); err != nil {
+			log.Println("Error resetting the TOTP of the panel user:", err)
+			renderPanelUserError(w, err)
+			return
+		}
+
+		notifyPanelUser(r, username, " has 2FA reset")
+		http.Redirect(w, r, "/admin/users", http.StatusFound)
+	}
+}
+
+// pendingTOTPLogin returns the pre-session of the login form with the panel username that passed the
+// password check, false if there's none or the second factor(the TOTP code or the passkey) isn't given
+// within the totpLoginTimeout.
+func pendingTOTPLogin(r *http.Request, sessionStore data.SessionStore) (*http.Cookie, string, bool) {
+	publicSession, err := r.Cookie(config.SessionCookieName)
+	if err != nil {
+		return nil, "", false
+	}
+	session, err := sessionStore.GetSession(publicSession.Value)
+	if err != nil || !session.Public() || session.TOTPPending == "" {
+		return nil, "", false
+	}
+	if time.Since(session.CreatedAt) > totpLoginTimeout {
+		return nil, "", false
+	}
+	return publicSession, session.TOTPPending, true
+}
+
+// verifySecondFactor checks the code which is either the TOTP code or one of the recovery codes of the
+// panel user, using it up so that it can't be used again.
+func verifySecondFactor(panelUsers data.PanelUserStore, user data.PanelUser, code string) error {
+	// the recovery codes are longer than the TOTP codes.
+	if len(strings.ReplaceAll(code, " ", "")) > 6 {
+		return panelUsers.UseRecoveryCode(user.Username, utils.HashRecoveryCode(code))
+	}
+
+	step, correct, err := utils.VerifyTOTP(user.TOTPSecret, code, time.Now())
+	if err != nil {
+		return err
+	}
+	if !correct {
+		return errors.New("wrong TOTP code")
+	}
+	return panelUsers.UseTOTPStep(user.Username, step)
+}
+
+// renderTOTP renders the two-factor authentication page of the panel user with the given status code.
+// The secret is the one to be enrolled, and the recoveryCodes are the ones that are just generated.
+func renderTOTP(w http.ResponseWriter, r *http.Request, user data.PanelUser, secret string, recoveryCodes []string, status int) {
+	session, err := r.Cookie(config.SessionCookieName)
+	if err == http.ErrNoCookie { // if no cookies login again.
+		http.Redirect(w, r, "/admin/login", http.StatusFound)
+		return
+	}
+
+	token, err := utils.GenerateCSRF(session.Value)
+	if err != nil {
+		log.Println("csrf generation gone wrong.", err)
+		utils.RenderError(w, "CSRF token generation gone wrong", http.StatusInternalServerError)
+		return
+	}
+
+	page := totpPage{
+		Username:      user.Username,
+		Role:          utils.RequestRole(r),
+		Enabled:       user.TOTPEnabled(),
+		RecoveryLeft:  len(user.RecoveryCodes),
+		Secret:        secret,
+		RecoveryCodes: recoveryCodes,
+		CSRFToken:     token,
+		CSRFTokenName: config.CSRFFormFieldName,
+		Version:       config.Version,
+	}
+
+	if secret != "" {
+		png, err := qrcode.Encode(utils.TOTPURI(secret, user.Username), qrcode.Medium, 256)
+		if err != nil {
+			log.Println("Error generating the QR code:", err)
+			utils.RenderError(w, "Failed to generate QR code.", http.StatusInternalServerError)
+			return
+		}
+		// NOTE: the data URI is generated here, so it's safe to be trusted by the template.
+		page.QRCode = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png))
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	utils.RenderTemplate(w, "totp", page)
+}
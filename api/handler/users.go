@@ -0,0 +1,344 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/htetmyatthar/server-manager/internal/config"
+	"github.com/htetmyatthar/server-manager/internal/database"
+	"github.com/htetmyatthar/server-manager/internal/utils"
+)
+
+// minPasswordLength is the minimum length of the panel user passwords set through the panel.
+const minPasswordLength int = 8
+
+// usersPage is the data of the panel users page.
+type usersPage struct {
+	Username      string
+	Role          data.Role
+	Users         []data.PanelUser
+	Roles         []data.Role
+	CSRFToken     string
+	CSRFTokenName string
+	Version       string
+}
+
+// passwordPage is the data of the change password page.
+type passwordPage struct {
+	Username          string
+	Role              data.Role
+	MinPasswordLength int
+	CSRFToken         string
+	CSRFTokenName     string
+	Version           string
+}
+
+// AdminUsersGET is to show the panel users page.
+func AdminUsersGET(panelUsers data.PanelUserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, err := r.Cookie(config.SessionCookieName)
+		if err == http.ErrNoCookie { // if no cookies login again.
+			http.Redirect(w, r, "/admin/login", http.StatusFound)
+			return
+		}
+
+		token, err := utils.GenerateCSRF(session.Value)
+		if err != nil {
+			log.Println("csrf generation gone wrong.", err)
+			utils.RenderError(w, "CSRF token generation gone wrong", http.StatusInternalServerError)
+			return
+		}
+
+		users, err := panelUsers.ListUsers()
+		if err != nil {
+			log.Println("Error listing the panel users:", err)
+			utils.RenderError(w, "Unable to read the panel users.", http.StatusInternalServerError)
+			return
+		}
+
+		page := usersPage{
+			Username:      utils.RequestUsername(r),
+			Role:          utils.RequestRole(r),
+			Users:         users,
+			Roles:         data.Roles,
+			CSRFToken:     token,
+			CSRFTokenName: config.CSRFFormFieldName,
+			Version:       config.Version,
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		utils.RenderTemplate(w, "users", page)
+	}
+}
+
+// AdminUsersPOST is to create a new panel user with the username, role, password and confirmPassword form values.
+func AdminUsersPOST(panelUsers data.PanelUserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := strings.TrimSpace(r.FormValue("username"))
+		role := data.Role(r.FormValue("role"))
+		password, ok := newPassword(w, r)
+		if !ok {
+			return
+		}
+
+		hash, err := utils.HashPassword(password)
+		if err != nil {
+			log.Println("Error hashing the password:", err)
+			utils.RenderError(w, "Internal Server Error.", http.StatusInternalServerError)
+			return
+		}
+
+		_, err = panelUsers.CreateUser(username, hash, role)
+		if err != nil {
+			log.Println("Error creating the panel user:", err)
+			renderPanelUserError(w, err)
+			return
+		}
+
+		notifyPanelUser(r, username, " is created as "+string(role))
+		http.Redirect(w, r, "/admin/users", http.StatusFound)
+	}
+}
+
+// AdminUserDisablePOST is to disable or enable the panel user with the {username} path value,
+// depending on the disabled parameter. Disabling logs the user out of every session.
+func AdminUserDisablePOST(panelUsers data.PanelUserStore, sessionStore data.SessionStore, disabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := r.PathValue("username")
+		if username == utils.RequestUsername(r) {
+			log.Println("Attempt to disable the own panel user", username)
+			utils.RenderError(w, "You can't disable yourself.", http.StatusBadRequest)
+			return
+		}
+
+		err := panelUsers.SetDisabled(username, disabled)
+		if err != nil {
+			log.Println("Error disabling the panel user:", err)
+			renderPanelUserError(w, err)
+			return
+		}
+
+		if !disabled {
+			notifyPanelUser(r, username, " is enabled")
+			http.Redirect(w, r, "/admin/users", http.StatusFound)
+			return
+		}
+
+		if err := sessionStore.DeleteUserSessions(username); err != nil {
+			log.Println("Error deleting the sessions of the disabled panel user:", err)
+		}
+		notifyPanelUser(r, username, " is disabled")
+		http.Redirect(w, r, "/admin/users", http.StatusFound)
+	}
+}
+
+// AdminUserRolePOST is to change the role of the panel user with the {username} path value to the role form value.
+func AdminUserRolePOST(panelUsers data.PanelUserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := r.PathValue("username")
+		if username == utils.RequestUsername(r) {
+			log.Println("Attempt to change the role of the own panel user", username)
+			utils.RenderError(w, "You can't change your own role.", http.StatusBadRequest)
+			return
+		}
+
+		role := data.Role(r.FormValue("role"))
+		err := panelUsers.SetRole(username, role)
+		if err != nil {
+			log.Println("Error changing the role of the panel user:", err)
+			renderPanelUserError(w, err)
+			return
+		}
+
+		notifyPanelUser(r, username, " is changed to "+string(role))
+		http.Redirect(w, r, "/admin/users", http.StatusFound)
+	}
+}
+
+// AdminUserDeletePOST is to delete the panel user with the {username} path value and log the user out of every session.
+func AdminUserDeletePOST(panelUsers data.PanelUserStore, sessionStore data.SessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := r.PathValue("username")
+		if username == utils.RequestUsername(r) {
+			log.Println("Attempt to delete the own panel user", username)
+			utils.RenderError(w, "You can't delete yourself.", http.StatusBadRequest)
+			return
+		}
+
+		err := panelUsers.DeleteUser(username)
+		if err != nil {
+			log.Println("Error deleting the panel user:", err)
+			renderPanelUserError(w, err)
+			return
+		}
+
+		if err := sessionStore.DeleteUserSessions(username); err != nil {
+			log.Println("Error deleting the sessions of the deleted panel user:", err)
+		}
+		notifyPanelUser(r, username, " is deleted")
+		http.Redirect(w, r, "/admin/users", http.StatusFound)
+	}
+}
+
+// AdminPasswordGET is to show the page for changing the password of the current panel user.
+func AdminPasswordGET(w http.ResponseWriter, r *http.Request) {
+	session, err := r.Cookie(config.SessionCookieName)
+	if err == http.ErrNoCookie { // if no cookies login again.
+		http.Redirect(w, r, "/admin/login", http.StatusFound)
+		return
+	}
+
+	token, err := utils.GenerateCSRF(session.Value)
+	if err != nil {
+		log.Println("csrf generation gone wrong.", err)
+		utils.RenderError(w, "CSRF token generation gone wrong", http.StatusInternalServerError)
+		return
+	}
+
+	page := passwordPage{
+		Username:          utils.RequestUsername(r),
+		Role:              utils.RequestRole(r),
+		MinPasswordLength: minPasswordLength,
+		CSRFToken:         token,
+		CSRFTokenName:     config.CSRFFormFieldName,
+		Version:           config.Version,
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	utils.RenderTemplate(w, "password", page)
+}
+
+// AdminPasswordPOST is to change the password of the current panel user, re-authenticating with the
+// currentPassword form value. The wrong current passwords are counted by the userLocker as the login does.
+// The other sessions of the user are logged out, keeping the current one.
+func AdminPasswordPOST(panelUsers data.PanelUserStore, sessionStore data.SessionStore, userLocker *utils.LockedOutRateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := verifyCurrentPassword(w, r, panelUsers, userLocker)
+		if !ok {
+			return
+		}
+		username := user.Username
+
+		password, ok := newPassword(w, r)
+		if !ok {
+			return
+		}
+
+		hash, err := utils.HashPassword(password)
+		if err != nil {
+			log.Println("Error hashing the password:", err)
+			utils.RenderError(w, "Internal Server Error.", http.StatusInternalServerError)
+			return
+		}
+		if err := panelUsers.SetPassword(username, hash); err != nil {
+			log.Println("Error changing the password:", err)
+			renderPanelUserError(w, err)
+			return
+		}
+
+		// log out the other sessions which might be the reason of the change.
+		current, _ := utils.RequestSession(r)
+		sessions, err := sessionStore.ListSessions(username)
+		if err != nil {
+			log.Println("Error listing the sessions:", err)
+		}
+		for _, session := range sessions {
+			if session.Handle == current.Handle {
+				continue
+			}
+			if err := sessionStore.DeleteSessionHandle(session.Handle); err != nil && !errors.Is(err, data.ErrSessionNotFound) {
+				log.Println("Error revoking the session:", err)
+			}
+		}
+
+		notifySession(r, username, " changed the password", username+" changed the password on "+*config.WebHostIP+" using ")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusFound)
+	}
+}
+
+// verifyCurrentPassword re-authenticates the current panel user with the currentPassword form value
+// before the sensitive changes, rendering the error page if it's wrong. The wrong passwords are counted
+// by the userLocker as the login does.
+func verifyCurrentPassword(w http.ResponseWriter, r *http.Request, panelUsers data.PanelUserStore, userLocker *utils.LockedOutRateLimiter) (data.PanelUser, bool) {
+	username := utils.RequestUsername(r)
+	ip, _ := utils.RemoteIP(r)
+	if userLocker.IsLockedOut(username, ip) {
+		log.Println("Too many failed attempts, ", username)
+		utils.RenderError(w, "Too many failed attempts. Try again later. Contact administrator if needed.", http.StatusTooManyRequests)
+		return data.PanelUser{}, false
+	}
+
+	user, err := panelUsers.GetUser(username)
+	if err != nil {
+		log.Println("Error getting the panel user:", err)
+		renderPanelUserError(w, err)
+		return data.PanelUser{}, false
+	}
+	// NOTE: the panel users created by the single sign-on have no password, which isn't a failed attempt.
+	if user.Hash == "" {
+		log.Println("Attempt with the current password of the panel user without a password.", username)
+		utils.RenderError(w, "No password is set for this panel user. Use the single sign-on instead.", http.StatusBadRequest)
+		return data.PanelUser{}, false
+	}
+
+	correct, err := utils.VerifyPassword(r.FormValue("currentPassword"), user.Hash)
+	if err != nil && err != utils.ErrWrongPassword {
+		log.Println("verifying user password gone wrong.", err)
+		utils.RenderError(w, "Internal Server Error.", http.StatusInternalServerError)
+		return data.PanelUser{}, false
+	}
+	if !correct {
+		recordFailedLogin(userLocker, username, ip)
+		log.Println("Attempt with wrong current password.", username)
+		utils.RenderError(w, "Current password is wrong.", http.StatusUnauthorized)
+		return data.PanelUser{}, false
+	}
+	return user, true
+}
+
+// newPassword returns the password and confirmPassword form values if they match and the password
+// is long enough, rendering the error page otherwise.
+func newPassword(w http.ResponseWriter, r *http.Request) (string, bool) {
+	password := r.FormValue("password")
+	if password != r.FormValue("confirmPassword") {
+		log.Println("Error setting the password that doesn't match the confirmation.")
+		utils.RenderError(w, "Passwords don't match!", http.StatusBadRequest)
+		return "", false
+	}
+	if len(password) < minPasswordLength {
+		log.Println("Error setting the password that is too short.")
+		utils.RenderError(w, "Password should be at least "+strconv.Itoa(minPasswordLength)+" characters!", http.StatusBadRequest)
+		return "", false
+	}
+	return password, true
+}
+
+// renderPanelUserError renders the apology page that matches the error returned from the panel user store.
+func renderPanelUserError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, data.ErrPanelUserNotFound):
+		utils.RenderError(w, "Panel user not found.", http.StatusNotFound)
+	case errors.Is(err, data.ErrPanelUserExists):
+		utils.RenderError(w, "Panel user with the same username already exists.", http.StatusConflict)
+	case errors.Is(err, data.ErrInvalidPanelUser):
+		utils.RenderError(w, "Username can't be empty or contain spaces, tildes(~) and commas(,).", http.StatusBadRequest)
+	case errors.Is(err, data.ErrInvalidRole):
+		utils.RenderError(w, "Choose a valid role!", http.StatusBadRequest)
+	case errors.Is(err, data.ErrPasskeyNotFound):
+		utils.RenderError(w, "Passkey not found.", http.StatusNotFound)
+	case errors.Is(err, data.ErrLastPanelUser):
+		utils.RenderError(w, "The last active admin can't be disabled, deleted or demoted.", http.StatusConflict)
+	default:
+		utils.RenderError(w, "Error saving the panel users.", http.StatusInternalServerError)
+	}
+}
+
+// notifyPanelUser sends a push notification about the panel user change made by the requester, e.g. " is created".
+func notifyPanelUser(r *http.Request, username, change string) {
+	notifySession(r, username, change, "Panel user [["+username+"]]"+change+" by "+utils.RequestUsername(r)+" using ")
+}
@@ -1,9 +1,12 @@
 package middleware
 
 import (
+	"errors"
 	"log"
 	"net"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"strings"
 	"sync"
 	"time"
@@ -52,30 +55,262 @@ func Logging(next http.Handler) http.Handler {
 	})
 }
 
+// ClientIP resolves the IP address of the client and passes it to the next through the request context, see
+// utils.RemoteIP. The X-Forwarded-For and X-Real-IP headers are only trusted from the trusted proxies, otherwise
+// anyone could pretend to be anyone. The X-Forwarded-For is read from the right, as each proxy appends the address
+// it has seen, up to the first address that isn't a trusted proxy.
+func ClientIP(next http.Handler, trusted []netip.Prefix) http.Handler {
+	isTrusted := func(ip string) bool {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			return false
+		}
+		addr = addr.Unmap()
+		for _, prefix := range trusted {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if forwarded := r.Header.Values("X-Forwarded-For"); isTrusted(ip) && len(forwarded) > 0 {
+			hops := strings.Split(strings.Join(forwarded, ","), ",")
+			for i := len(hops) - 1; i >= 0; i-- {
+				hop := strings.TrimSpace(hops[i])
+				if _, err := netip.ParseAddr(hop); err != nil {
+					break
+				}
+				ip = hop
+				if !isTrusted(hop) {
+					break
+				}
+			}
+		} else if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); isTrusted(ip) && realIP != "" {
+			// NOTE: the X-Real-IP is set by the proxy itself, e.g. nginx with "proxy_set_header X-Real-IP $remote_addr;".
+			if _, err := netip.ParseAddr(realIP); err == nil {
+				ip = realIP
+			}
+		}
+
+		next.ServeHTTP(w, utils.WithClientIP(r, ip))
+	})
+}
+
+// IPFilter rejects the requests from the banned IP addresses, and the ones to the admin panel under "/admin"
+// from the IP addresses that aren't in the allowlist, see utils.IPBanner. The other requests from the IP
+// addresses out of the allowlist are marked by the utils.WithAdminDenied, and rejected by the LoginRequired if
+// they are session-authenticated, e.g. restarting the v2ray server from the dashboard. The bearer requests
+// of the JSON APIs are not limited.
+func IPFilter(next http.Handler, banner *utils.IPBanner) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip, err := utils.RemoteIP(r)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		allowed := banner.Allowed(ip)
+		isAdmin := r.URL.Path == "/admin" || strings.HasPrefix(r.URL.Path, "/admin/")
+		if _, banned := banner.Banned(ip); banned || (isAdmin && !allowed) {
+			log.Println("Rejected the request from the IP address:", ip, "banned:", banned)
+			forbidden(w, r)
+			return
+		}
+		if !allowed {
+			r = utils.WithAdminDenied(r)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forbidden responds the forbidden error, in JSON for the JSON APIs under "/api/".
+func forbidden(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		utils.JSONRespondError(w, http.StatusForbidden, "Forbidden.")
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+}
+
 // LoginRequired checks the user has already logged in or not by
 // checking the session cookie. Otherwise, the user is redirect to
-// Login page and forced to login.
+// Login page and forced to login. The JSON APIs under "/api/" are
+// responded with the unauthorized JSON error instead of the redirect.
+// The idle timeout of the session is refreshed on every request, see utils.SessionRefresh,
+// and the session is passed to the next through the request context, see utils.RequestSession.
+// The requests from the IP addresses out of the admin allowlist are forbidden, see the IPFilter.
 func LoginRequired(next http.HandlerFunc, sessionStore data.SessionStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		value, deleteCookiesFunc := utils.SessionValidate(r, sessionStore)
+		if utils.AdminDenied(r) {
+			log.Println("Rejected the logged in request out of the admin allowlist:", r.Method, r.URL.Path)
+			forbidden(w, r)
+			return
+		}
+
+		session, deleteCookiesFunc := utils.SessionValidate(r, sessionStore)
 		if deleteCookiesFunc != nil {
 			log.Println("Invalid session deleting cookies")
 			// utils.ErrInvalidSession will be returned
 			deleteCookiesFunc(w)
-			http.Redirect(w, r, "/admin/login", http.StatusFound)
+			loginRedirect(w, r)
+			return
+		}
+
+		if session.Public() { // user has no session or pre-session id
+			loginRedirect(w, r)
+			return
+		}
+
+		// slide the idle timeout of the session as the user is active.
+		refreshed, err := utils.SessionRefresh(w, r, session, sessionStore)
+		switch {
+		case errors.Is(err, data.ErrSessionNotFound) || errors.Is(err, data.ErrSessionExpired):
+			// revoked or expired in the meantime.
+			log.Println("Invalid session deleting cookies")
+			utils.DeleteAllCookies(w, r)
+			loginRedirect(w, r)
+			return
+		case err != nil:
+			// the session is still valid until its current expiry.
+			log.Println("Refreshing the session gone wrong:", err)
+		default:
+			session = refreshed
+		}
+
+		log.Println("Login middleware success user:", session.Username)
+		next.ServeHTTP(w, utils.WithSession(r, session))
+	}
+}
+
+// RoleRequired allows the logged in panel user only if the role of the user allows the given role.
+// The role is looked up on every request, so the role changes and the disabled users take effect
+// without logging in again. The role is passed to the next through the request context, see utils.RequestRole.
+// CAUTION: should be wrapped by the LoginRequired which sets the session of the request.
+func RoleRequired(next http.HandlerFunc, panelUsers data.PanelUserStore, role data.Role) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := panelUsers.GetUser(utils.RequestUsername(r))
+		if err != nil || user.Disabled {
+			// deleted or disabled in the meantime.
+			log.Println("Role middleware rejected the missing or disabled panel user:", utils.RequestUsername(r))
+			utils.DeleteAllCookies(w, r)
+			loginRedirect(w, r)
+			return
+		}
+
+		if !user.Role.Allows(role) {
+			log.Println("Panel user", user.Username, "with the role", user.Role, "is not allowed, required role:", role)
+			if strings.HasPrefix(r.URL.Path, "/api/") {
+				utils.JSONRespondError(w, http.StatusForbidden, "Forbidden, requires the role "+string(role))
+				return
+			}
+			utils.RenderError(w, "You are not allowed to do this. Contact administrator if needed.", http.StatusForbidden)
 			return
 		}
 
-		if value == SessionPublic { // user has pre-session id
-			http.Redirect(w, r, "/admin/login", http.StatusFound)
+		next.ServeHTTP(w, utils.WithRole(r, user.Role))
+	}
+}
+
+// StepUpRequired allows the sensitive actions only if the panel user authenticated in the session within
+// the -reauthduration, see utils.Reauthenticated. Otherwise the user is redirected to the re-authentication
+// page, which returns to the page of the action, and the JSON requests are responded with the unauthorized
+// JSON error. The requests without a session(e.g. the API tokens) are not asked.
+// CAUTION: should be wrapped by the LoginRequired which sets the session of the request.
+func StepUpRequired(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := utils.RequestSession(r)
+		if !ok || utils.Reauthenticated(session) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		log.Println("Step-up re-authentication required for", session.Username, r.Method, r.URL.Path)
+		if strings.HasPrefix(r.URL.Path, "/api/") || strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			utils.JSONRespondError(w, http.StatusUnauthorized, "Re-authentication required.")
 			return
 		}
 
-		log.Println("Login middleware success id:", value)
+		// return to the page that the action is taken from, the action itself has to be taken again.
+		back := "/admin/dashboard"
+		if referer, err := url.Parse(r.Referer()); err == nil && referer.Host == r.Host {
+			back = referer.Path
+		}
+		http.Redirect(w, r, "/admin/reauth?next="+url.QueryEscape(back), http.StatusSeeOther)
+	}
+}
+
+// loginRedirect redirects the user to the login page, or responds the unauthorized JSON error for the JSON APIs.
+func loginRedirect(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		utils.JSONRespondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	http.Redirect(w, r, "/admin/login", http.StatusFound)
+}
+
+// BearerRequired authenticates the JSON API requests with the "Authorization: Bearer <token>" header
+// against the tokenStore, allowing them only if the token carries the given scope. The bearer
+// requests are served without the session cookie and the CSRF token as they are not sent by the browsers.
+// Requests without the Authorization header are served by the fallback, which is usually the
+// LoginRequired (and CSRFRequired) wrapped handler. If the fallback is nil, only the bearer requests are allowed.
+func BearerRequired(next http.HandlerFunc, fallback http.HandlerFunc, tokenStore data.TokenStore, scope string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authorization := r.Header.Get("Authorization")
+		if authorization == "" {
+			if fallback == nil {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				utils.JSONRespondError(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+			fallback.ServeHTTP(w, r)
+			return
+		}
+
+		scheme, value, _ := strings.Cut(authorization, " ")
+		if !strings.EqualFold(scheme, "Bearer") || value == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			utils.JSONRespondError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		token, err := tokenStore.VerifyToken(strings.TrimSpace(value))
+		if err != nil {
+			log.Println("Error verifying the API token:", err)
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			utils.JSONRespondError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		if !token.HasScope(scope) {
+			log.Println("API token", token.Id, "is missing the scope:", scope)
+			w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+scope+`"`)
+			utils.JSONRespondError(w, http.StatusForbidden, "Forbidden, missing scope "+scope)
+			return
+		}
+
+		log.Println("Bearer middleware success token:", token.Id)
 		next.ServeHTTP(w, r)
 	}
 }
 
+// csrfBanner counts the invalid CSRF tokens toward the bans of the IP addresses, see BanCSRFFailures.
+var csrfBanner *utils.IPBanner
+
+// CountCSRFFailures makes the CSRFRequired count the invalid CSRF tokens toward the bans of the IP addresses
+// by the banner. The missing ones aren't counted, as the expired pages of the users send them too.
+func CountCSRFFailures(banner *utils.IPBanner) {
+	csrfBanner = banner
+}
+
 // CSRFRequired checks that the given request has valid CSRF token or not.
 // Rejecting to serve the next if the given CSRF is invalid. this checks the form values
 // and then header cookies for csrf token. This can also be used in JSON APIs.
@@ -85,7 +320,7 @@ func CSRFRequired(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// finding out the request is in JSON format or Normal browser
 		requestContentType := r.Header.Get("Content-Type")
-		isRequestJSON := strings.Contains(requestContentType, "application/json")
+		isRequestJSON := strings.Contains(requestContentType, "application/json") || strings.HasPrefix(r.URL.Path, "/api/")
 
 		// extract CSRF token from the form value or headers.
 		token := r.FormValue(CSRFFormFieldName)
@@ -108,6 +343,10 @@ func CSRFRequired(next http.HandlerFunc) http.HandlerFunc {
 		// validate CSRF token
 		_, err := utils.VerifyCSRF(token, r)
 		if err != nil {
+			if csrfBanner != nil {
+				ip, _ := utils.RemoteIP(r)
+				csrfBanner.Strike(ip, utils.StrikeCSRF)
+			}
 			responseMessage := "Bad request, invalid CSRF token"
 			if isRequestJSON {
 				utils.JSONRespondError(w, http.StatusBadRequest, "Bad request, invalid")
@@ -190,7 +429,7 @@ func (rl *RateLimiter) cleanupClients() {
 // Limit limits the api calls with the rl's defined rules.
 func (rl *RateLimiter) Limit(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		ip, err := utils.RemoteIP(r)
 		if err != nil {
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
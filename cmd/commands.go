@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/htetmyatthar/server-manager/internal/config"
+	d "github.com/htetmyatthar/server-manager/internal/database"
+	"github.com/htetmyatthar/server-manager/internal/utils"
+)
+
+// command is a sub command of the server-manager that is run instead of the servers,
+// e.g. `server-manager hash-password`. The args are the ones after the command name.
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"hash-password": {
+		usage: "hash-password\n\tprints the hash of the password read from the stdin, to be used in the -admins flag.",
+		run:   hashPasswordCommand,
+	},
+	"rotate-csrf-key": {
+		usage: "rotate-csrf-key\n\treplaces the CSRF key in the -csrfkeyfile with a new random one, the old key is accepted for the -csrfkeywindow.",
+		run:   rotateCSRFKeyCommand,
+	},
+}
+
+// runCommand runs the sub command with the given name and returns the exit code.
+func runCommand(name string, args []string) int {
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q. Available commands:\n", name)
+		for _, cmd := range commands {
+			fmt.Fprintln(os.Stderr, "  "+cmd.usage)
+		}
+		return 2
+	}
+	if err := cmd.run(args); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	return 0
+}
+
+// hashPasswordCommand reads a password from the stdin and prints its hash. The password is asked
+// twice without echoing if the stdin is a terminal, otherwise the first line is read.
+func hashPasswordCommand(args []string) error {
+	var password string
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, "Password: ")
+		first, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(os.Stderr, "Confirm password: ")
+		second, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return err
+		}
+		if string(first) != string(second) {
+			return errors.New("passwords don't match")
+		}
+		password = string(first)
+	} else {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return errors.New("no password is given in the stdin")
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	if password == "" {
+		return errors.New("password can't be empty")
+	}
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	fmt.Println(hash)
+	return nil
+}
+
+// rotateCSRFKeyCommand replaces the CSRF key with a new random one. The running panel picks the new key
+// up when it gets SIGHUP or is restarted.
+func rotateCSRFKeyCommand(args []string) error {
+	window := time.Duration(*config.CSRFKeyWindow) * time.Minute
+	ring, err := d.NewFileCSRFKeyRing(*config.CSRFKeyFile, window)
+	if err != nil {
+		return err
+	}
+	key, err := ring.Rotate()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Rotated the CSRF key in %s at %s, the old key is accepted until %s.\n",
+		*config.CSRFKeyFile, key.CreatedAt.Format(time.RFC3339), key.CreatedAt.Add(window).Format(time.RFC3339))
+	fmt.Println("Send SIGHUP to the running panel, e.g. with systemctl reload, or restart it to use the new key.")
+	return nil
+}
@@ -6,9 +6,11 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -19,8 +21,12 @@ import (
 
 	h "github.com/htetmyatthar/server-manager/api/handler"
 	m "github.com/htetmyatthar/server-manager/api/middleware"
+	"github.com/htetmyatthar/server-manager/internal/captcha"
 	. "github.com/htetmyatthar/server-manager/internal/config"
 	d "github.com/htetmyatthar/server-manager/internal/database"
+	"github.com/htetmyatthar/server-manager/internal/oidc"
+	"github.com/htetmyatthar/server-manager/internal/repository"
+	"github.com/htetmyatthar/server-manager/internal/scheduler"
 	"github.com/htetmyatthar/server-manager/internal/utils"
 )
 
@@ -32,11 +38,30 @@ var (
 	serverHTTP   *http.Server
 	sessionStore d.SessionStore
 
+	// tokenStore keeps the hashed API tokens for the automations.
+	tokenStore d.TokenStore
+
+	// panelUserStore keeps the panel users with the hashed passwords.
+	panelUserStore d.PanelUserStore
+
+	// clientRepository owns the v2ray config file and the users file.
+	clientRepository repository.ClientRepository
+
 	// embedded static file handler
 	staticHandler http.Handler
 
-	// userLocker locks out the user from logging in if the user exceeds certain number of trials.
-	userLocker = utils.NewLockedOutRateLimiter()
+	// oidcProvider is the identity provider of the single sign-on, nil if it's not configured.
+	oidcProvider *oidc.Provider
+	oidcMapping  utils.OIDCMapping
+
+	// captchaVerifier is the CAPTCHA of the login form after the failed attempts, nil if it's not configured.
+	captchaVerifier captcha.Verifier
+
+	// ipBanner rejects the banned IP addresses and the ones out of the allowlist of the admin panel.
+	ipBanner *utils.IPBanner
+
+	// userLocker locks out the users and the IP addresses from logging in if they exceed certain number of trials.
+	userLocker *utils.LockedOutRateLimiter
 
 	// Defined rate limit: 1 request per every 5 seconds with a burst of 3 for each ip address.
 	// call Limit() method to apply the defined rate limit on the end points.
@@ -44,12 +69,98 @@ var (
 )
 
 func init() {
-	// gets the new mem session store.
-	sessionStore = d.NewMemSessionStore()
+	// run the sub command instead of the servers if there's any.
+	if flag.NArg() > 0 {
+		os.Exit(runCommand(flag.Arg(0), flag.Args()[1:]))
+	}
+
+	// gets the configured session store.
+	var err error
+	switch *SessionBackend {
+	case "memory":
+		sessionStore = d.NewMemSessionStore()
+	case "file":
+		sessionStore, err = d.NewFileSessionStore(*SessionFile)
+		if err != nil {
+			log.Fatalln("Loading the sessions gone wrong: ", err)
+		}
+	case "redis":
+		sessionStore, err = d.NewRedisSessionStore(*RedisAddr, *RedisPassword, *RedisDB)
+		if err != nil {
+			log.Fatalln("Connecting to the redis session store gone wrong: ", err)
+		}
+	default:
+		log.Fatalln("Unknown session store: ", *SessionBackend)
+	}
+
+	// gets the CSRF keys on the configured file, creating a random key on the first start.
+	if err := utils.InitCSRFKeys(); err != nil {
+		log.Fatalln("Loading the CSRF keys gone wrong: ", err)
+	}
+
+	// gets the API token store on the configured file.
+	tokenStore, err = d.NewFileTokenStore(*TokenFile)
+	if err != nil {
+		log.Fatalln("Loading the API tokens gone wrong: ", err)
+	}
+
+	// gets the panel users on the configured file, seeding it from the -admins flag on the first start.
+	panelUserStore, err = d.NewFilePanelUserStore(*PanelUsersFile, func() map[string]string {
+		log.Println("Creating the panel users file from the -admins flag.")
+		return utils.InitPanelUsers(*Admins)
+	})
+	if err != nil {
+		log.Fatalln("Loading the panel users gone wrong: ", err)
+	}
+
+	// gets the bans on the configured file, the lockouts and the invalid CSRF tokens are counted toward them.
+	banStore, err := d.NewFileBanStore(*BanFile)
+	if err != nil {
+		log.Fatalln("Loading the bans gone wrong: ", err)
+	}
+	ipBanner, err = utils.NewIPBanner(banStore, *AdminAllow)
+	if err != nil {
+		log.Fatalln("Configuring the allowlist gone wrong: ", err)
+	}
+	m.CountCSRFFailures(ipBanner)
+
+	// gets the failed login attempts on the configured file, so that the lockouts survive the restarts.
+	lockoutStore, err := d.NewFileLockoutStore(*LockOutFile)
+	if err != nil {
+		log.Fatalln("Loading the lockouts gone wrong: ", err)
+	}
+	userLocker = utils.NewLockedOutRateLimiter(lockoutStore, ipBanner)
+
+	// gets the single sign-on identity provider if it's configured.
+	oidcProvider, err = utils.NewOIDCProvider()
+	if err != nil {
+		log.Fatalln("Configuring the single sign-on gone wrong: ", err)
+	}
+	oidcMapping, err = utils.InitOIDCMapping()
+	if err != nil {
+		log.Fatalln("Configuring the single sign-on gone wrong: ", err)
+	}
+
+	// gets the CAPTCHA of the login form if it's configured.
+	captchaVerifier, err = utils.NewCaptchaVerifier()
+	if err != nil {
+		log.Fatalln("Configuring the CAPTCHA gone wrong: ", err)
+	}
+
+	// gets the client repository on the configured files.
+	clientRepository = repository.NewFileClientRepository()
 
 	// HTTPS server config
 	muxHTTPS, serverHTTPS = InitHTTPSServer()
-	serverHTTPS.Handler = m.Logging(muxHTTPS)
+	// the forwarded headers are only trusted behind the reverse proxy.
+	var trustedProxies []netip.Prefix
+	if *ProxyAddr != "" {
+		trustedProxies, err = utils.ParsePrefixes(*TrustedProxies)
+		if err != nil {
+			log.Fatalln("Configuring the trusted proxies gone wrong: ", err)
+		}
+	}
+	serverHTTPS.Handler = m.Logging(m.ClientIP(m.IPFilter(muxHTTPS, ipBanner), trustedProxies))
 
 	// HTTP server config
 	muxHTTP, serverHTTP = InitHTTPServer()
@@ -60,10 +171,17 @@ func init() {
 }
 
 func main() {
-	// TODO: store the keys in the backend and produce the config URI in backend.
 	// TODO: check the index out of bound cases and if exists in slices when deleting and creating a qr.
-	// TODO: save the backup file and then check the config of the prepared file and if correct run and override,
-	// if not don't run and roll back to the back up file.
+
+	// finish off the config transaction that is interrupted by the previous process if there's any.
+	if err := utils.RecoverConfig(); err != nil {
+		log.Fatalln("Recovering the interrupted config transaction gone wrong: ", err)
+	}
+
+	// activate and expire the users by their dates periodically.
+	if *ScheduleInterval > 0 {
+		scheduler.NewClientScheduler(clientRepository, time.Duration(*ScheduleInterval)*time.Minute).Start()
+	}
 
 	// static file server
 	muxHTTPS.Handle("GET /static/"+Version+"/", http.StripPrefix("/static/"+Version+"/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -91,17 +209,79 @@ func main() {
 	})))
 
 	// routes HTTPS
-	muxHTTPS.HandleFunc("/", m.LoginRequired(h.DefaultHandler, sessionStore))
+	muxHTTPS.HandleFunc("/", m.LoginRequired(m.RoleRequired(h.DefaultHandler, panelUserStore, d.RoleViewer), sessionStore))
 	muxHTTPS.HandleFunc("/hello", h.Hello)
-	muxHTTPS.HandleFunc("GET /admin/login", h.AdminLoginGET(sessionStore))
-	muxHTTPS.HandleFunc("GET /admin/dashboard", m.LoginRequired(h.AdminDashboardGET, sessionStore))
+	muxHTTPS.HandleFunc("GET /admin/login", h.AdminLoginGET(sessionStore, userLocker, captchaVerifier, oidcProvider != nil))
+	muxHTTPS.HandleFunc("GET /admin/dashboard", m.LoginRequired(m.RoleRequired(h.AdminDashboardGET(clientRepository), panelUserStore, d.RoleViewer), sessionStore))
+	muxHTTPS.HandleFunc("GET /admin/accounts/{id}/link", m.LoginRequired(m.RoleRequired(h.AccountLinkGET(clientRepository), panelUserStore, d.RoleViewer), sessionStore))
+	muxHTTPS.HandleFunc("GET /admin/accounts/{id}/qr", m.LoginRequired(m.RoleRequired(h.AccountQRGET(clientRepository), panelUserStore, d.RoleViewer), sessionStore))
 	muxHTTPS.HandleFunc("GET /server/ip", h.ServerIPHandlerGET)
 
-	muxHTTPS.HandleFunc("POST /admin/login", m.CSRFRequired(h.AdminLoginPOST(sessionStore, userLocker)))
-	muxHTTPS.HandleFunc("POST /admin/accounts/edit", m.CSRFRequired(m.LoginRequired(h.AccountEditPOST, sessionStore)))
-	muxHTTPS.HandleFunc("POST /admin/accounts", m.CSRFRequired(m.LoginRequired(h.AccountCreatePOST, sessionStore)))
-	muxHTTPS.HandleFunc("POST /admin/accounts/delete", m.CSRFRequired(m.LoginRequired(h.AccountDeletePOST, sessionStore)))
-	muxHTTPS.HandleFunc("POST /server", genericRateLimiter.Limit(m.CSRFRequired(m.LoginRequired(h.ServerRestartPOST, sessionStore))))
+	muxHTTPS.HandleFunc("POST /admin/login", m.CSRFRequired(h.AdminLoginPOST(sessionStore, panelUserStore, userLocker, captchaVerifier)))
+	muxHTTPS.HandleFunc("GET /admin/login/totp", h.AdminLoginTOTPGET(sessionStore, panelUserStore))
+	muxHTTPS.HandleFunc("POST /admin/login/totp", m.CSRFRequired(h.AdminLoginTOTPPOST(sessionStore, panelUserStore, userLocker)))
+	muxHTTPS.HandleFunc("POST /admin/login/passkey/options", m.CSRFRequired(h.AdminLoginPasskeyOptionsPOST(sessionStore, panelUserStore)))
+	muxHTTPS.HandleFunc("POST /admin/login/passkey", m.CSRFRequired(h.AdminLoginPasskeyPOST(sessionStore, panelUserStore, userLocker)))
+	if oidcProvider != nil {
+		muxHTTPS.HandleFunc("GET /admin/login/oidc", h.AdminLoginOIDCGET(sessionStore, oidcProvider))
+		muxHTTPS.HandleFunc("GET /admin/login/oidc/callback", h.AdminLoginOIDCCallbackGET(sessionStore, panelUserStore, oidcProvider, oidcMapping))
+	}
+	muxHTTPS.HandleFunc("POST /admin/accounts/{id}/edit", m.CSRFRequired(m.LoginRequired(m.RoleRequired(h.AccountEditPOST(clientRepository), panelUserStore, d.RoleOperator), sessionStore)))
+	muxHTTPS.HandleFunc("POST /admin/accounts", m.CSRFRequired(m.LoginRequired(m.RoleRequired(h.AccountCreatePOST(clientRepository), panelUserStore, d.RoleOperator), sessionStore)))
+	muxHTTPS.HandleFunc("POST /admin/accounts/{id}/delete", m.CSRFRequired(m.LoginRequired(m.RoleRequired(m.StepUpRequired(h.AccountDeletePOST(clientRepository)), panelUserStore, d.RoleOperator), sessionStore)))
+	muxHTTPS.HandleFunc("POST /server", genericRateLimiter.Limit(m.CSRFRequired(m.LoginRequired(m.RoleRequired(m.StepUpRequired(h.ServerRestartPOST), panelUserStore, d.RoleOperator), sessionStore))))
+
+	muxHTTPS.HandleFunc("GET /admin/reauth", m.LoginRequired(m.RoleRequired(h.AdminReauthGET(panelUserStore, oidcProvider != nil), panelUserStore, d.RoleViewer), sessionStore))
+	muxHTTPS.HandleFunc("POST /admin/reauth", m.CSRFRequired(m.LoginRequired(m.RoleRequired(h.AdminReauthPOST(sessionStore, panelUserStore, userLocker), panelUserStore, d.RoleViewer), sessionStore)))
+	muxHTTPS.HandleFunc("POST /admin/reauth/passkey/options", m.CSRFRequired(m.LoginRequired(m.RoleRequired(h.AdminReauthPasskeyOptionsPOST(sessionStore, panelUserStore), panelUserStore, d.RoleViewer), sessionStore)))
+	muxHTTPS.HandleFunc("POST /admin/reauth/passkey", m.CSRFRequired(m.LoginRequired(m.RoleRequired(h.AdminReauthPasskeyPOST(sessionStore, panelUserStore, userLocker), panelUserStore, d.RoleViewer), sessionStore)))
+	muxHTTPS.HandleFunc("POST /admin/logout", m.CSRFRequired(m.LoginRequired(h.AdminLogoutPOST(sessionStore), sessionStore)))
+	muxHTTPS.HandleFunc("POST /admin/logout/everywhere", m.CSRFRequired(m.LoginRequired(h.AdminLogoutEverywherePOST(sessionStore), sessionStore)))
+	muxHTTPS.HandleFunc("GET /admin/sessions", m.LoginRequired(m.RoleRequired(h.AdminSessionsGET(sessionStore), panelUserStore, d.RoleViewer), sessionStore))
+	muxHTTPS.HandleFunc("POST /admin/sessions/{handle}/delete", m.CSRFRequired(m.LoginRequired(m.RoleRequired(h.AdminSessionDeletePOST(sessionStore), panelUserStore, d.RoleViewer), sessionStore)))
+	muxHTTPS.HandleFunc("GET /admin/users", m.LoginRequired(m.RoleRequired(h.AdminUsersGET(panelUserStore), panelUserStore, d.RoleAdmin), sessionStore))
+	muxHTTPS.HandleFunc("POST /admin/users", m.CSRFRequired(m.LoginRequired(m.RoleRequired(m.StepUpRequired(h.AdminUsersPOST(panelUserStore)), panelUserStore, d.RoleAdmin), sessionStore)))
+	muxHTTPS.HandleFunc("POST /admin/users/{username}/disable", m.CSRFRequired(m.LoginRequired(m.RoleRequired(m.StepUpRequired(h.AdminUserDisablePOST(panelUserStore, sessionStore, true)), panelUserStore, d.RoleAdmin), sessionStore)))
+	muxHTTPS.HandleFunc("POST /admin/users/{username}/enable", m.CSRFRequired(m.LoginRequired(m.RoleRequired(m.StepUpRequired(h.AdminUserDisablePOST(panelUserStore, sessionStore, false)), panelUserStore, d.RoleAdmin), sessionStore)))
+	muxHTTPS.HandleFunc("POST /admin/users/{username}/role", m.CSRFRequired(m.LoginRequired(m.RoleRequired(m.StepUpRequired(h.AdminUserRolePOST(panelUserStore)), panelUserStore, d.RoleAdmin), sessionStore)))
+	muxHTTPS.HandleFunc("POST /admin/users/{username}/delete", m.CSRFRequired(m.LoginRequired(m.RoleRequired(m.StepUpRequired(h.AdminUserDeletePOST(panelUserStore, sessionStore)), panelUserStore, d.RoleAdmin), sessionStore)))
+	muxHTTPS.HandleFunc("GET /admin/password", m.LoginRequired(m.RoleRequired(h.AdminPasswordGET, panelUserStore, d.RoleViewer), sessionStore))
+	muxHTTPS.HandleFunc("POST /admin/password", m.CSRFRequired(m.LoginRequired(m.RoleRequired(h.AdminPasswordPOST(panelUserStore, sessionStore, userLocker), panelUserStore, d.RoleViewer), sessionStore)))
+	muxHTTPS.HandleFunc("POST /admin/users/{username}/totp/reset", m.CSRFRequired(m.LoginRequired(m.RoleRequired(m.StepUpRequired(h.AdminUserTOTPResetPOST(panelUserStore)), panelUserStore, d.RoleAdmin), sessionStore)))
+	muxHTTPS.HandleFunc("GET /admin/totp", m.LoginRequired(m.RoleRequired(h.AdminTOTPGET(panelUserStore), panelUserStore, d.RoleViewer), sessionStore))
+	muxHTTPS.HandleFunc("POST /admin/totp", m.CSRFRequired(m.LoginRequired(m.RoleRequired(m.StepUpRequired(h.AdminTOTPPOST(panelUserStore)), panelUserStore, d.RoleViewer), sessionStore)))
+	muxHTTPS.HandleFunc("POST /admin/totp/recovery", m.CSRFRequired(m.LoginRequired(m.RoleRequired(h.AdminTOTPRecoveryPOST(panelUserStore, userLocker), panelUserStore, d.RoleViewer), sessionStore)))
+	muxHTTPS.HandleFunc("POST /admin/totp/disable", m.CSRFRequired(m.LoginRequired(m.RoleRequired(h.AdminTOTPDisablePOST(panelUserStore, userLocker), panelUserStore, d.RoleViewer), sessionStore)))
+	muxHTTPS.HandleFunc("POST /admin/users/{username}/passkeys/reset", m.CSRFRequired(m.LoginRequired(m.RoleRequired(m.StepUpRequired(h.AdminUserPasskeysResetPOST(panelUserStore)), panelUserStore, d.RoleAdmin), sessionStore)))
+	muxHTTPS.HandleFunc("GET /admin/passkeys", m.LoginRequired(m.RoleRequired(h.AdminPasskeysGET(panelUserStore), panelUserStore, d.RoleViewer), sessionStore))
+	muxHTTPS.HandleFunc("POST /admin/passkeys", m.CSRFRequired(m.LoginRequired(m.RoleRequired(m.StepUpRequired(h.AdminPasskeysPOST(sessionStore, panelUserStore)), panelUserStore, d.RoleViewer), sessionStore)))
+	muxHTTPS.HandleFunc("POST /admin/passkeys/options", m.CSRFRequired(m.LoginRequired(m.RoleRequired(m.StepUpRequired(h.AdminPasskeyOptionsPOST(sessionStore, panelUserStore)), panelUserStore, d.RoleViewer), sessionStore)))
+	muxHTTPS.HandleFunc("POST /admin/passkeys/{id}/delete", m.CSRFRequired(m.LoginRequired(m.RoleRequired(m.StepUpRequired(h.AdminPasskeyDeletePOST(panelUserStore)), panelUserStore, d.RoleViewer), sessionStore)))
+	muxHTTPS.HandleFunc("GET /admin/lockouts", m.LoginRequired(m.RoleRequired(h.AdminLockoutsGET(userLocker), panelUserStore, d.RoleAdmin), sessionStore))
+	muxHTTPS.HandleFunc("POST /admin/lockouts/unlock", m.CSRFRequired(m.LoginRequired(m.RoleRequired(m.StepUpRequired(h.AdminLockoutUnlockPOST(userLocker)), panelUserStore, d.RoleAdmin), sessionStore)))
+	muxHTTPS.HandleFunc("GET /admin/bans", m.LoginRequired(m.RoleRequired(h.AdminBansGET(ipBanner), panelUserStore, d.RoleAdmin), sessionStore))
+	muxHTTPS.HandleFunc("POST /admin/bans", m.CSRFRequired(m.LoginRequired(m.RoleRequired(m.StepUpRequired(h.AdminBansPOST(ipBanner)), panelUserStore, d.RoleAdmin), sessionStore)))
+	muxHTTPS.HandleFunc("POST /admin/bans/unban", m.CSRFRequired(m.LoginRequired(m.RoleRequired(m.StepUpRequired(h.AdminBanDeletePOST(ipBanner)), panelUserStore, d.RoleAdmin), sessionStore)))
+	muxHTTPS.HandleFunc("GET /admin/tokens", m.LoginRequired(m.RoleRequired(h.AdminTokensGET(tokenStore), panelUserStore, d.RoleAdmin), sessionStore))
+	muxHTTPS.HandleFunc("POST /admin/tokens", m.CSRFRequired(m.LoginRequired(m.RoleRequired(m.StepUpRequired(h.AdminTokensPOST(tokenStore)), panelUserStore, d.RoleAdmin), sessionStore)))
+	muxHTTPS.HandleFunc("POST /admin/tokens/{id}/delete", m.CSRFRequired(m.LoginRequired(m.RoleRequired(m.StepUpRequired(h.AdminTokenDeletePOST(tokenStore)), panelUserStore, d.RoleAdmin), sessionStore)))
+
+	// routes JSON API, bearer tokens with the scope or the logged in sessions with the role are allowed.
+	// CSRF tokens are only required for the sessions as the bearer tokens are never sent by the browsers.
+	apiRead := func(next http.HandlerFunc, scope string) http.HandlerFunc {
+		return m.BearerRequired(next, m.LoginRequired(m.RoleRequired(next, panelUserStore, d.RoleViewer), sessionStore), tokenStore, scope)
+	}
+	apiWrite := func(next http.HandlerFunc, scope string) http.HandlerFunc {
+		return m.BearerRequired(next, m.CSRFRequired(m.LoginRequired(m.RoleRequired(next, panelUserStore, d.RoleOperator), sessionStore)), tokenStore, scope)
+	}
+	muxHTTPS.HandleFunc("GET /api/v1/clients", apiRead(h.APIClientsGET(clientRepository), d.ScopeClientsRead))
+	muxHTTPS.HandleFunc("GET /api/v1/clients/{id}", apiRead(h.APIClientGET(clientRepository), d.ScopeClientsRead))
+	muxHTTPS.HandleFunc("POST /api/v1/clients", apiWrite(h.APIClientsPOST(clientRepository), d.ScopeClientsWrite))
+	muxHTTPS.HandleFunc("PUT /api/v1/clients/{id}", apiWrite(h.APIClientPUT(clientRepository), d.ScopeClientsWrite))
+	muxHTTPS.HandleFunc("DELETE /api/v1/clients/{id}", apiWrite(m.StepUpRequired(h.APIClientDELETE(clientRepository)), d.ScopeClientsWrite))
+	muxHTTPS.HandleFunc("POST /api/v1/clients/{id}/renew", apiWrite(h.APIClientRenewPOST(clientRepository), d.ScopeClientsWrite))
+	// the sessions should restart through the "POST /server" with the step-up re-authentication.
+	muxHTTPS.HandleFunc("POST /api/v1/server/restart", genericRateLimiter.Limit(m.BearerRequired(h.APIServerRestartPOST, nil, tokenStore, d.ScopeServerRestart)))
 
 	// routes HTTP
 	muxHTTP.HandleFunc("/", h.RedirectToHTTPSHandler)
@@ -110,30 +290,53 @@ func main() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
+	// reload the CSRF keys on SIGHUP, after they are rotated by the rotate-csrf-key command.
+	reloadChan := make(chan os.Signal, 1)
+	signal.Notify(reloadChan, syscall.SIGHUP)
 	go func() {
-		fmt.Printf("HTTPS Server started on https://%s%s\nMemory Usage: %d bytes\n", *WebHost, *WebPort, utils.GetMemoryUsage())
-		err := serverHTTPS.ListenAndServeTLS(*WebCert, *WebKey)
-		if err != nil {
-			if !errors.Is(err, http.ErrServerClosed) {
-				log.Fatalln("Starting up HTTPS server error, might be config related: ", err)
-			} else {
-				log.Println("HTTPS server shutting down...")
+		for range reloadChan {
+			if err := utils.ReloadCSRFKeys(); err != nil {
+				log.Println("Error reloading the CSRF keys:", err)
+				continue
 			}
+			log.Println("Reloaded the CSRF keys.")
 		}
 	}()
 
 	go func() {
-		fmt.Printf("HTTP Server started on http://%s%s\nMemory Usage: %d bytes\n", *WebHost, ":80", utils.GetMemoryUsage())
-		err := serverHTTP.ListenAndServe()
+		var err error
+		if *ProxyAddr != "" {
+			// the reverse proxy terminates the TLS and serves the https://WebHost itself.
+			fmt.Printf("HTTP Server started behind the reverse proxy on http://%s\nMemory Usage: %d bytes\n", *ProxyAddr, utils.GetMemoryUsage())
+			err = serverHTTPS.ListenAndServe()
+		} else {
+			fmt.Printf("HTTPS Server started on https://%s%s\nMemory Usage: %d bytes\n", *WebHost, *WebPort, utils.GetMemoryUsage())
+			err = serverHTTPS.ListenAndServeTLS(*WebCert, *WebKey)
+		}
 		if err != nil {
 			if !errors.Is(err, http.ErrServerClosed) {
-				log.Fatalln("Starting up HTTP server error, might be config related: ", err)
+				log.Fatalln("Starting up HTTPS server error, might be config related: ", err)
 			} else {
-				log.Println("HTTP server shutting down...")
+				log.Println("HTTPS server shutting down...")
 			}
 		}
 	}()
 
+	// NOTE: the reverse proxy redirects the http:// itself, and the :80 is usually taken by it.
+	if *ProxyAddr == "" {
+		go func() {
+			fmt.Printf("HTTP Server started on http://%s%s\nMemory Usage: %d bytes\n", *WebHost, ":80", utils.GetMemoryUsage())
+			err := serverHTTP.ListenAndServe()
+			if err != nil {
+				if !errors.Is(err, http.ErrServerClosed) {
+					log.Fatalln("Starting up HTTP server error, might be config related: ", err)
+				} else {
+					log.Println("HTTP server shutting down...")
+				}
+			}
+		}()
+	}
+
 	signal := <-sigChan
 	log.Println("Received shutdown request signal:", signal)
 
@@ -2,4 +2,15 @@ module github.com/htetmyatthar/server-manager
 
 go 1.23.0
 
-require golang.org/x/time v0.7.0
+require (
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+	golang.org/x/crypto v0.33.0
+	golang.org/x/image v0.23.0
+	golang.org/x/term v0.29.0
+	golang.org/x/time v0.7.0
+)
+
+require (
+	golang.org/x/sys v0.30.0 // indirect
+	golang.org/x/text v0.22.0 // indirect
+)
@@ -0,0 +1,47 @@
+// Package captcha implements the CAPTCHAs that the login form asks for after the failed attempts, either
+// a third party one verified over HTTP, e.g. reCAPTCHA or hCaptcha, or a self-hosted proof-of-work.
+package captcha
+
+import (
+	"context"
+	"errors"
+	"net/url"
+)
+
+const (
+	// KindReCAPTCHA is the reCAPTCHA v2 checkbox of Google.
+	KindReCAPTCHA string = "recaptcha"
+
+	// KindHCaptcha is the hCaptcha checkbox.
+	KindHCaptcha string = "hcaptcha"
+
+	// KindProofOfWork is the self-hosted proof-of-work that the browser solves without the user.
+	KindProofOfWork string = "pow"
+)
+
+var (
+	ErrInvalidConfig   = errors.New("Invalid CAPTCHA configuration.")
+	ErrMissingResponse = errors.New("CAPTCHA response is missing.")
+	ErrFailed          = errors.New("CAPTCHA is not solved.")
+	ErrUnavailable     = errors.New("CAPTCHA verification is unavailable.")
+)
+
+// Widget is what the login form needs to show the CAPTCHA.
+type Widget struct {
+	Kind       string
+	SiteKey    string // the public key of the third party CAPTCHAs.
+	ScriptURL  string // the script of the third party CAPTCHAs.
+	Field      string // the form field that the response is posted in.
+	Challenge  string // the challenge of the proof-of-work.
+	Difficulty int    // the number of the leading zero bits of the proof-of-work.
+}
+
+// Verifier is a CAPTCHA that can be shown in a form and verified when the form is posted.
+type Verifier interface {
+	// Widget returns a new CAPTCHA to show in the form.
+	Widget() (Widget, error)
+
+	// Verify checks the response of the CAPTCHA in the posted form from the given IP address.
+	// Returns ErrMissingResponse or ErrFailed if it's not solved, ErrUnavailable if it can't be checked.
+	Verify(ctx context.Context, form url.Values, ip string) error
+}
@@ -0,0 +1,107 @@
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// HTTPVerifier is a third party CAPTCHA that is verified by posting its response to the siteverify endpoint of
+// the provider, e.g. reCAPTCHA or hCaptcha which share the same API.
+type HTTPVerifier struct {
+	kind     string
+	siteKey  string
+	secret   string
+	endpoint string
+	client   *http.Client
+}
+
+// providers are the defaults of the third party CAPTCHAs.
+var providers = map[string]struct {
+	script   string
+	field    string
+	endpoint string
+}{
+	KindReCAPTCHA: {"https://www.google.com/recaptcha/api.js", "g-recaptcha-response", "https://www.google.com/recaptcha/api/siteverify"},
+	KindHCaptcha:  {"https://js.hcaptcha.com/1/api.js", "h-captcha-response", "https://api.hcaptcha.com/siteverify"},
+}
+
+// NewHTTPVerifier returns the verifier of the given kind, KindReCAPTCHA or KindHCaptcha. The endpoint is the
+// siteverify URL of the provider, empty for its default. It can be set to a local stand-in for testing.
+func NewHTTPVerifier(kind, siteKey, secret, endpoint string) (*HTTPVerifier, error) {
+	provider, ok := providers[kind]
+	if !ok {
+		return nil, fmt.Errorf("%w unknown kind %q", ErrInvalidConfig, kind)
+	}
+	if siteKey == "" || secret == "" {
+		return nil, fmt.Errorf("%w the site key and the secret are required", ErrInvalidConfig)
+	}
+	if endpoint == "" {
+		endpoint = provider.endpoint
+	}
+	if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("%w invalid endpoint %q", ErrInvalidConfig, endpoint)
+	}
+	return &HTTPVerifier{
+		kind:     kind,
+		siteKey:  siteKey,
+		secret:   secret,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Widget returns the checkbox of the provider with the site key.
+func (v *HTTPVerifier) Widget() (Widget, error) {
+	provider := providers[v.kind]
+	return Widget{Kind: v.kind, SiteKey: v.siteKey, ScriptURL: provider.script, Field: provider.field}, nil
+}
+
+// Verify posts the response of the checkbox to the siteverify endpoint.
+func (v *HTTPVerifier) Verify(ctx context.Context, form url.Values, ip string) error {
+	response := form.Get(providers[v.kind].field)
+	if response == "" {
+		return ErrMissingResponse
+	}
+
+	body := url.Values{"secret": {v.secret}, "response": {response}}
+	if ip != "" {
+		body.Set("remoteip", ip)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.endpoint, strings.NewReader(body.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w %v", ErrUnavailable, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w siteverify responded %s", ErrUnavailable, res.Status)
+	}
+
+	var result struct {
+		Success    bool     `json:"success"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return fmt.Errorf("%w %v", ErrUnavailable, err)
+	}
+	if !result.Success {
+		// NOTE: the invalid secret is the misconfiguration of the panel rather than the failure of the user.
+		for _, code := range result.ErrorCodes {
+			if code == "missing-input-secret" || code == "invalid-input-secret" {
+				return fmt.Errorf("%w the secret is rejected, %s", ErrUnavailable, code)
+			}
+		}
+		return ErrFailed
+	}
+	return nil
+}
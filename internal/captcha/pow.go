@@ -0,0 +1,139 @@
+package captcha
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"math/bits"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultDifficulty is the number of the leading zero bits of the proof-of-work, which takes about 65
+	// thousand hashes on average, a second or two in the browsers.
+	DefaultDifficulty int = 16
+
+	// powTimeout is how long the challenges of the proof-of-work can be solved.
+	powTimeout time.Duration = 10 * time.Minute
+
+	// powField is the form field of the solved challenge.
+	powField string = "captcha"
+)
+
+// ProofOfWork is the self-hosted CAPTCHA that asks the browser to find a solution that makes the sha-256 hash of
+// the challenge and the solution start with the Difficulty number of zero bits. It doesn't ask the users anything
+// but costs the password guessing scripts time on every attempt. The challenges are signed with a random key of
+// the process so they don't have to be stored, and each of them is accepted once until it expires.
+type ProofOfWork struct {
+	difficulty int
+	key        []byte
+	mu         sync.Mutex
+	used       map[string]time.Time // the solved challenges to their expiry.
+}
+
+// NewProofOfWork returns the proof-of-work with the given difficulty in bits.
+func NewProofOfWork(difficulty int) (*ProofOfWork, error) {
+	if difficulty < 1 || difficulty > 32 {
+		return nil, fmt.Errorf("%w difficulty should be between 1 and 32", ErrInvalidConfig)
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return &ProofOfWork{difficulty: difficulty, key: key, used: make(map[string]time.Time)}, nil
+}
+
+// Widget returns a new signed challenge in the form of "<random>.<expiry>.<signature>".
+func (p *ProofOfWork) Widget() (Widget, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return Widget{}, err
+	}
+	message := base64.RawURLEncoding.EncodeToString(random) + "." + strconv.FormatInt(time.Now().Add(powTimeout).Unix(), 10)
+	return Widget{
+		Kind:       KindProofOfWork,
+		Field:      powField,
+		Challenge:  message + "." + p.sign(message),
+		Difficulty: p.difficulty,
+	}, nil
+}
+
+// Verify checks the response in the form of "<challenge>.<solution>", whose sha-256 hash has to start with
+// the difficulty number of zero bits.
+func (p *ProofOfWork) Verify(ctx context.Context, form url.Values, ip string) error {
+	response := form.Get(powField)
+	if response == "" {
+		return ErrMissingResponse
+	}
+
+	challenge, solution, ok := cutLast(response, ".")
+	if !ok || solution == "" || len(solution) > 32 {
+		return ErrFailed
+	}
+	message, signature, ok := cutLast(challenge, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(p.sign(message))) {
+		return ErrFailed
+	}
+	_, expiry, _ := cutLast(message, ".")
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return ErrFailed
+	}
+	expiresAt := time.Unix(unix, 0)
+	now := time.Now()
+	if now.After(expiresAt) {
+		return ErrFailed
+	}
+
+	sum := sha256.Sum256([]byte(response))
+	if leadingZeroBits(sum[:]) < p.difficulty {
+		return ErrFailed
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for used, usedExpiresAt := range p.used {
+		if now.After(usedExpiresAt) {
+			delete(p.used, used)
+		}
+	}
+	if _, ok := p.used[challenge]; ok {
+		return ErrFailed
+	}
+	p.used[challenge] = expiresAt
+	return nil
+}
+
+// sign returns the base64url encoded HMAC of the message.
+func (p *ProofOfWork) sign(message string) string {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(message))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// cutLast slices s around the last instance of sep.
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// leadingZeroBits returns the number of the leading zero bits of b.
+func leadingZeroBits(b []byte) int {
+	n := 0
+	for _, c := range b {
+		if c != 0 {
+			return n + bits.LeadingZeros8(c)
+		}
+		n += 8
+	}
+	return n
+}
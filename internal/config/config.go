@@ -12,6 +12,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"testing"
 	"time"
 
 	"github.com/htetmyatthar/server-manager/web"
@@ -29,14 +30,46 @@ var (
 	V2rayPort        *string
 	UserFile         *string
 	ConfigFile       *string
+	TokenFile        *string
+	PanelUsersFile   *string
+	SessionBackend   *string
+	SessionFile      *string
+	CSRFKeyFile      *string
+	CSRFKeyWindow    *int
+	RedisAddr        *string
+	RedisPassword    *string
+	RedisDB          *int
 	SessionDuration  *int
+	SessionLifetime  *int
 	LockOutDuration  *int
+	LockOutMax       *int
+	LockOutFile      *string
+	ReauthDuration   *int
+	ScheduleInterval *int
 	GotifyServer     *string
+	OIDCIssuer       *string
+	OIDCClientID     *string
+	OIDCClientSecret *string
+	OIDCScopes       *string
+	OIDCClaim        *string
+	OIDCRoleClaim    *string
+	OIDCRoles        *string
+	OIDCProvision    *bool
+	OIDCDefaultRole  *string
+	Captcha          *string
+	CaptchaSiteKey   *string
+	CaptchaSecret    *string
+	CaptchaEndpoint  *string
+	CaptchaAfter     *int
+	AdminAllow       *string
+	BanFile          *string
+	BanDuration      *int
+	BanCSRFFailures  *int
+	BanLockouts      *int
+	ProxyAddr        *string
+	TrustedProxies   *string
 	GotifyAPIKeys    []string
 	TemplateBasePath string = "web/templates/"
-
-	CsrfSecret      string
-	CsrfSecretBytes []byte
 )
 
 const (
@@ -45,9 +78,9 @@ const (
 	// attempt of stealing cookies.
 	SessionCookieName string = "lothoneId"
 
-	// SessionPublic is the value of the values that is stored as the public session used for
-	// logining in for and such. Value of NaN is consider public session for session id keys.
-	SessionPublic string = "NaN"
+	// OIDCCookieName is the name of the cookie of the single sign-on pre-session, which is sent back
+	// with the redirect of the identity provider unlike the session cookie.
+	OIDCCookieName string = "lothoneSSO"
 
 	// Name of the form field the csrf token will be.
 	CSRFFormFieldName string = "token"
@@ -60,6 +93,10 @@ const (
 	// Maximum allowed failed attempts for user authentications.
 	MaxFailedAttempts int = 5
 
+	// Maximum allowed failed attempts from an IP address for any user, higher than the MaxFailedAttempts
+	// as the users behind the same NAT share it.
+	MaxFailedAttemptsIP int = 20
+
 	// TODO: change version variable and in the url of the static files path whenever making a release.
 
 	// version number of this server.
@@ -74,17 +111,58 @@ func init() {
 	V2rayPort = flag.String("v2rayport", "443", "port number of the v2ray proxy server")
 	WebCert = flag.String("webcert", "localhost.crt", "ssl/tls certificate for the web server")
 	WebKey = flag.String("webkey", "localhost.key", "ssl/tls certificate key for the web server")
-	Admins = flag.String("admins", "lothoneadmin~lothoneadmin0,lothoneadmin1~lothoneadmin1", "panel users with username and passwords seperated by tilde(~) and for each user seperated by comma(,)")
+	Admins = flag.String("admins",
+		"lothoneadmin~$argon2id$v=19$m=65536,t=3,p=2$bqPpUxzZvJ2L85h+WOdfaA$m5L9ivxEojSEMByAaM9NEkwx3nircXRotaiqAqIfsOo,"+
+			"lothoneadmin1~$argon2id$v=19$m=65536,t=3,p=2$o4xFf75+0k2WCIlBhw+4Ag$bKeLYQSDK0NrqasI7lZAkJgJbejC3TsP+cHbwBEoFUs",
+		"panel users with username and password hashes printed by the hash-password command seperated by tilde(~) and for each user seperated by comma(,). the plaintext passwords still work but show up in the process list")
 	UserFile = flag.String("userfile", "test/user_data.json", "track the users of the server")
 	ConfigFile = flag.String("configfile", "test/server.json", "config file of the v2ray proxy server")
+	TokenFile = flag.String("tokenfile", "tokens.json", "hashed API tokens for the automations calling the JSON APIs")
+	PanelUsersFile = flag.String("panelusersfile", "panel_users.json", "panel users with the hashed passwords, seeded from the admins flag if it doesn't exist")
 	GotifyServer = flag.String("gotifyserver", "meet.htetmyatthar.me:8080", "push nofication server domain name")
 	gotifyAPIKeys = flag.String("gotifyapikeys", "somekey,somekey", "keys for using with push notification system seperated by comma(,)")
-	SessionDuration = flag.Int("sessionduration", 10, "loggedin session remembered duration in minutes")
-	LockOutDuration = flag.Int("lockoutduration", 30, "locking out time for wrong password in minutes")
+	SessionBackend = flag.String("sessionstore", "memory", "where the sessions are stored, \"memory\", \"file\" to keep them through the restarts, or \"redis\" to share them between the panel instances")
+	SessionFile = flag.String("sessionfile", "sessions.json", "file to store the sessions in when the sessionstore is \"file\"")
+	RedisAddr = flag.String("redisaddr", "127.0.0.1:6379", "address of the redis server to store the sessions in when the sessionstore is \"redis\"")
+	RedisPassword = flag.String("redispassword", "", "password of the redis server, empty for no authentication")
+	RedisDB = flag.Int("redisdb", 0, "database number of the redis server")
+	CSRFKeyFile = flag.String("csrfkeyfile", "csrf_keys.json", "secret keys of the CSRF tokens, created with a random key if it doesn't exist")
+	CSRFKeyWindow = flag.Int("csrfkeywindow", 720, "minutes that the CSRF tokens signed with a rotated key are still accepted, see the rotate-csrf-key command")
+	SessionDuration = flag.Int("sessionduration", 10, "idle timeout of the loggedin sessions in minutes, refreshed on every request")
+	SessionLifetime = flag.Int("sessionmaxlifetime", 720, "maximum lifetime of the loggedin sessions in minutes regardless of the activity, 0 for no limit")
+	LockOutDuration = flag.Int("lockoutduration", 30, "locking out time for wrong password in minutes, doubled on every further wrong password up to the lockoutmax")
+	LockOutMax = flag.Int("lockoutmax", 1440, "maximum locking out time in minutes, the failed attempts are also forgotten after it without any")
+	LockOutFile = flag.String("lockoutfile", "lockouts.json", "failed attempts and lockouts of the usernames and the IP addresses, kept through the restarts")
+	ReauthDuration = flag.Int("reauthduration", 5, "minutes that a re-authentication unlocks the sensitive actions, e.g. restarting the v2ray server and deleting the clients")
+	ScheduleInterval = flag.Int("scheduleinterval", 60, "interval in minutes for activating and expiring the users by their start and expire dates, 0 to disable")
+	OIDCIssuer = flag.String("oidcissuer", "", "issuer URL of the OpenID Connect identity provider for the single sign-on, empty to disable it")
+	OIDCClientID = flag.String("oidcclientid", "", "client id of the panel at the OpenID Connect identity provider")
+	OIDCClientSecret = flag.String("oidcclientsecret", "", "client secret of the panel at the OpenID Connect identity provider, empty for a public client")
+	OIDCScopes = flag.String("oidcscopes", "openid email profile", "scopes asked from the OpenID Connect identity provider seperated by spaces")
+	OIDCClaim = flag.String("oidcclaim", "email", "claim of the ID token that is the panel username")
+	OIDCRoleClaim = flag.String("oidcroleclaim", "", "claim of the ID token that sets the role of the panel user on every login, e.g. groups. empty to keep the roles set in the panel")
+	OIDCRoles = flag.String("oidcroles", "", "values of the oidcroleclaim with the role seperated by tilde(~) and for each value seperated by comma(,), e.g. panel-admins~admin,panel-ops~operator. empty to use the role names as the values")
+	OIDCProvision = flag.Bool("oidcprovision", false, "create the panel users on their first single sign-on if they don't exist")
+	OIDCDefaultRole = flag.String("oidcdefaultrole", "viewer", "role of the panel users that are created on their first single sign-on, if the oidcroleclaim doesn't give one")
+	Captcha = flag.String("captcha", "", "CAPTCHA of the login form after the failed attempts, \"recaptcha\", \"hcaptcha\", \"pow\" for the self-hosted proof-of-work, or empty to disable it")
+	CaptchaSiteKey = flag.String("captchasitekey", "", "site key of the recaptcha or the hcaptcha")
+	CaptchaSecret = flag.String("captchasecret", "", "secret key of the recaptcha or the hcaptcha")
+	CaptchaEndpoint = flag.String("captchaendpoint", "", "siteverify URL of the recaptcha or the hcaptcha, empty for the default of the provider")
+	CaptchaAfter = flag.Int("captchaafter", 3, "failed login attempts from an IP address before the CAPTCHA is asked, 0 to always ask")
+	AdminAllow = flag.String("adminallow", "", "IP addresses or CIDR ranges that can open the admin panel seperated by comma(,), e.g. 192.0.2.0/24,2001:db8::/32. empty to allow all")
+	BanFile = flag.String("banfile", "bans.json", "banned IP addresses and CIDR ranges, kept through the restarts")
+	BanDuration = flag.Int("banduration", 1440, "banning time of the automatic bans in minutes, 0 to ban them until they are unbanned")
+	BanCSRFFailures = flag.Int("bancsrf", 10, "invalid CSRF tokens from an IP address in an hour before it's banned, 0 to disable")
+	BanLockouts = flag.Int("banlockouts", 3, "lockouts caused by an IP address in an hour before it's banned, 0 to disable")
+	ProxyAddr = flag.String("proxyaddr", "", "address to serve the plain HTTP on behind a reverse proxy that terminates the TLS, e.g. 127.0.0.1:8080. the HTTPS and the :80 redirect servers are skipped and the webport is only the public port of the proxy. empty to serve the HTTPS directly")
+	TrustedProxies = flag.String("trustedproxies", "127.0.0.1,::1", "IP addresses or CIDR ranges of the reverse proxies whose X-Forwarded-For and X-Real-IP headers are trusted seperated by comma(,), only used with the proxyaddr")
 	versionFlag := flag.Bool("version", false, "Show verion number.")
 
 	// parse the flags
-	flag.Parse()
+	// NOTE: the go test flags are parsed by the testing package later, so the defaults are used in the tests.
+	if !testing.Testing() {
+		flag.Parse()
+	}
 
 	// Check if the version flag was set
 	if *versionFlag {
@@ -93,15 +171,18 @@ func init() {
 	}
 
 	GotifyAPIKeys = strings.Split(*gotifyAPIKeys, ",")
-	CsrfSecret = "a1b2c3d4e5f60708192a3b4c5d6e7f80"
-	CsrfSecretBytes = []byte(CsrfSecret)
 }
 
-// InitServer initizlie the HTTPS server returning a multiplexor and the server
+// InitServer initizlie the HTTPS server returning a multiplexor and the server, which listens on the
+// ProxyAddr instead of the WebPort behind a reverse proxy.
 func InitHTTPSServer() (*http.ServeMux, *http.Server) {
+	addr := *WebPort
+	if *ProxyAddr != "" {
+		addr = *ProxyAddr
+	}
 	mux := http.NewServeMux()
 	server := &http.Server{
-		Addr:           *WebPort,
+		Addr:           addr,
 		ReadTimeout:    10 * time.Second,
 		WriteTimeout:   10 * time.Second,
 		MaxHeaderBytes: 1 << 20,
@@ -0,0 +1,186 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrBanNotFound = errors.New("Ban not found.")
+	ErrInvalidBan  = errors.New("Invalid IP address or CIDR range.")
+)
+
+// Ban is a banned IP address or CIDR range, which can't open any page of the panel until ExpiresAt.
+type Ban struct {
+	Prefix    string    `json:"prefix"` // the CIDR range, a single address is kept as a /32 or a /128.
+	Reason    string    `json:"reason"`
+	CreatedBy string    `json:"createdBy"` // the panel user who banned it, empty for the automatic bans.
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"` // zero if it's banned until it's unbanned.
+}
+
+// ActiveAt reports whether it's banned at the given time.
+func (b Ban) ActiveAt(now time.Time) bool {
+	return b.ExpiresAt.IsZero() || now.Before(b.ExpiresAt)
+}
+
+// Contains reports whether the ban covers the IP address.
+func (b Ban) Contains(addr netip.Addr) bool {
+	prefix, err := netip.ParsePrefix(b.Prefix)
+	return err == nil && prefix.Contains(addr.Unmap())
+}
+
+// ParsePrefix parses an IP address or a CIDR range, e.g. "192.0.2.1" or "2001:db8::/32", into the masked
+// CIDR range that the bans and the allowlist are kept in.
+func ParsePrefix(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "/") {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("%w %q", ErrInvalidBan, s)
+		}
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("%w %q", ErrInvalidBan, s)
+	}
+	if prefix.Addr().Is4In6() {
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), max(prefix.Bits()-96, 0))
+	}
+	return prefix.Masked(), nil
+}
+
+// BanStore defines the methods required for keeping the banned IP addresses.
+type BanStore interface {
+	// ListBans returns all the bans, the latest first.
+	ListBans() ([]Ban, error)
+
+	// FindBan returns the active ban that covers the IP address at the given time, the latest one if there
+	// are more, or ErrBanNotFound if it's not banned.
+	FindBan(addr netip.Addr, now time.Time) (Ban, error)
+
+	// SetBan creates or replaces the ban with its prefix.
+	SetBan(ban Ban) error
+
+	// DeleteBan removes the ban with the given prefix.
+	DeleteBan(prefix string) error
+
+	// DeleteExpiredBans removes the bans that have expired at the given time.
+	DeleteExpiredBans(now time.Time) error
+}
+
+// FileBanStore is a BanStore that keeps the bans in a JSON file, so that they survive the restarts.
+type FileBanStore struct {
+	path string
+	mu   sync.RWMutex
+	bans map[string]Ban
+}
+
+// NewFileBanStore loads the bans from the JSON file with the given path.
+// The file is created when the first ban is added.
+func NewFileBanStore(path string) (*FileBanStore, error) {
+	var bans []Ban
+	if _, err := readJSONFile(path, &bans); err != nil {
+		return nil, err
+	}
+	store := &FileBanStore{path: path, bans: make(map[string]Ban, len(bans))}
+	for _, ban := range bans {
+		store.bans[ban.Prefix] = ban
+	}
+	return store, nil
+}
+
+// ListBans returns all the bans, the latest first.
+func (store *FileBanStore) ListBans() ([]Ban, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	return sortBans(store.bans), nil
+}
+
+// FindBan returns the active ban that covers the IP address at the given time, the latest one if there
+// are more, or ErrBanNotFound if it's not banned.
+// NOTE: it's called on every request, so the bans are scanned in place without copying or sorting them.
+func (store *FileBanStore) FindBan(addr netip.Addr, now time.Time) (Ban, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	var found Ban
+	for _, ban := range store.bans {
+		if ban.ActiveAt(now) && ban.Contains(addr) && (found.Prefix == "" || ban.CreatedAt.After(found.CreatedAt)) {
+			found = ban
+		}
+	}
+	if found.Prefix == "" {
+		return Ban{}, ErrBanNotFound
+	}
+	return found, nil
+}
+
+// SetBan creates or replaces the ban with its prefix.
+func (store *FileBanStore) SetBan(ban Ban) error {
+	prefix, err := ParsePrefix(ban.Prefix)
+	if err != nil {
+		return err
+	}
+	ban.Prefix = prefix.String()
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	bans := maps.Clone(store.bans)
+	bans[ban.Prefix] = ban
+	return store.save(bans)
+}
+
+// DeleteBan removes the ban with the given prefix.
+func (store *FileBanStore) DeleteBan(prefix string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.bans[prefix]; !ok {
+		return ErrBanNotFound
+	}
+	bans := maps.Clone(store.bans)
+	delete(bans, prefix)
+	return store.save(bans)
+}
+
+// DeleteExpiredBans removes the bans that have expired at the given time.
+func (store *FileBanStore) DeleteExpiredBans(now time.Time) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	bans := maps.Clone(store.bans)
+	maps.DeleteFunc(bans, func(_ string, b Ban) bool {
+		return !b.ActiveAt(now)
+	})
+	if len(bans) == len(store.bans) {
+		return nil
+	}
+	return store.save(bans)
+}
+
+// save writes the bans to the file and replaces the ones in memory only if it succeeds.
+// CAUTION: the caller should hold the lock.
+func (store *FileBanStore) save(bans map[string]Ban) error {
+	if err := writeJSONFile(store.path, sortBans(bans), 0600); err != nil {
+		return err
+	}
+	store.bans = bans
+	return nil
+}
+
+// sortBans returns the bans with the latest first.
+func sortBans(bans map[string]Ban) []Ban {
+	return slices.SortedFunc(maps.Values(bans), func(a, b Ban) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+}
@@ -0,0 +1,133 @@
+package data
+
+import (
+	"crypto/rand"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// csrfKeySize is the size of the CSRF keys in bytes.
+const csrfKeySize = 32
+
+var ErrInvalidCSRFKey = errors.New("Invalid CSRF key.")
+
+// CSRFKey is a secret key of the HMAC of the CSRF tokens.
+type CSRFKey struct {
+	Key       []byte    `json:"key"` // base64 encoded in the file.
+	CreatedAt time.Time `json:"createdAt"`
+	RetiredAt time.Time `json:"retiredAt"` // zero for the current key.
+}
+
+// CSRFKeyRing keeps the CSRF keys in a JSON file that is only readable by the owner. The first key is
+// the current one that signs the new tokens, the retired ones still verify the tokens they have signed
+// until the rotation window after their retirement is over.
+type CSRFKeyRing struct {
+	path   string
+	window time.Duration
+	mu     sync.RWMutex
+	keys   []CSRFKey
+}
+
+// NewFileCSRFKeyRing loads the CSRF keys from the JSON file with the given path. The file is created
+// with a new random key if it doesn't exist yet, so that every install has its own key.
+func NewFileCSRFKeyRing(path string, window time.Duration) (*CSRFKeyRing, error) {
+	ring := &CSRFKeyRing{path: path, window: window}
+	if err := ring.Reload(); err != nil {
+		return nil, err
+	}
+	return ring, nil
+}
+
+// Reload loads the keys from the file again, e.g. after they are rotated by another process.
+func (ring *CSRFKeyRing) Reload() error {
+	ring.mu.Lock()
+	defer ring.mu.Unlock()
+
+	var keys []CSRFKey
+	exists, err := readJSONFile(ring.path, &keys)
+	if err != nil {
+		return err
+	}
+	if !exists || len(keys) == 0 {
+		key, err := newCSRFKey()
+		if err != nil {
+			return err
+		}
+		keys = []CSRFKey{key}
+		if err := writeJSONFile(ring.path, keys, 0600); err != nil {
+			return err
+		}
+	} else if err := os.Chmod(ring.path, 0600); err != nil {
+		// CAUTION: anyone who can read the keys can forge the CSRF tokens.
+		return err
+	}
+
+	for _, key := range keys {
+		if len(key.Key) < csrfKeySize {
+			return ErrInvalidCSRFKey
+		}
+	}
+	ring.keys = keys
+	return nil
+}
+
+// Current returns the key that signs the new tokens.
+func (ring *CSRFKeyRing) Current() []byte {
+	ring.mu.RLock()
+	defer ring.mu.RUnlock()
+	return ring.keys[0].Key
+}
+
+// Keys returns the keys that verify the tokens, the current one first.
+func (ring *CSRFKeyRing) Keys() [][]byte {
+	ring.mu.RLock()
+	defer ring.mu.RUnlock()
+
+	now := time.Now()
+	keys := make([][]byte, 0, len(ring.keys))
+	for i, key := range ring.keys {
+		if i == 0 || now.Before(key.RetiredAt.Add(ring.window)) {
+			keys = append(keys, key.Key)
+		}
+	}
+	return keys
+}
+
+// Rotate retires the current key and replaces it with a new random one. The retired keys that are out
+// of the rotation window are dropped. Returns the new key.
+// NOTE: the running panel keeps using the old keys until it's reloaded.
+func (ring *CSRFKeyRing) Rotate() (CSRFKey, error) {
+	key, err := newCSRFKey()
+	if err != nil {
+		return CSRFKey{}, err
+	}
+
+	ring.mu.Lock()
+	defer ring.mu.Unlock()
+
+	keys := []CSRFKey{key}
+	for i, old := range ring.keys {
+		if i == 0 {
+			old.RetiredAt = key.CreatedAt
+		}
+		if key.CreatedAt.Before(old.RetiredAt.Add(ring.window)) {
+			keys = append(keys, old)
+		}
+	}
+	if err := writeJSONFile(ring.path, keys, 0600); err != nil {
+		return CSRFKey{}, err
+	}
+	ring.keys = keys
+	return key, nil
+}
+
+// newCSRFKey returns a new random key.
+func newCSRFKey() (CSRFKey, error) {
+	key := make([]byte, csrfKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return CSRFKey{}, err
+	}
+	return CSRFKey{Key: key, CreatedAt: time.Now().UTC().Truncate(time.Second)}, nil
+}
@@ -2,9 +2,11 @@
 package data
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"log"
-	"strconv"
+	"slices"
 	"sync"
 	"time"
 
@@ -17,39 +19,116 @@ var (
 	ErrSessionExpired  = errors.New("Session expired.")
 )
 
+// Session is a record of the session store. The public sessions(pre-sessions for logging in)
+// have no Username, and the private(authenticated) ones have the username of the panel user.
 type Session struct {
-	Data      string
-	ExpiresAt time.Time
+	Username  string    `json:"username,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"userAgent,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt"`
+
+	// ReauthAt is when the panel user last authenticated in this session, at the login or the step-up
+	// re-authentication before the sensitive actions.
+	ReauthAt time.Time `json:"reauthAt"`
+
+	// TOTPPending is the panel user that passed the password check of the login and has to type in
+	// the TOTP code in this public session, empty otherwise.
+	TOTPPending string `json:"totpPending,omitempty"`
+
+	// Challenge is the WebAuthn challenge of the passkey ceremony that is in progress in this session, if any.
+	Challenge *WebAuthnChallenge `json:"challenge,omitempty"`
+
+	// OIDC is the single sign-on that is in progress in this session, if any.
+	OIDC *OIDCLogin `json:"oidc,omitempty"`
+
+	// Handle identifies the session without revealing the session id, so that the sessions can
+	// be listed and revoked. It is the SessionHandle of the session id and filled by the store.
+	Handle string `json:"-"`
+}
+
+// WebAuthnChallenge is a challenge of a passkey registration or login that is waiting for the response
+// of the authenticator. It can be used only once.
+type WebAuthnChallenge struct {
+	Value     string    `json:"value"`
+	Purpose   string    `json:"purpose"` // "register" or "login"
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// OIDCLogin is the state of a single sign-on that is waiting for the callback of the identity provider.
+// CAUTION: the Verifier is the PKCE code verifier, a secret.
+type OIDCLogin struct {
+	State     string    `json:"state"`
+	Nonce     string    `json:"nonce"`
+	Verifier  string    `json:"verifier"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Public reports whether the session is a public session that is not logged in.
+func (s Session) Public() bool {
+	return s.Username == ""
 }
 
 // SessionStore defines the methods required for session management.
 type SessionStore interface {
-	// CreateSession creates a new session with the given ID and data that valid through the config.SessionDuration.
-	// If the data string is ""(empty), the default user id is added using the sessionCount value of the session store.
-	CreateSession(id string, data string) error
+	// CreateSession creates a new session with the given ID that valid through the SessionExpiresAt.
+	// The CreatedAt is set to the current time if it is zero.
+	CreateSession(id string, session Session) error
 
 	// GetSession retrieves the session data for the given ID.
 	GetSession(id string) (Session, error)
 
+	// TouchSession slides the idle timeout of the session with the given ID to the SessionExpiresAt of now,
+	// returning the refreshed session.
+	TouchSession(id string) (Session, error)
+
 	// DeleteSession removes the session with the given ID.
 	DeleteSession(id string) error
 
+	// ListSessions returns the unexpired sessions of the given panel user, the oldest first.
+	ListSessions(username string) ([]Session, error)
+
+	// DeleteSessionHandle removes the session with the given handle.
+	DeleteSessionHandle(handle string) error
+
+	// DeleteUserSessions removes all the sessions of the given panel user, logging them out everywhere.
+	DeleteUserSessions(username string) error
+
 	// CleanupExpiredSessions removes all sessions that have expired.
 	CleanupExpiredSessions() error
 }
 
+// SessionHandle returns the handle of the given session id, which is the hex encoded sha-256 hash of it.
+// The stores use the handles as the keys, so the leaked stores can't be used to take over the sessions.
+func SessionHandle(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+// SessionExpiresAt returns the time that the session created at the given time expires if it is used now.
+// Sessions expire after the config.SessionDuration(idle timeout) of the last use, but not later than the
+// config.SessionLifetime(maximum lifetime) of the creation if it's not 0.
+func SessionExpiresAt(createdAt, now time.Time) time.Time {
+	expiresAt := now.Add(time.Duration(*config.SessionDuration) * time.Minute)
+	if *config.SessionLifetime > 0 {
+		deadline := createdAt.Add(time.Duration(*config.SessionLifetime) * time.Minute)
+		if deadline.Before(expiresAt) {
+			expiresAt = deadline
+		}
+	}
+	return expiresAt
+}
+
 // MemSessionStore is an in-memory implementation of SessionShop
 type MemSessionStore struct {
-	sessions     map[string]Session
-	mu           sync.RWMutex
-	sessionCount int
+	sessions map[string]Session // session handle to the session.
+	mu       sync.RWMutex
 }
 
 // NewMemSessionStore initializes a new InMemorySessionStore.
 func NewMemSessionStore() *MemSessionStore {
 	store := &MemSessionStore{
-		sessions:     make(map[string]Session),
-		sessionCount: 0,
+		sessions: make(map[string]Session),
 	}
 
 	// Start the cleanup goroutine
@@ -58,35 +137,22 @@ func NewMemSessionStore() *MemSessionStore {
 	return store
 }
 
-// CreateSession creates a new session. If the data string is ""(empty), the default
-// user id is added using the sessionCount value of the session store.
-func (store *MemSessionStore) CreateSession(id string, data string) error {
+// CreateSession creates a new session.
+func (store *MemSessionStore) CreateSession(id string, session Session) error {
 	store.mu.Lock()
 	defer store.mu.Unlock()
 
 	// NOTE: always overwrite the existing session.
-	if data != "" {
-		store.sessions[id] = Session{
-			Data:      strconv.Itoa(store.sessionCount),
-			ExpiresAt: time.Now().Add(time.Duration(*config.SessionDuration) * time.Minute),
-		}
-		store.sessionCount++
-	} else {
-		store.sessions[id] = Session{
-			Data:      data,
-			ExpiresAt: time.Now().Add(time.Duration(*config.SessionDuration) * time.Minute),
-		}
-	}
-
+	store.sessions[SessionHandle(id)] = newSession(id, session)
 	return nil
 }
 
 // GetSession retrieves a session by ID returning error if the session is invalid or expired.
 func (store *MemSessionStore) GetSession(id string) (Session, error) {
+	handle := SessionHandle(id)
 	store.mu.RLock()
-	defer store.mu.RUnlock()
-
-	session, exists := store.sessions[id]
+	session, exists := store.sessions[handle]
+	store.mu.RUnlock()
 	if !exists {
 		return Session{}, ErrSessionNotFound
 	}
@@ -94,8 +160,9 @@ func (store *MemSessionStore) GetSession(id string) (Session, error) {
 	// Check if session has expired
 	if time.Now().After(session.ExpiresAt) {
 		// Session expired, delete it.
+		// NOTE: the read lock should be released before, otherwise this will deadlock.
 		store.mu.Lock()
-		delete(store.sessions, id)
+		delete(store.sessions, handle)
 		store.mu.Unlock()
 		return Session{}, ErrSessionExpired
 	}
@@ -103,16 +170,66 @@ func (store *MemSessionStore) GetSession(id string) (Session, error) {
 	return session, nil
 }
 
+// TouchSession slides the idle timeout of a session by ID returning error if the session is invalid or expired.
+func (store *MemSessionStore) TouchSession(id string) (Session, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	handle := SessionHandle(id)
+	session, exists := store.sessions[handle]
+	if !exists {
+		return Session{}, ErrSessionNotFound
+	}
+	now := time.Now()
+	if now.After(session.ExpiresAt) {
+		delete(store.sessions, handle)
+		return Session{}, ErrSessionExpired
+	}
+
+	session.ExpiresAt = SessionExpiresAt(session.CreatedAt, now)
+	store.sessions[handle] = session
+	return session, nil
+}
+
 // DeleteSession removes a session by ID.
 func (store *MemSessionStore) DeleteSession(id string) error {
+	return store.DeleteSessionHandle(SessionHandle(id))
+}
+
+// ListSessions returns the unexpired sessions of the given panel user.
+func (store *MemSessionStore) ListSessions(username string) ([]Session, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	return userSessions(store.sessions, username), nil
+}
+
+// DeleteSessionHandle removes a session by its handle.
+func (store *MemSessionStore) DeleteSessionHandle(handle string) error {
 	store.mu.Lock()
 	defer store.mu.Unlock()
 
-	if _, exists := store.sessions[id]; !exists {
+	if _, exists := store.sessions[handle]; !exists {
 		return ErrSessionNotFound
 	}
 
-	delete(store.sessions, id)
+	delete(store.sessions, handle)
+	return nil
+}
+
+// DeleteUserSessions removes all the sessions of the given panel user.
+func (store *MemSessionStore) DeleteUserSessions(username string) error {
+	// the public sessions have no username.
+	if username == "" {
+		return nil
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for handle, session := range store.sessions {
+		if session.Username == username {
+			delete(store.sessions, handle)
+		}
+	}
 	return nil
 }
 
@@ -122,9 +239,9 @@ func (store *MemSessionStore) CleanupExpiredSessions() error {
 	defer store.mu.Unlock()
 
 	now := time.Now()
-	for id, session := range store.sessions {
+	for handle, session := range store.sessions {
 		if now.After(session.ExpiresAt) {
-			delete(store.sessions, id)
+			delete(store.sessions, handle)
 		}
 	}
 
@@ -133,6 +250,40 @@ func (store *MemSessionStore) CleanupExpiredSessions() error {
 
 // periodicCleanup runs CleanupExpiredSessions at regular intervals.
 func (store *MemSessionStore) periodicCleanup() {
+	cleanupPeriodically(store)
+}
+
+// newSession returns the session to be stored for the given session id, that expires at the SessionExpiresAt.
+func newSession(id string, session Session) Session {
+	now := time.Now()
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = now.UTC()
+	}
+	session.ExpiresAt = SessionExpiresAt(session.CreatedAt, now)
+	session.Handle = SessionHandle(id)
+	return session
+}
+
+// userSessions returns the unexpired sessions of the given panel user from the handle to session map,
+// the oldest first.
+func userSessions(sessions map[string]Session, username string) []Session {
+	now := time.Now()
+	var result []Session
+	for handle, session := range sessions {
+		if session.Username != username || username == "" || now.After(session.ExpiresAt) {
+			continue
+		}
+		session.Handle = handle
+		result = append(result, session)
+	}
+	slices.SortFunc(result, func(a, b Session) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return result
+}
+
+// cleanupPeriodically runs the CleanupExpiredSessions of the given store at regular intervals forever.
+func cleanupPeriodically(store SessionStore) {
 	// Interval is fourth of the configured session duration.
 	var ticker *time.Ticker
 	if *config.SessionDuration < 4 {
@@ -145,7 +296,7 @@ func (store *MemSessionStore) periodicCleanup() {
 	for {
 		<-ticker.C
 		if err := store.CleanupExpiredSessions(); err != nil {
-			log.Println("ERROR: Cleaning expired session gone wrong.")
+			log.Println("ERROR: Cleaning expired session gone wrong.", err)
 			continue
 		}
 	}
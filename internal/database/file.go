@@ -0,0 +1,78 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// readJSONFile decodes the JSON file with the given name into v.
+// Returns false without error if the file doesn't exist yet.
+func readJSONFile(name string, v any) (bool, error) {
+	b, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(b, v)
+}
+
+// writeJSONFile encodes v into the file with the given name and permissions with the ReplaceFile.
+func writeJSONFile(name string, v any, perm fs.FileMode) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ReplaceFile(name, b, perm)
+}
+
+// ReplaceFile writes the data into the file with the given name and permissions. The file is written
+// to a temporary file in the same directory first and renamed into place, so the readers never
+// see a half written file even if the process is killed in the middle.
+func ReplaceFile(name string, data []byte, perm fs.FileMode) error {
+	tmp, err := StageFile(name, data, perm)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// StageFile writes the data with the given permissions into a new temporary file next to dst and flushes
+// it to the disk, so it can be renamed over dst later. The temporary file keeps the extension of dst,
+// e.g. for v2ray to recognize the ".json". Returns the temporary file path.
+func StageFile(dst string, data []byte, perm fs.FileMode) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+"-*"+filepath.Ext(dst))
+	if err != nil {
+		return "", err
+	}
+	name := f.Name()
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(name)
+		return "", err
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		os.Remove(name)
+		return "", err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(name)
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(name)
+		return "", err
+	}
+	return name, nil
+}
@@ -0,0 +1,204 @@
+package data
+
+import (
+	"maps"
+	"sync"
+	"time"
+)
+
+// FileSessionStore is a SessionStore that keeps the sessions in a JSON file, so the logged in
+// users stay logged in after the restarts. The file is rewritten on every change of the logged in
+// sessions, the public sessions of the login form are kept in memory only, so that the anonymous
+// requests can't make the panel write the file.
+// CAUTION: only the handles(hashes) of the session ids are stored, so a leaked session file can't
+// be used to take over the sessions.
+type FileSessionStore struct {
+	path string
+	mu   sync.RWMutex
+	file sessionFile
+}
+
+// sessionFile is the content of the session file.
+type sessionFile struct {
+	Sessions map[string]Session `json:"sessions"` // session handle to the session.
+}
+
+// NewFileSessionStore loads the sessions from the JSON file with the given path, dropping the
+// ones that expired while the server was down. The file is created if it doesn't exist.
+func NewFileSessionStore(path string) (*FileSessionStore, error) {
+	store := &FileSessionStore{path: path}
+	if _, err := readJSONFile(path, &store.file); err != nil {
+		return nil, err
+	}
+	if store.file.Sessions == nil {
+		store.file.Sessions = make(map[string]Session)
+	}
+	for handle, session := range store.file.Sessions {
+		session.Handle = handle
+		store.file.Sessions[handle] = session
+	}
+	if err := store.CleanupExpiredSessions(); err != nil {
+		return nil, err
+	}
+
+	// Start the cleanup goroutine
+	go cleanupPeriodically(store)
+
+	return store, nil
+}
+
+// CreateSession creates a new session.
+func (store *FileSessionStore) CreateSession(id string, session Session) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	// NOTE: always overwrite the existing session.
+	return store.put(SessionHandle(id), newSession(id, session))
+}
+
+// GetSession retrieves a session by ID returning error if the session is invalid or expired.
+// The expired sessions are left for the CleanupExpiredSessions.
+func (store *FileSessionStore) GetSession(id string) (Session, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	session, exists := store.file.Sessions[SessionHandle(id)]
+	if !exists {
+		return Session{}, ErrSessionNotFound
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return Session{}, ErrSessionExpired
+	}
+	return session, nil
+}
+
+// TouchSession slides the idle timeout of a session by ID returning error if the session is invalid or expired.
+// NOTE: the utils.SessionRefresh only touches the sessions that move by a minute or more, so the file isn't
+// rewritten on every request.
+func (store *FileSessionStore) TouchSession(id string) (Session, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	handle := SessionHandle(id)
+	session, exists := store.file.Sessions[handle]
+	if !exists {
+		return Session{}, ErrSessionNotFound
+	}
+	now := time.Now()
+	if now.After(session.ExpiresAt) {
+		return Session{}, ErrSessionExpired
+	}
+
+	session.ExpiresAt = SessionExpiresAt(session.CreatedAt, now)
+	if err := store.put(handle, session); err != nil {
+		return Session{}, err
+	}
+	return session, nil
+}
+
+// DeleteSession removes a session by ID.
+func (store *FileSessionStore) DeleteSession(id string) error {
+	return store.DeleteSessionHandle(SessionHandle(id))
+}
+
+// ListSessions returns the unexpired sessions of the given panel user.
+func (store *FileSessionStore) ListSessions(username string) ([]Session, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	return userSessions(store.file.Sessions, username), nil
+}
+
+// DeleteSessionHandle removes a session by its handle.
+func (store *FileSessionStore) DeleteSessionHandle(handle string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	session, exists := store.file.Sessions[handle]
+	if !exists {
+		return ErrSessionNotFound
+	}
+	if session.Public() {
+		delete(store.file.Sessions, handle)
+		return nil
+	}
+
+	file := store.clone()
+	delete(file.Sessions, handle)
+	return store.save(file)
+}
+
+// DeleteUserSessions removes all the sessions of the given panel user.
+func (store *FileSessionStore) DeleteUserSessions(username string) error {
+	// the public sessions have no username.
+	if username == "" {
+		return nil
+	}
+	return store.deleteFunc(func(session Session) bool {
+		return session.Username == username
+	})
+}
+
+// CleanupExpiredSessions removes all expired sessions.
+func (store *FileSessionStore) CleanupExpiredSessions() error {
+	now := time.Now()
+	return store.deleteFunc(func(session Session) bool {
+		return now.After(session.ExpiresAt)
+	})
+}
+
+// deleteFunc removes the sessions that del returns true, the file is only rewritten if there's any
+// logged in session among them.
+func (store *FileSessionStore) deleteFunc(del func(Session) bool) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	file := store.clone()
+	private := false
+	maps.DeleteFunc(file.Sessions, func(_ string, session Session) bool {
+		if !del(session) {
+			return false
+		}
+		private = private || !session.Public()
+		return true
+	})
+	if !private {
+		store.file = file
+		return nil
+	}
+	return store.save(file)
+}
+
+// put keeps the session with the given handle. The file is only rewritten if it's a logged in session
+// or it replaces one, e.g. the logout doesn't leave the logged in session in the file.
+// The caller must hold the lock.
+func (store *FileSessionStore) put(handle string, session Session) error {
+	if old, exists := store.file.Sessions[handle]; session.Public() && (!exists || old.Public()) {
+		store.file.Sessions[handle] = session
+		return nil
+	}
+	file := store.clone()
+	file.Sessions[handle] = session
+	return store.save(file)
+}
+
+// clone returns a copy of the sessions to be modified, so the sessions in memory stay the same
+// if writing the file fails. The caller must hold the lock.
+func (store *FileSessionStore) clone() sessionFile {
+	return sessionFile{
+		Sessions: maps.Clone(store.file.Sessions),
+	}
+}
+
+// save writes the logged in sessions of the given sessions to the file and then keeps all of them in memory.
+// The caller must hold the lock.
+func (store *FileSessionStore) save(file sessionFile) error {
+	private := sessionFile{Sessions: maps.Clone(file.Sessions)}
+	maps.DeleteFunc(private.Sessions, func(_ string, session Session) bool {
+		return session.Public()
+	})
+	if err := writeJSONFile(store.path, private, 0600); err != nil {
+		return err
+	}
+	store.file = file
+	return nil
+}
@@ -0,0 +1,162 @@
+package data
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// LockoutUser is the kind of the lockouts of the panel usernames.
+	LockoutUser string = "user"
+
+	// LockoutIP is the kind of the lockouts of the IP addresses.
+	LockoutIP string = "ip"
+)
+
+var ErrLockoutNotFound = errors.New("Lockout not found.")
+
+// Lockout is the failed authentications of a panel username or an IP address, which is locked out
+// from logging in until LockedUntil.
+type Lockout struct {
+	Key         string    `json:"key"` // the kind and the subject seperated by colon(:), e.g. "ip:192.0.2.1"
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"lastFailure"`
+	LockedUntil time.Time `json:"lockedUntil"` // zero if it hasn't been locked out yet.
+}
+
+// LockoutKey returns the key of the lockout of the given kind and subject.
+func LockoutKey(kind, subject string) string {
+	return kind + ":" + subject
+}
+
+// Kind returns the kind of the lockout, LockoutUser or LockoutIP.
+func (l Lockout) Kind() string {
+	kind, _, _ := strings.Cut(l.Key, ":")
+	return kind
+}
+
+// Subject returns the panel username or the IP address of the lockout.
+func (l Lockout) Subject() string {
+	_, subject, _ := strings.Cut(l.Key, ":")
+	return subject
+}
+
+// LockedAt reports whether it's locked out at the given time.
+func (l Lockout) LockedAt(now time.Time) bool {
+	return now.Before(l.LockedUntil)
+}
+
+// LockoutStore defines the methods required for keeping the failed authentications.
+type LockoutStore interface {
+	// GetLockout returns the lockout with the given key, false if there's no failure recorded.
+	GetLockout(key string) (Lockout, bool)
+
+	// SetLockout creates or replaces the lockout with its key.
+	SetLockout(lockout Lockout) error
+
+	// DeleteLockout removes the lockout with the given key, forgetting its failures.
+	DeleteLockout(key string) error
+
+	// ListLockouts returns all the lockouts, the latest failure first.
+	ListLockouts() ([]Lockout, error)
+
+	// DeleteLockoutsBefore removes the lockouts that aren't locked out anymore and have the last failure
+	// before the given time.
+	DeleteLockoutsBefore(before time.Time) error
+}
+
+// FileLockoutStore is a LockoutStore that keeps the lockouts in a JSON file, so that they survive the restarts.
+type FileLockoutStore struct {
+	path     string
+	mu       sync.RWMutex
+	lockouts map[string]Lockout
+}
+
+// NewFileLockoutStore loads the lockouts from the JSON file with the given path.
+// The file is created when the first failure is recorded.
+func NewFileLockoutStore(path string) (*FileLockoutStore, error) {
+	var lockouts []Lockout
+	if _, err := readJSONFile(path, &lockouts); err != nil {
+		return nil, err
+	}
+	store := &FileLockoutStore{path: path, lockouts: make(map[string]Lockout, len(lockouts))}
+	for _, lockout := range lockouts {
+		store.lockouts[lockout.Key] = lockout
+	}
+	return store, nil
+}
+
+// GetLockout returns the lockout with the given key.
+func (store *FileLockoutStore) GetLockout(key string) (Lockout, bool) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	lockout, ok := store.lockouts[key]
+	return lockout, ok
+}
+
+// SetLockout creates or replaces the lockout with its key.
+func (store *FileLockoutStore) SetLockout(lockout Lockout) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	lockouts := maps.Clone(store.lockouts)
+	lockouts[lockout.Key] = lockout
+	return store.save(lockouts)
+}
+
+// DeleteLockout removes the lockout with the given key.
+func (store *FileLockoutStore) DeleteLockout(key string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.lockouts[key]; !ok {
+		return ErrLockoutNotFound
+	}
+	lockouts := maps.Clone(store.lockouts)
+	delete(lockouts, key)
+	return store.save(lockouts)
+}
+
+// ListLockouts returns all the lockouts, the latest failure first.
+func (store *FileLockoutStore) ListLockouts() ([]Lockout, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	return sortLockouts(store.lockouts), nil
+}
+
+// DeleteLockoutsBefore removes the lockouts that have expired and have the last failure before the given time.
+func (store *FileLockoutStore) DeleteLockoutsBefore(before time.Time) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := time.Now()
+	lockouts := maps.Clone(store.lockouts)
+	maps.DeleteFunc(lockouts, func(_ string, l Lockout) bool {
+		return !l.LockedAt(now) && l.LastFailure.Before(before)
+	})
+	if len(lockouts) == len(store.lockouts) {
+		return nil
+	}
+	return store.save(lockouts)
+}
+
+// save writes the lockouts to the file and replaces the ones in memory only if it succeeds.
+// CAUTION: the caller should hold the lock.
+func (store *FileLockoutStore) save(lockouts map[string]Lockout) error {
+	if err := writeJSONFile(store.path, sortLockouts(lockouts), 0600); err != nil {
+		return err
+	}
+	store.lockouts = lockouts
+	return nil
+}
+
+// sortLockouts returns the lockouts with the latest failure first.
+func sortLockouts(lockouts map[string]Lockout) []Lockout {
+	return slices.SortedFunc(maps.Values(lockouts), func(a, b Lockout) int {
+		return b.LastFailure.Compare(a.LastFailure)
+	})
+}
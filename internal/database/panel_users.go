@@ -0,0 +1,409 @@
+package data
+
+import (
+	"crypto/subtle"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Role is what a panel user is allowed to do. Each role is allowed to do what the lower ones can.
+type Role string
+
+const (
+	// RoleViewer can view the clients and get their links and QR codes.
+	RoleViewer Role = "viewer"
+
+	// RoleOperator can also create, edit and delete the clients and restart the v2ray server.
+	RoleOperator Role = "operator"
+
+	// RoleAdmin can also manage the panel users and the API tokens.
+	RoleAdmin Role = "admin"
+)
+
+// Roles are all the roles from the lowest to the highest.
+var Roles = []Role{RoleViewer, RoleOperator, RoleAdmin}
+
+var (
+	ErrPanelUserNotFound = errors.New("Panel user not found.")
+	ErrPanelUserExists   = errors.New("Panel user already exists.")
+	ErrInvalidPanelUser  = errors.New("Invalid panel username.")
+	ErrInvalidRole       = errors.New("Invalid panel user role.")
+	ErrLastPanelUser     = errors.New("The last active admin can't be disabled, deleted or demoted.")
+	ErrTOTPReplayed      = errors.New("TOTP code is already used.")
+	ErrRecoveryCode      = errors.New("Invalid recovery code.")
+	ErrPasskeyNotFound   = errors.New("Passkey not found.")
+	ErrPasskeyExists     = errors.New("Passkey is already registered.")
+)
+
+// Allows reports whether the role is allowed to do what the given role can, false for the unknown roles.
+func (role Role) Allows(need Role) bool {
+	have := slices.Index(Roles, role)
+	return have >= 0 && have >= slices.Index(Roles, need)
+}
+
+// PanelUser is a user that can log into the panel.
+// Only the password hash is stored, see utils.HashPassword.
+type PanelUser struct {
+	Username  string    `json:"username"`
+	Hash      string    `json:"hash"`
+	Role      Role      `json:"role"`
+	Disabled  bool      `json:"disabled"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	// TOTPSecret is the base32 encoded secret of the two-factor authentication, empty if it's not enabled.
+	// CAUTION: the secret itself is stored as it's needed to verify the codes, keep the file private.
+	TOTPSecret string `json:"totpSecret,omitempty"`
+	// TOTPStep is the time step of the last used TOTP code, so that the codes can't be replayed.
+	TOTPStep int64 `json:"totpStep,omitempty"`
+	// RecoveryCodes are the hashes of the unused one-time recovery codes, see utils.HashRecoveryCode.
+	RecoveryCodes []string `json:"recoveryCodes,omitempty"`
+
+	// Passkeys are the WebAuthn credentials of the panel user, see webauthn.RelyingParty.
+	Passkeys []Passkey `json:"passkeys,omitempty"`
+}
+
+// Passkey is a WebAuthn credential of a panel user.
+type Passkey struct {
+	Id         string    `json:"id"` // the unpadded base64url encoded credential ID.
+	Name       string    `json:"name"`
+	PublicKey  []byte    `json:"publicKey"` // the CBOR encoded COSE_Key.
+	SignCount  uint32    `json:"signCount"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt,omitempty"`
+}
+
+// TOTPEnabled reports whether the panel user has enabled the two-factor authentication.
+func (u PanelUser) TOTPEnabled() bool {
+	return u.TOTPSecret != ""
+}
+
+// SecondFactor reports whether the panel user has to pass a second step after the password check of the login.
+func (u PanelUser) SecondFactor() bool {
+	return u.TOTPEnabled() || len(u.Passkeys) > 0
+}
+
+// PanelUserStore defines the methods required for panel user management.
+// The changes take effect on the next request, so no restart is needed.
+type PanelUserStore interface {
+	// GetUser returns the panel user with the given username.
+	GetUser(username string) (PanelUser, error)
+
+	// ListUsers returns all the panel users including the disabled ones.
+	ListUsers() ([]PanelUser, error)
+
+	// CreateUser creates a new panel user with the given password hash and role.
+	CreateUser(username, hash string, role Role) (PanelUser, error)
+
+	// SetPassword replaces the password hash of the panel user.
+	SetPassword(username, hash string) error
+
+	// SetRole changes the role of the panel user.
+	SetRole(username string, role Role) error
+
+	// SetTOTP enables the two-factor authentication of the panel user with the secret and the hashes
+	// of the recovery codes, replacing the old ones. An empty secret disables it.
+	SetTOTP(username, secret string, recoveryCodes []string) error
+
+	// UseTOTPStep records the time step of the TOTP code that is just used, returning ErrTOTPReplayed
+	// if the code of the same or a later step is used already.
+	UseTOTPStep(username string, step int64) error
+
+	// UseRecoveryCode removes the recovery code with the given hash, returning ErrRecoveryCode if there's no such code.
+	UseRecoveryCode(username, hash string) error
+
+	// AddPasskey adds the passkey to the panel user, returning ErrPasskeyExists if the credential ID is
+	// registered already by any panel user.
+	AddPasskey(username string, passkey Passkey) error
+
+	// FindPasskey returns the panel user with the passkey of the given credential ID.
+	FindPasskey(id string) (PanelUser, Passkey, error)
+
+	// UsePasskey records the use of the passkey of the panel user with the new sign count.
+	UsePasskey(username, id string, signCount uint32) error
+
+	// DeletePasskey removes the passkey of the panel user.
+	DeletePasskey(username, id string) error
+
+	// SetDisabled disables or enables the panel user. The disabled users can't log in.
+	SetDisabled(username string, disabled bool) error
+
+	// DeleteUser deletes the panel user.
+	DeleteUser(username string) error
+}
+
+// FilePanelUserStore is a PanelUserStore that keeps the panel users in a JSON file.
+type FilePanelUserStore struct {
+	path  string
+	mu    sync.RWMutex
+	users []PanelUser
+}
+
+// NewFilePanelUserStore loads the panel users from the JSON file with the given path.
+// If the file doesn't exist yet, it is created with the seed users which maps each username
+// to the password hash, e.g. the ones from the -admins flag. The seed users are admins.
+func NewFilePanelUserStore(path string, seed func() map[string]string) (*FilePanelUserStore, error) {
+	store := &FilePanelUserStore{path: path}
+	exists, err := readJSONFile(path, &store.users)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		// NOTE: the users saved before the roles could do everything, so they are kept as admins.
+		for i := range store.users {
+			if store.users[i].Role == "" {
+				store.users[i].Role = RoleAdmin
+			}
+		}
+		return store, nil
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for username, hash := range seed() {
+		store.users = append(store.users, PanelUser{Username: username, Hash: hash, Role: RoleAdmin, CreatedAt: now})
+	}
+	slices.SortFunc(store.users, func(a, b PanelUser) int { return strings.Compare(a.Username, b.Username) })
+	if err := writeJSONFile(path, store.users, 0600); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// GetUser returns the panel user with the given username, ErrPanelUserNotFound if there's no such user.
+func (store *FilePanelUserStore) GetUser(username string) (PanelUser, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	index := store.index(username)
+	if index < 0 {
+		return PanelUser{}, ErrPanelUserNotFound
+	}
+	return store.users[index], nil
+}
+
+// ListUsers returns all the panel users in the order of their usernames.
+func (store *FilePanelUserStore) ListUsers() ([]PanelUser, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	return slices.Clone(store.users), nil
+}
+
+// CreateUser creates a new panel user. The username can't contain the tilde(~), comma(,) or spaces
+// so that it can still be given with the -admins flag.
+func (store *FilePanelUserStore) CreateUser(username, hash string, role Role) (PanelUser, error) {
+	if username == "" || strings.ContainsAny(username, "~, \t\r\n") {
+		return PanelUser{}, ErrInvalidPanelUser
+	}
+	if !slices.Contains(Roles, role) {
+		return PanelUser{}, ErrInvalidRole
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if store.index(username) >= 0 {
+		return PanelUser{}, ErrPanelUserExists
+	}
+
+	user := PanelUser{Username: username, Hash: hash, Role: role, CreatedAt: time.Now().UTC().Truncate(time.Second)}
+	users := append(slices.Clone(store.users), user)
+	slices.SortFunc(users, func(a, b PanelUser) int { return strings.Compare(a.Username, b.Username) })
+	return user, store.save(users)
+}
+
+// SetPassword replaces the password hash of the panel user.
+func (store *FilePanelUserStore) SetPassword(username, hash string) error {
+	return store.update(username, func(user *PanelUser) error {
+		user.Hash = hash
+		return nil
+	})
+}
+
+// SetTOTP enables the two-factor authentication of the panel user, or disables it with an empty secret.
+func (store *FilePanelUserStore) SetTOTP(username, secret string, recoveryCodes []string) error {
+	return store.update(username, func(user *PanelUser) error {
+		if secret != user.TOTPSecret {
+			user.TOTPStep = 0
+		}
+		user.TOTPSecret = secret
+		user.RecoveryCodes = nil
+		if secret != "" {
+			user.RecoveryCodes = slices.Clone(recoveryCodes)
+		}
+		return nil
+	})
+}
+
+// UseTOTPStep records the time step of the TOTP code that is just used.
+func (store *FilePanelUserStore) UseTOTPStep(username string, step int64) error {
+	return store.update(username, func(user *PanelUser) error {
+		if step <= user.TOTPStep {
+			return ErrTOTPReplayed
+		}
+		user.TOTPStep = step
+		return nil
+	})
+}
+
+// UseRecoveryCode removes the recovery code with the given hash so that it can't be used again.
+func (store *FilePanelUserStore) UseRecoveryCode(username, hash string) error {
+	return store.update(username, func(user *PanelUser) error {
+		index := slices.IndexFunc(user.RecoveryCodes, func(code string) bool {
+			return subtle.ConstantTimeCompare([]byte(code), []byte(hash)) == 1
+		})
+		if index < 0 {
+			return ErrRecoveryCode
+		}
+		user.RecoveryCodes = slices.Delete(slices.Clone(user.RecoveryCodes), index, index+1)
+		return nil
+	})
+}
+
+// AddPasskey adds the passkey to the panel user, the credential IDs are unique across the panel users.
+func (store *FilePanelUserStore) AddPasskey(username string, passkey Passkey) error {
+	if _, _, err := store.FindPasskey(passkey.Id); err == nil {
+		return ErrPasskeyExists
+	}
+	return store.update(username, func(user *PanelUser) error {
+		// NOTE: checked again with the lock held, as it's released after the FindPasskey.
+		for _, other := range store.users {
+			if slices.ContainsFunc(other.Passkeys, func(p Passkey) bool { return p.Id == passkey.Id }) {
+				return ErrPasskeyExists
+			}
+		}
+		if passkey.CreatedAt.IsZero() {
+			passkey.CreatedAt = time.Now().UTC().Truncate(time.Second)
+		}
+		user.Passkeys = append(slices.Clone(user.Passkeys), passkey)
+		return nil
+	})
+}
+
+// FindPasskey returns the panel user with the passkey of the given credential ID, ErrPasskeyNotFound if there's none.
+func (store *FilePanelUserStore) FindPasskey(id string) (PanelUser, Passkey, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	for _, user := range store.users {
+		for _, passkey := range user.Passkeys {
+			if passkey.Id == id {
+				return user, passkey, nil
+			}
+		}
+	}
+	return PanelUser{}, Passkey{}, ErrPasskeyNotFound
+}
+
+// UsePasskey records the use of the passkey with the new sign count of the authenticator.
+func (store *FilePanelUserStore) UsePasskey(username, id string, signCount uint32) error {
+	return store.update(username, func(user *PanelUser) error {
+		index := slices.IndexFunc(user.Passkeys, func(p Passkey) bool { return p.Id == id })
+		if index < 0 {
+			return ErrPasskeyNotFound
+		}
+		user.Passkeys = slices.Clone(user.Passkeys)
+		user.Passkeys[index].SignCount = signCount
+		user.Passkeys[index].LastUsedAt = time.Now().UTC().Truncate(time.Second)
+		return nil
+	})
+}
+
+// DeletePasskey removes the passkey of the panel user.
+func (store *FilePanelUserStore) DeletePasskey(username, id string) error {
+	return store.update(username, func(user *PanelUser) error {
+		index := slices.IndexFunc(user.Passkeys, func(p Passkey) bool { return p.Id == id })
+		if index < 0 {
+			return ErrPasskeyNotFound
+		}
+		user.Passkeys = slices.Delete(slices.Clone(user.Passkeys), index, index+1)
+		return nil
+	})
+}
+
+// SetRole changes the role of the panel user, returning ErrLastPanelUser if no active admin would be left.
+func (store *FilePanelUserStore) SetRole(username string, role Role) error {
+	if !slices.Contains(Roles, role) {
+		return ErrInvalidRole
+	}
+	return store.update(username, func(user *PanelUser) error {
+		if role != RoleAdmin && store.lastAdmin(*user) {
+			return ErrLastPanelUser
+		}
+		user.Role = role
+		return nil
+	})
+}
+
+// SetDisabled disables or enables the panel user, returning ErrLastPanelUser if no active admin would be left.
+func (store *FilePanelUserStore) SetDisabled(username string, disabled bool) error {
+	return store.update(username, func(user *PanelUser) error {
+		if disabled && store.lastAdmin(*user) {
+			return ErrLastPanelUser
+		}
+		user.Disabled = disabled
+		return nil
+	})
+}
+
+// DeleteUser deletes the panel user, returning ErrLastPanelUser if no active admin would be left.
+func (store *FilePanelUserStore) DeleteUser(username string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	index := store.index(username)
+	if index < 0 {
+		return ErrPanelUserNotFound
+	}
+	if store.lastAdmin(store.users[index]) {
+		return ErrLastPanelUser
+	}
+	return store.save(slices.Delete(slices.Clone(store.users), index, index+1))
+}
+
+// update applies the change to a copy of the panel user and saves it.
+func (store *FilePanelUserStore) update(username string, change func(user *PanelUser) error) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	index := store.index(username)
+	if index < 0 {
+		return ErrPanelUserNotFound
+	}
+	users := slices.Clone(store.users)
+	if err := change(&users[index]); err != nil {
+		return err
+	}
+	return store.save(users)
+}
+
+// save writes the users to the file and then keeps them in memory.
+// CAUTION: store.mu should be locked by the caller.
+func (store *FilePanelUserStore) save(users []PanelUser) error {
+	if err := writeJSONFile(store.path, users, 0600); err != nil {
+		return err
+	}
+	store.users = users
+	return nil
+}
+
+// index returns the index of the panel user with the given username, -1 if there's no such user.
+func (store *FilePanelUserStore) index(username string) int {
+	return slices.IndexFunc(store.users, func(u PanelUser) bool { return u.Username == username })
+}
+
+// lastAdmin reports whether the given panel user is the only active admin, so that the panel
+// can't be left without anyone to manage the panel users.
+// CAUTION: store.mu should be locked by the caller.
+func (store *FilePanelUserStore) lastAdmin(user PanelUser) bool {
+	if user.Disabled || user.Role != RoleAdmin {
+		return false
+	}
+	for _, other := range store.users {
+		if other.Username != user.Username && !other.Disabled && other.Role == RoleAdmin {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,260 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/htetmyatthar/server-manager/internal/config"
+)
+
+const (
+	// redisSessionPrefix is the prefix of the session keys, followed by the session handle.
+	redisSessionPrefix string = "server-manager:session:"
+
+	// redisUserPrefix is the prefix of the set keys, followed by the username, that index the
+	// session handles of each panel user.
+	redisUserPrefix string = "server-manager:user:"
+)
+
+// RedisSessionStore is a SessionStore that keeps the sessions in redis, so that the sessions
+// are shared between the panel instances behind a load balancer and survive the restarts.
+// The sessions are expired by redis itself with the key TTLs.
+// CAUTION: only the handles(hashes) of the session ids are used in the keys.
+type RedisSessionStore struct {
+	client *redisClient
+}
+
+// NewRedisSessionStore connects to the redis server on the given address, authenticating with
+// the password if it's not empty and selecting the db. Returns error if the server can't be reached.
+func NewRedisSessionStore(addr, password string, db int) (*RedisSessionStore, error) {
+	store := &RedisSessionStore{client: newRedisClient(addr, password, db)}
+	if _, err := store.do([]string{"PING"}); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// CreateSession creates a new session that expires by the redis key TTL.
+func (store *RedisSessionStore) CreateSession(id string, session Session) error {
+	session = newSession(id, session)
+	value, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	// NOTE: always overwrite the existing session.
+	commands := [][]string{{"SET", redisSessionPrefix + session.Handle, string(value), "PX", redisTTL(session.ExpiresAt)}}
+	if !session.Public() {
+		userKey := redisUserPrefix + session.Username
+		commands = append(commands, []string{"SADD", userKey, session.Handle})
+		commands = append(commands, redisUserExpire(userKey)...)
+	}
+	_, err = store.do(commands...)
+	return err
+}
+
+// TouchSession slides the idle timeout of a session by ID, by setting the TTL of its key.
+func (store *RedisSessionStore) TouchSession(id string) (Session, error) {
+	session, err := store.GetSession(id)
+	if err != nil {
+		return Session{}, err
+	}
+
+	session.ExpiresAt = SessionExpiresAt(session.CreatedAt, time.Now())
+	commands := [][]string{{"PEXPIRE", redisSessionPrefix + session.Handle, redisTTL(session.ExpiresAt)}}
+	if !session.Public() {
+		commands = append(commands, redisUserExpire(redisUserPrefix+session.Username)...)
+	}
+	replies, err := store.do(commands...)
+	if err != nil {
+		return Session{}, err
+	}
+	// the session is deleted after it is read.
+	if replies[0] == int64(0) {
+		return Session{}, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+// GetSession retrieves a session by ID returning ErrSessionNotFound if the session doesn't exist.
+// As redis removes the expired keys, the expired sessions are not found either.
+func (store *RedisSessionStore) GetSession(id string) (Session, error) {
+	return store.get(SessionHandle(id))
+}
+
+// DeleteSession removes a session by ID.
+func (store *RedisSessionStore) DeleteSession(id string) error {
+	return store.DeleteSessionHandle(SessionHandle(id))
+}
+
+// ListSessions returns the unexpired sessions of the given panel user. The handles of the expired
+// sessions are removed from the index of the user.
+func (store *RedisSessionStore) ListSessions(username string) ([]Session, error) {
+	if username == "" {
+		return nil, nil
+	}
+	handles, err := store.userHandles(username)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make(map[string]Session)
+	var stale []string
+	for _, handle := range handles {
+		session, err := store.get(handle)
+		switch err {
+		case nil:
+			sessions[handle] = session
+		case ErrSessionNotFound, ErrSessionExpired:
+			stale = append(stale, handle)
+		default:
+			return nil, err
+		}
+	}
+	if len(stale) > 0 {
+		if _, err := store.do(append([]string{"SREM", redisUserPrefix + username}, stale...)); err != nil {
+			return nil, err
+		}
+	}
+	return userSessions(sessions, username), nil
+}
+
+// DeleteSessionHandle removes a session by its handle.
+func (store *RedisSessionStore) DeleteSessionHandle(handle string) error {
+	session, err := store.get(handle)
+	if err != nil {
+		return err
+	}
+
+	commands := [][]string{{"DEL", redisSessionPrefix + handle}}
+	if !session.Public() {
+		commands = append(commands, []string{"SREM", redisUserPrefix + session.Username, handle})
+	}
+	replies, err := store.do(commands...)
+	if err != nil {
+		return err
+	}
+	if replies[0] == int64(0) {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// DeleteUserSessions removes all the sessions of the given panel user with its index.
+func (store *RedisSessionStore) DeleteUserSessions(username string) error {
+	// the public sessions have no username.
+	if username == "" {
+		return nil
+	}
+	handles, err := store.userHandles(username)
+	if err != nil {
+		return err
+	}
+
+	commands := [][]string{{"DEL", redisUserPrefix + username}}
+	for _, handle := range handles {
+		commands = append(commands, []string{"DEL", redisSessionPrefix + handle})
+	}
+	_, err = store.do(commands...)
+	return err
+}
+
+// CleanupExpiredSessions does nothing as redis removes the expired keys by itself.
+func (store *RedisSessionStore) CleanupExpiredSessions() error {
+	return nil
+}
+
+// get retrieves a session by its handle with the ExpiresAt from the key TTL.
+func (store *RedisSessionStore) get(handle string) (Session, error) {
+	key := redisSessionPrefix + handle
+	replies, err := store.do([]string{"GET", key}, []string{"PTTL", key})
+	if err != nil {
+		return Session{}, err
+	}
+	if replies[0] == nil {
+		return Session{}, ErrSessionNotFound
+	}
+
+	value, ok := replies[0].(string)
+	if !ok {
+		return Session{}, unexpectedReply(replies[0])
+	}
+	ttl, ok := replies[1].(int64)
+	if !ok {
+		return Session{}, unexpectedReply(replies[1])
+	}
+	// -2 means the key is expired between GET and PTTL, -1 means it has no TTL which never happens
+	// with the keys set by CreateSession.
+	if ttl == -2 {
+		return Session{}, ErrSessionExpired
+	}
+	if ttl < 0 {
+		return Session{}, ErrInvalidSession
+	}
+
+	var session Session
+	if err := json.Unmarshal([]byte(value), &session); err != nil {
+		return Session{}, ErrInvalidSession
+	}
+	session.Handle = handle
+	session.ExpiresAt = time.Now().Add(time.Duration(ttl) * time.Millisecond)
+	return session, nil
+}
+
+// redisTTL returns the TTL in milliseconds for the key that expires at the given time.
+// The TTL is at least 1 millisecond as redis rejects the non-positive ones.
+func redisTTL(expiresAt time.Time) string {
+	return strconv.FormatInt(max(time.Until(expiresAt).Milliseconds(), 1), 10)
+}
+
+// redisUserExpire returns the commands to set the TTL of the user index key, so the index lives as long
+// as any session of the user can live which is the maximum lifetime. The index is kept forever if there's
+// no maximum lifetime, and the handles of the expired sessions are removed by the ListSessions.
+func redisUserExpire(userKey string) [][]string {
+	if *config.SessionLifetime <= 0 {
+		return [][]string{{"PERSIST", userKey}}
+	}
+	ttl := time.Duration(*config.SessionLifetime) * time.Minute
+	return [][]string{{"PEXPIRE", userKey, strconv.FormatInt(ttl.Milliseconds(), 10)}}
+}
+
+// userHandles returns the session handles in the index of the given panel user.
+func (store *RedisSessionStore) userHandles(username string) ([]string, error) {
+	replies, err := store.do([]string{"SMEMBERS", redisUserPrefix + username})
+	if err != nil {
+		return nil, err
+	}
+	members, ok := replies[0].([]any)
+	if !ok {
+		return nil, unexpectedReply(replies[0])
+	}
+
+	handles := make([]string, 0, len(members))
+	for _, member := range members {
+		handle, ok := member.(string)
+		if !ok {
+			return nil, unexpectedReply(member)
+		}
+		handles = append(handles, handle)
+	}
+	return handles, nil
+}
+
+// do sends the given commands to redis, returning the first error reply as the error.
+func (store *RedisSessionStore) do(commands ...[]string) ([]any, error) {
+	replies, err := store.client.do(commands...)
+	if err != nil {
+		return nil, err
+	}
+	if err := replyError(replies...); err != nil {
+		return nil, err
+	}
+	return replies, nil
+}
+
+// unexpectedReply returns the error for the reply of the unexpected type.
+func unexpectedReply(reply any) error {
+	return fmt.Errorf("redis: unexpected reply %v(%T)", reply, reply)
+}
@@ -0,0 +1,258 @@
+package data
+
+import (
+	"errors"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/htetmyatthar/server-manager/internal/config"
+	"github.com/htetmyatthar/server-manager/test/mockredis"
+)
+
+// newTestRedisStore returns a RedisSessionStore connected to a mockredis server on a loopback listener,
+// which is closed at the end of the test.
+func newTestRedisStore(t *testing.T) (*RedisSessionStore, *mockredis.Server) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := mockredis.NewServer("secret")
+	go server.Serve(listener)
+	t.Cleanup(func() { listener.Close() })
+
+	store, err := NewRedisSessionStore(listener.Addr().String(), "secret", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, server
+}
+
+// setFlag sets the int flag for the test, restoring it at the end.
+func setFlag(t *testing.T, flag *int, value int) {
+	t.Helper()
+	old := *flag
+	*flag = value
+	t.Cleanup(func() { *flag = old })
+}
+
+func TestRedisSessionStoreWrongPassword(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go mockredis.NewServer("secret").Serve(listener)
+	defer listener.Close()
+
+	if _, err := NewRedisSessionStore(listener.Addr().String(), "wrong", 0); err == nil {
+		t.Fatal("connected with the wrong password")
+	}
+}
+
+func TestRedisSessionStoreCreateGet(t *testing.T) {
+	store, server := newTestRedisStore(t)
+	setFlag(t, config.SessionDuration, 10)
+
+	if err := store.CreateSession("private", Session{Username: "alice", IP: "192.0.2.1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateSession("public", Session{}); err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := store.GetSession("private")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Username != "alice" || session.IP != "192.0.2.1" || session.Handle != SessionHandle("private") {
+		t.Errorf("got %+v", session)
+	}
+	if ttl := time.Until(session.ExpiresAt); ttl < 9*time.Minute || ttl > 10*time.Minute {
+		t.Errorf("got the TTL of %v, want 10m", ttl)
+	}
+	if session.CreatedAt.IsZero() {
+		t.Error("CreatedAt is not set")
+	}
+
+	public, err := store.GetSession("public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !public.Public() {
+		t.Errorf("got %+v, want a public session", public)
+	}
+
+	if _, err := store.GetSession("missing"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("got %v, want ErrSessionNotFound", err)
+	}
+
+	// only the handles are kept in redis, and only the private sessions are indexed.
+	want := []string{
+		redisSessionPrefix + SessionHandle("private"),
+		redisSessionPrefix + SessionHandle("public"),
+		redisUserPrefix + "alice",
+	}
+	slices.Sort(want)
+	if keys := server.Keys(1); !slices.Equal(keys, want) {
+		t.Errorf("got the keys %v, want %v", keys, want)
+	}
+}
+
+func TestRedisSessionStoreTouch(t *testing.T) {
+	store, _ := newTestRedisStore(t)
+	setFlag(t, config.SessionDuration, 1)
+
+	if err := store.CreateSession("id", Session{Username: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	*config.SessionDuration = 10
+	touched, err := store.TouchSession("id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl := time.Until(touched.ExpiresAt); ttl < 9*time.Minute {
+		t.Errorf("got the TTL of %v after the touch, want 10m", ttl)
+	}
+
+	// the TTL of the key itself is slid.
+	session, err := store.GetSession("id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl := time.Until(session.ExpiresAt); ttl < 9*time.Minute {
+		t.Errorf("got the TTL of %v from redis after the touch, want 10m", ttl)
+	}
+
+	if _, err := store.TouchSession("missing"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("got %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestRedisSessionStoreDelete(t *testing.T) {
+	store, server := newTestRedisStore(t)
+
+	for _, id := range []string{"first", "second"} {
+		if err := store.CreateSession(id, Session{Username: "alice"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := store.DeleteSession("first"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetSession("first"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("got %v, want ErrSessionNotFound", err)
+	}
+	if err := store.DeleteSession("first"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("got %v deleting it again, want ErrSessionNotFound", err)
+	}
+
+	sessions, err := store.ListSessions("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].Handle != SessionHandle("second") {
+		t.Errorf("got %+v, want only the second session", sessions)
+	}
+
+	if err := store.DeleteSessionHandle(SessionHandle("second")); err != nil {
+		t.Fatal(err)
+	}
+	// redis removes the empty index of the user.
+	if keys := server.Keys(1); len(keys) != 0 {
+		t.Errorf("got the keys %v, want none", keys)
+	}
+}
+
+func TestRedisSessionStoreDeleteUserSessions(t *testing.T) {
+	store, server := newTestRedisStore(t)
+
+	sessions := map[string]string{"alice-1": "alice", "alice-2": "alice", "bob-1": "bob", "public": ""}
+	for id, username := range sessions {
+		if err := store.CreateSession(id, Session{Username: username}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := store.DeleteUserSessions("alice"); err != nil {
+		t.Fatal(err)
+	}
+	for id, username := range sessions {
+		_, err := store.GetSession(id)
+		if username == "alice" && !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("got %v for %s, want ErrSessionNotFound", err, id)
+		}
+		if username != "alice" && err != nil {
+			t.Errorf("got %v for %s, want it kept", err, id)
+		}
+	}
+	if alice, err := store.ListSessions("alice"); err != nil || len(alice) != 0 {
+		t.Errorf("got %+v, %v, want no sessions", alice, err)
+	}
+	if bob, err := store.ListSessions("bob"); err != nil || len(bob) != 1 {
+		t.Errorf("got %+v, %v, want the session of bob", bob, err)
+	}
+	if slices.Contains(server.Keys(1), redisUserPrefix+"alice") {
+		t.Error("the index of alice is kept")
+	}
+
+	// the public sessions have no username.
+	if err := store.DeleteUserSessions(""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetSession("public"); err != nil {
+		t.Errorf("got %v, want the public session kept", err)
+	}
+}
+
+func TestRedisSessionStoreExpiry(t *testing.T) {
+	store, server := newTestRedisStore(t)
+	setFlag(t, config.SessionDuration, 10)
+	setFlag(t, config.SessionLifetime, 60)
+
+	// the maximum lifetime of the session is almost over, so the key TTL is only a moment.
+	createdAt := time.Now().Add(-time.Hour + 100*time.Millisecond)
+	if err := store.CreateSession("expiring", Session{Username: "alice", CreatedAt: createdAt}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateSession("kept", Session{Username: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	session, err := store.GetSession("expiring")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl := time.Until(session.ExpiresAt); ttl > 100*time.Millisecond {
+		t.Errorf("got the TTL of %v, want it capped by the lifetime", ttl)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if _, err := store.GetSession("expiring"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("got %v, want ErrSessionNotFound", err)
+	}
+	if _, err := store.TouchSession("expiring"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("got %v touching it, want ErrSessionNotFound", err)
+	}
+
+	// the handle of the expired session is removed from the index of the user by the ListSessions.
+	sessions, err := store.ListSessions("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].Handle != SessionHandle("kept") {
+		t.Errorf("got %+v, want only the kept session", sessions)
+	}
+	handles, err := store.userHandles("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(handles, []string{SessionHandle("kept")}) {
+		t.Errorf("got the index %v, want only the kept session", handles)
+	}
+	if keys := server.Keys(1); slices.Contains(keys, redisSessionPrefix+SessionHandle("expiring")) {
+		t.Errorf("got the keys %v, want the expired one removed", keys)
+	}
+}
@@ -0,0 +1,217 @@
+package data
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// redisTimeout is the timeout of dialing and of every round trip to the redis server.
+const redisTimeout = 5 * time.Second
+
+// redisError is the error reply of the redis server, e.g. "WRONGTYPE ...".
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// redisClient is a minimal RESP(REdis Serialization Protocol) client with a small pool of connections.
+// It speaks only the parts of the protocol that the session store needs, so it works with any
+// server that speaks RESP2 like redis, valkey, or an in-process stand-in.
+type redisClient struct {
+	addr     string
+	password string
+	db       int
+
+	mu   sync.Mutex
+	idle []*redisConn
+}
+
+// redisConn is a single connection to the redis server.
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+// maxIdleRedisConns is the maximum number of the idle connections kept in the pool.
+const maxIdleRedisConns = 8
+
+// newRedisClient returns a client to the redis server on the given address, that authenticates
+// with the password if it's not empty and selects the db.
+func newRedisClient(addr, password string, db int) *redisClient {
+	return &redisClient{addr: addr, password: password, db: db}
+}
+
+// do sends the given commands in a single round trip(pipelining) and returns their replies.
+// The replies are either string, int64, nil, []any or redisError. The redisError replies are
+// returned as the replies not as the error, the error is only for the connection problems.
+func (c *redisClient) do(commands ...[]string) ([]any, error) {
+	conn, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+
+	replies, err := conn.roundTrip(commands...)
+	if err != nil {
+		// the connection state is unknown, don't reuse it.
+		conn.conn.Close()
+		return nil, err
+	}
+	c.put(conn)
+	return replies, nil
+}
+
+// get returns an idle connection or dials a new one.
+func (c *redisClient) get() (*redisConn, error) {
+	c.mu.Lock()
+	if n := len(c.idle); n > 0 {
+		conn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+		return conn, nil
+	}
+	c.mu.Unlock()
+
+	netConn, err := net.DialTimeout("tcp", c.addr, redisTimeout)
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{conn: netConn, r: bufio.NewReader(netConn), w: bufio.NewWriter(netConn)}
+
+	var setup [][]string
+	if c.password != "" {
+		setup = append(setup, []string{"AUTH", c.password})
+	}
+	if c.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(c.db)})
+	}
+	if len(setup) == 0 {
+		return conn, nil
+	}
+	replies, err := conn.roundTrip(setup...)
+	if err == nil {
+		err = replyError(replies...)
+	}
+	if err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// put returns the connection to the pool, closing it if the pool is full.
+func (c *redisClient) put(conn *redisConn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.idle) >= maxIdleRedisConns {
+		conn.conn.Close()
+		return
+	}
+	c.idle = append(c.idle, conn)
+}
+
+// roundTrip writes all the commands and then reads a reply for each of them.
+func (conn *redisConn) roundTrip(commands ...[]string) ([]any, error) {
+	if err := conn.conn.SetDeadline(time.Now().Add(redisTimeout)); err != nil {
+		return nil, err
+	}
+	for _, args := range commands {
+		// commands are sent as arrays of bulk strings.
+		fmt.Fprintf(conn.w, "*%d\r\n", len(args))
+		for _, arg := range args {
+			fmt.Fprintf(conn.w, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+	if err := conn.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	replies := make([]any, len(commands))
+	for i := range commands {
+		reply, err := conn.readReply()
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = reply
+	}
+	return replies, nil
+}
+
+// readReply reads a single RESP2 reply.
+func (conn *redisConn) readReply() (any, error) {
+	line, err := conn.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+': // simple string
+		return line[1:], nil
+	case '-': // error
+		return redisError(line[1:]), nil
+	case ':': // integer
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$': // bulk string, -1 is nil
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		b := make([]byte, n+2) // with the trailing CRLF
+		if _, err := io.ReadFull(conn.r, b); err != nil {
+			return nil, err
+		}
+		return string(b[:n]), nil
+	case '*': // array, -1 is nil
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		values := make([]any, n)
+		for i := range values {
+			if values[i], err = conn.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
+
+// readLine reads a line without the trailing CRLF.
+func (conn *redisConn) readLine() (string, error) {
+	line, err := conn.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("redis: malformed line %q", line)
+	}
+	return line[:len(line)-2], nil
+}
+
+// replyError returns the first redisError of the given replies if there's any.
+func replyError(replies ...any) error {
+	for _, reply := range replies {
+		if err, ok := reply.(redisError); ok {
+			return err
+		}
+	}
+	return nil
+}
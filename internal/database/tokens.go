@@ -0,0 +1,189 @@
+package data
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ScopeClientsRead allows listing and reading the clients.
+	ScopeClientsRead string = "clients:read"
+
+	// ScopeClientsWrite allows creating, updating, renewing and deleting the clients.
+	ScopeClientsWrite string = "clients:write"
+
+	// ScopeServerRestart allows restarting the v2ray server.
+	ScopeServerRestart string = "server:restart"
+
+	// tokenPrefix is the prefix of every API token, so the leaked ones are easy to spot.
+	tokenPrefix string = "lt_"
+)
+
+// Scopes are all the scopes that the API tokens can carry.
+var Scopes = []string{ScopeClientsRead, ScopeClientsWrite, ScopeServerRestart}
+
+var (
+	ErrInvalidToken  = errors.New("Invalid API token.")
+	ErrTokenNotFound = errors.New("API token not found.")
+	ErrTokenExpired  = errors.New("API token expired.")
+	ErrInvalidScope  = errors.New("Invalid API token scope.")
+)
+
+// APIToken is a long-lived token for the automations calling the JSON APIs.
+// Only the hash of the token is stored, the token itself is shown once when it is created.
+type APIToken struct {
+	Id        string    `json:"id"`
+	Name      string    `json:"name"`
+	Hash      string    `json:"hash"` // hex encoded sha-256 hash of the token.
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"` // zero means the token never expires.
+}
+
+// HasScope reports whether the token carries the given scope.
+func (t APIToken) HasScope(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+// ExpiredAt reports whether the token has expired at the given time.
+func (t APIToken) ExpiredAt(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && !now.Before(t.ExpiresAt)
+}
+
+// TokenStore defines the methods required for API token management.
+type TokenStore interface {
+	// CreateToken creates a new token with the given name and scopes that is valid until expiresAt,
+	// or forever if expiresAt is zero. Returns the token itself which can't be retrieved later.
+	CreateToken(name string, scopes []string, expiresAt time.Time) (string, APIToken, error)
+
+	// VerifyToken returns the stored token that matches the given token.
+	VerifyToken(token string) (APIToken, error)
+
+	// ListTokens returns all the tokens including the expired ones.
+	ListTokens() ([]APIToken, error)
+
+	// DeleteToken revokes the token with the given id.
+	DeleteToken(id string) error
+}
+
+// FileTokenStore is a TokenStore that keeps the tokens in a JSON file.
+type FileTokenStore struct {
+	path   string
+	mu     sync.RWMutex
+	tokens []APIToken
+}
+
+// NewFileTokenStore loads the tokens from the JSON file with the given path.
+// The file is created when the first token is created.
+func NewFileTokenStore(path string) (*FileTokenStore, error) {
+	store := &FileTokenStore{path: path}
+	if _, err := readJSONFile(path, &store.tokens); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// CreateToken creates a new token. The token is in the form of "lt_<id>.<secret>".
+func (store *FileTokenStore) CreateToken(name string, scopes []string, expiresAt time.Time) (string, APIToken, error) {
+	if len(scopes) == 0 {
+		return "", APIToken{}, ErrInvalidScope
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return "", APIToken{}, ErrInvalidScope
+		}
+	}
+
+	id := make([]byte, 6)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", APIToken{}, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", APIToken{}, err
+	}
+
+	token := APIToken{
+		Id:        hex.EncodeToString(id),
+		Name:      name,
+		Scopes:    slices.Compact(slices.Sorted(slices.Values(scopes))),
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+		ExpiresAt: expiresAt.UTC(),
+	}
+	value := tokenPrefix + token.Id + "." + base64.RawURLEncoding.EncodeToString(secret)
+	token.Hash = hashToken(value)
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	tokens := append(slices.Clone(store.tokens), token)
+	if err := writeJSONFile(store.path, tokens, 0600); err != nil {
+		return "", APIToken{}, err
+	}
+	store.tokens = tokens
+	return value, token, nil
+}
+
+// VerifyToken returns the stored token that matches the given token, ErrTokenExpired if it has expired.
+func (store *FileTokenStore) VerifyToken(value string) (APIToken, error) {
+	id, _, ok := strings.Cut(strings.TrimPrefix(value, tokenPrefix), ".")
+	if !ok || !strings.HasPrefix(value, tokenPrefix) {
+		return APIToken{}, ErrInvalidToken
+	}
+
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	for _, token := range store.tokens {
+		if token.Id != id {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(hashToken(value)), []byte(token.Hash)) != 1 {
+			return APIToken{}, ErrInvalidToken
+		}
+		if token.ExpiredAt(time.Now()) {
+			return APIToken{}, ErrTokenExpired
+		}
+		return token, nil
+	}
+	return APIToken{}, ErrInvalidToken
+}
+
+// ListTokens returns all the tokens in the order of their creation.
+func (store *FileTokenStore) ListTokens() ([]APIToken, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	return slices.Clone(store.tokens), nil
+}
+
+// DeleteToken revokes the token with the given id.
+func (store *FileTokenStore) DeleteToken(id string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	index := slices.IndexFunc(store.tokens, func(t APIToken) bool { return t.Id == id })
+	if index < 0 {
+		return ErrTokenNotFound
+	}
+	tokens := slices.Delete(slices.Clone(store.tokens), index, index+1)
+	if err := writeJSONFile(store.path, tokens, 0600); err != nil {
+		return err
+	}
+	store.tokens = tokens
+	return nil
+}
+
+// hashToken returns the hex encoded sha-256 hash of the token. The tokens have enough entropy
+// that a slow password hash is not needed.
+func hashToken(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,271 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// clockSkew is the difference of the clocks of the panel and the identity provider that is tolerated.
+	clockSkew time.Duration = time.Minute
+
+	// keysRefetchInterval is the minimum time between fetching the signing keys again for an unknown key id,
+	// so that the forged tokens can't make the panel hammer the identity provider.
+	keysRefetchInterval time.Duration = time.Minute
+
+	// minRSABits is the minimum size of the RSA signing keys that are accepted.
+	minRSABits int = 2048
+)
+
+// Claims are the claims of a verified ID token.
+type Claims map[string]any
+
+// String returns the string claim with the given name.
+func (c Claims) String(name string) (string, error) {
+	value, ok := c[name].(string)
+	if !ok || value == "" {
+		return "", fmt.Errorf("%w %s", ErrClaimNotAString, name)
+	}
+	return value, nil
+}
+
+// Strings returns the claim with the given name as a list, which is either a string or a list of strings,
+// e.g. the groups. The values that aren't strings are left out.
+func (c Claims) Strings(name string) []string {
+	switch value := c[name].(type) {
+	case string:
+		return []string{value}
+	case []any:
+		var result []string
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	default:
+		return nil
+	}
+}
+
+// keySet is the cached signing keys of the identity provider.
+type keySet struct {
+	keys    map[string]crypto.PublicKey // key id to the public key.
+	fetched time.Time
+}
+
+// jwk is a JSON web key of the JWKS document.
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// verify verifies the signature and the claims of the ID token, returning its claims.
+func (p *Provider) verify(ctx context.Context, d discovery, rawToken, nonce string) (Claims, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidIDToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	key, err := p.key(ctx, d, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	// NOTE: the algorithm has to match the type of the key, so that the "none" or the HMAC with the
+	// public key as the secret can't be used.
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if header.Alg != "RS256" {
+			return nil, ErrUnsupportedAlg
+		}
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) != nil {
+			return nil, ErrInvalidIDToken
+		}
+	case *ecdsa.PublicKey:
+		if header.Alg != "ES256" || len(signature) != 64 {
+			return nil, ErrUnsupportedAlg
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(key, digest[:], r, s) {
+			return nil, ErrInvalidIDToken
+		}
+	default:
+		return nil, ErrUnsupportedAlg
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if err := p.verifyClaims(d, claims, nonce); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// verifyClaims checks the issuer, audience, expiry and nonce of the ID token.
+func (p *Provider) verifyClaims(d discovery, claims Claims, nonce string) error {
+	if issuer, _ := claims.String("iss"); issuer != d.Issuer {
+		return fmt.Errorf("%w wrong issuer", ErrInvalidIDToken)
+	}
+
+	audience := claims.Strings("aud")
+	if !slices.Contains(audience, p.config.ClientID) {
+		return fmt.Errorf("%w wrong audience", ErrInvalidIDToken)
+	}
+	if party, ok := claims["azp"].(string); (len(audience) > 1 || ok) && party != p.config.ClientID {
+		return fmt.Errorf("%w wrong authorized party", ErrInvalidIDToken)
+	}
+
+	now := time.Now()
+	expiry, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(expiry), 0).Add(clockSkew)) {
+		return fmt.Errorf("%w expired", ErrInvalidIDToken)
+	}
+	if issuedAt, ok := claims["iat"].(float64); ok && time.Unix(int64(issuedAt), 0).After(now.Add(clockSkew)) {
+		return fmt.Errorf("%w issued in the future", ErrInvalidIDToken)
+	}
+
+	tokenNonce, _ := claims.String("nonce")
+	if subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(nonce)) != 1 {
+		return fmt.Errorf("%w wrong nonce", ErrInvalidIDToken)
+	}
+	return nil
+}
+
+// key returns the signing key with the key id, fetching the keys again if it's not known, e.g. after
+// the identity provider rotated its keys.
+func (p *Provider) key(ctx context.Context, d discovery, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys.lookup(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.keys.fetched) < keysRefetchInterval {
+		return nil, ErrUnknownKey
+	}
+
+	var document struct {
+		Keys []jwk `json:"keys"`
+	}
+	p.keys.fetched = time.Now()
+	if err := p.getJSON(ctx, d.JWKSURI, &document); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range document.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+	p.keys.keys = keys
+
+	if key, ok := p.keys.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// lookup returns the key with the key id, or the only key if the token has no key id.
+func (s keySet) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+// publicKey returns the RSA or the P-256 public key of the JSON web key.
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		modulus := new(big.Int).SetBytes(n)
+		exponent := new(big.Int).SetBytes(e)
+		if modulus.BitLen() < minRSABits || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, ErrUnsupportedAlg
+		}
+		return &rsa.PublicKey{N: modulus, E: int(exponent.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, ErrUnsupportedAlg
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		// NOTE: ecdh checks that the point is on the curve which ecdsa doesn't.
+		if len(x) != 32 || len(y) != 32 {
+			return nil, ErrUnsupportedAlg
+		}
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, ErrUnsupportedAlg
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, ErrUnsupportedAlg
+	}
+}
+
+// decodeSegment decodes the base64url encoded JSON segment of the token into v.
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return ErrInvalidIDToken
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return ErrInvalidIDToken
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+// Package oidc implements the relying party side of the OpenID Connect authorization code flow with
+// PKCE, which is all the panel needs to log the users in with an identity provider.
+// See https://openid.net/specs/openid-connect-core-1_0.html
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxResponseBytes is the maximum size of the responses of the identity provider that are read.
+	maxResponseBytes int64 = 1 << 20
+
+	// discoveryTTL is how long the discovery document is cached before it's fetched again.
+	discoveryTTL time.Duration = 24 * time.Hour
+)
+
+var (
+	ErrInvalidIssuer   = errors.New("OIDC issuer must be an https URL, or http on the loopback address.")
+	ErrDiscovery       = errors.New("Invalid OIDC discovery document.")
+	ErrTokenExchange   = errors.New("OIDC token exchange failed.")
+	ErrInvalidIDToken  = errors.New("Invalid OIDC ID token.")
+	ErrUnknownKey      = errors.New("OIDC signing key not found.")
+	ErrUnsupportedAlg  = errors.New("Unsupported OIDC signing algorithm.")
+	ErrClaimNotAString = errors.New("OIDC claim is missing or not a string.")
+)
+
+// Config is the registration of the panel at the identity provider.
+type Config struct {
+	Issuer       string // e.g. https://idp.example.com/realms/panel
+	ClientID     string
+	ClientSecret string   // empty for the public clients that only use the PKCE.
+	RedirectURL  string   // e.g. https://panel.example.com:8888/admin/login/oidc/callback
+	Scopes       []string // "openid" is always asked.
+}
+
+// Provider is an OpenID Connect identity provider. The discovery document and the signing keys are
+// fetched on the first use and cached, so that the panel starts even if the provider is down.
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mu         sync.Mutex
+	discovery  discovery
+	discovered time.Time
+	keys       keySet
+}
+
+// discovery is the part of the discovery document that the panel uses.
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Login is the state of an authorization request that has to be kept until the callback.
+type Login struct {
+	State    string // to match the callback to the request.
+	Nonce    string // to match the ID token to the request.
+	Verifier string // the PKCE code verifier, CAUTION: a secret.
+}
+
+// NewProvider returns the identity provider of the config.
+func NewProvider(config Config) (*Provider, error) {
+	issuer, err := url.Parse(config.Issuer)
+	if err != nil || issuer.Host == "" {
+		return nil, ErrInvalidIssuer
+	}
+	// NOTE: the plain http is allowed on the loopback for testing with a local identity provider.
+	if issuer.Scheme != "https" && !(issuer.Scheme == "http" && loopback(issuer.Hostname())) {
+		return nil, ErrInvalidIssuer
+	}
+	if config.ClientID == "" || config.RedirectURL == "" {
+		return nil, errors.New("OIDC client id and redirect URL are required.")
+	}
+	return &Provider{config: config, client: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+// NewLogin returns a new random state, nonce and PKCE code verifier of an authorization request.
+func NewLogin() (Login, error) {
+	var login Login
+	for _, value := range []*string{&login.State, &login.Nonce, &login.Verifier} {
+		random := make([]byte, 32)
+		if _, err := rand.Read(random); err != nil {
+			return Login{}, err
+		}
+		*value = base64.RawURLEncoding.EncodeToString(random)
+	}
+	return login, nil
+}
+
+// AuthURL returns the URL of the identity provider that the user is redirected to for logging in.
+func (p *Provider) AuthURL(ctx context.Context, login Login) (string, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(login.Verifier))
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", p.config.RedirectURL)
+	query.Set("scope", strings.Join(p.scopes(), " "))
+	query.Set("state", login.State)
+	query.Set("nonce", login.Nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return d.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange exchanges the authorization code of the callback with the PKCE code verifier of the login
+// for the ID token, and verifies it. Returns the claims of the ID token.
+func (p *Provider) Exchange(ctx context.Context, code string, login Login) (Claims, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("code_verifier", login.Verifier)
+	if p.config.ClientSecret == "" {
+		form.Set("client_id", p.config.ClientID)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	response, err := p.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(response.Body, maxResponseBytes)).Decode(&token); err != nil {
+		return nil, fmt.Errorf("%w %s", ErrTokenExchange, response.Status)
+	}
+	if response.StatusCode != http.StatusOK || token.IDToken == "" {
+		return nil, fmt.Errorf("%w %s %s %s", ErrTokenExchange, response.Status, token.Error, token.ErrorDescription)
+	}
+
+	return p.verify(ctx, d, token.IDToken, login.Nonce)
+}
+
+// scopes returns the scopes to be asked, always with the "openid".
+func (p *Provider) scopes() []string {
+	scopes := []string{"openid"}
+	for _, scope := range p.config.Scopes {
+		if scope != "" && scope != "openid" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// discover returns the cached discovery document, fetching it if it's not fetched yet or too old.
+func (p *Provider) discover(ctx context.Context) (discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.discovered.IsZero() && time.Since(p.discovered) < discoveryTTL {
+		return p.discovery, nil
+	}
+
+	var d discovery
+	err := p.getJSON(ctx, strings.TrimSuffix(p.config.Issuer, "/")+"/.well-known/openid-configuration", &d)
+	if err != nil {
+		return discovery{}, err
+	}
+	// the issuer has to be the exact one that is configured, so that the tokens of another issuer aren't trusted.
+	if d.Issuer != p.config.Issuer || d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return discovery{}, ErrDiscovery
+	}
+
+	p.discovery = d
+	p.discovered = time.Now()
+	return d, nil
+}
+
+// getJSON fetches the JSON document at the URL into v.
+func (p *Provider) getJSON(ctx context.Context, url string, v any) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+
+	response, err := p.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, response.Status)
+	}
+	return json.NewDecoder(io.LimitReader(response.Body, maxResponseBytes)).Decode(v)
+}
+
+// loopback reports whether the host is localhost or a loopback IP address.
+func loopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// object is a JSON object that keeps every member in the original order, so the hand-tuned
+// v2ray configs can be written back without dropping or reordering anything.
+type object []member
+
+// member is a single key-value pair of the object. The value is kept as it is.
+type member struct {
+	Key   string
+	Value json.RawMessage
+}
+
+// UnmarshalJSON decodes the JSON object member by member keeping their order.
+func (o *object) UnmarshalJSON(b []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return fmt.Errorf("expected a JSON object but got %v", token)
+	}
+
+	members := object{}
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := token.(string)
+		if !ok {
+			return fmt.Errorf("expected an object key but got %v", token)
+		}
+
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		members = append(members, member{Key: key, Value: value})
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	*o = members
+	return nil
+}
+
+// MarshalJSON encodes the members back in the same order.
+func (o object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := encode(m.Key, "")
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		if m.Value == nil {
+			buf.WriteString("null")
+		} else {
+			buf.Write(m.Value)
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// get returns the raw value of the given key, false if the key doesn't exist.
+func (o object) get(key string) (json.RawMessage, bool) {
+	for _, m := range o {
+		if m.Key == key {
+			return m.Value, true
+		}
+	}
+	return nil, false
+}
+
+// set replaces the value of the given key in place, or appends it if the key doesn't exist.
+func (o *object) set(key string, value any) error {
+	raw, err := encode(value, "")
+	if err != nil {
+		return err
+	}
+	for i := range *o {
+		if (*o)[i].Key == key {
+			(*o)[i].Value = raw
+			return nil
+		}
+	}
+	*o = append(*o, member{Key: key, Value: raw})
+	return nil
+}
+
+// merge sets every field that v is encoded into, leaving the other members untouched.
+// v should be encoded into a JSON object, e.g. a struct.
+func (o *object) merge(v any) error {
+	raw, err := encode(v, "")
+	if err != nil {
+		return err
+	}
+	var fields object
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return err
+	}
+	for _, field := range fields {
+		if err := o.set(field.Key, field.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeKey unmarshals the value of the given key into v. Returns error if the key doesn't exist.
+func (o object) decodeKey(key string, v any) error {
+	raw, ok := o.get(key)
+	if !ok {
+		return fmt.Errorf("missing '%s'", key)
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// encode is json.Marshal(or json.MarshalIndent if indent is not empty) without escaping the
+// HTML characters, so the values that are written back stay the same as they are read.
+func encode(v any, indent string) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if indent != "" {
+		enc.SetIndent("", indent)
+	}
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
@@ -0,0 +1,451 @@
+// This owns the v2ray config file and the users file, keeping the clients in both of them in sync.
+package repository
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/htetmyatthar/server-manager/internal/config"
+	"github.com/htetmyatthar/server-manager/internal/utils"
+)
+
+var (
+	ErrClientNotFound = errors.New("Client not found.")
+	ErrClientExists   = errors.New("Client with the same id already exists.")
+	ErrNoInbound      = errors.New("No inbound in the config file.")
+
+	// mu is process-wide so that the read-modify-write cycles of every repository
+	// can't interleave with each other.
+	mu sync.Mutex
+)
+
+// ClientRepository defines the methods required for managing the v2ray clients.
+type ClientRepository interface {
+	// List returns all the clients in the users file.
+	List() ([]utils.Client, error)
+
+	// Get returns the client with the given id. Returns ErrClientNotFound if there's none.
+	Get(id string) (utils.Client, error)
+
+	// Create adds the given client to the users file, and also to the v2ray inbound if the client is active.
+	// Returns ErrClientExists if there's already a client with the same id.
+	Create(client utils.Client) error
+
+	// Update replaces the client with the given id by the given client. The id itself
+	// can be changed as long as it doesn't collide with the other clients. The client is put into
+	// or taken out of the v2ray inbound according to its status.
+	// Returns ErrClientNotFound if there's no client with the given id.
+	Update(id string, client utils.Client) error
+
+	// Modify changes the client with the given id by the modify in the same transaction as reading it, so
+	// that the concurrent changes to the client can't be lost, returning the modified client. The client is
+	// kept if the modify returns an error, which is returned as is. The id itself can't be changed.
+	// Returns ErrClientNotFound if there's no client with the given id.
+	Modify(id string, modify func(client *utils.Client) error) (utils.Client, error)
+
+	// Delete removes the client with the given id from both files, returning the deleted client.
+	// If the confirm isn't nil, it's called with the client in the same transaction, and the client is
+	// kept if it returns an error, which is returned as is. Returns ErrClientNotFound if there's no
+	// client with the given id.
+	Delete(id string, confirm func(utils.Client) error) (utils.Client, error)
+
+	// SetStatus changes the status of the clients with the given ids in a single transaction,
+	// putting them into or taking them out of the v2ray inbound accordingly, which also brings the
+	// clients that are out of sync with the inbound back in line. Returns the changed clients, and
+	// the ids that aren't in the users file, which are skipped so that they can't hold up the others.
+	SetStatus(ids []string, status string) (changed []utils.Client, skipped []string, err error)
+
+	// Inbound returns the v2ray inbound that the clients are served on.
+	Inbound() (utils.Inbound, error)
+}
+
+// FileClientRepository is the ClientRepository that works directly on the configured
+// config.ConfigFile and config.UserFile. Every change is written with utils.ApplyConfig.
+type FileClientRepository struct{}
+
+// NewFileClientRepository initializes a new FileClientRepository.
+func NewFileClientRepository() *FileClientRepository {
+	return &FileClientRepository{}
+}
+
+// document is the loaded state of both files. Every JSON object that is touched is kept as an
+// object, so the members that the utils types don't know about and the key order survive the
+// round trip.
+type document struct {
+	config   object   // the whole v2ray config file
+	inbounds []object // "inbounds" of the config file
+	settings object   // "settings" of the first inbound
+	clients  []object // "clients" of the first inbound settings
+
+	userFile    object         // the whole users file
+	userObjects []object       // "clients" of the users file
+	users       []utils.Client // decoded userObjects
+
+	// whether the files ended with a new line when they are read.
+	configNewline bool
+	userNewline   bool
+}
+
+// List returns all the clients in the users file.
+func (repo *FileClientRepository) List() ([]utils.Client, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	doc, err := load()
+	if err != nil {
+		return nil, err
+	}
+	return doc.users, nil
+}
+
+// Get returns the client with the given id. Returns ErrClientNotFound if there's none.
+func (repo *FileClientRepository) Get(id string) (utils.Client, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	doc, err := load()
+	if err != nil {
+		return utils.Client{}, err
+	}
+	i := doc.userIndex(id)
+	if i < 0 {
+		return utils.Client{}, ErrClientNotFound
+	}
+	return doc.users[i], nil
+}
+
+// Create adds the given client to the users file, and also to the v2ray inbound if the client is active.
+func (repo *FileClientRepository) Create(client utils.Client) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	doc, err := load()
+	if err != nil {
+		return err
+	}
+	if doc.userIndex(client.Id) >= 0 || doc.inboundIndex(client.Id) >= 0 {
+		return ErrClientExists
+	}
+	if client.Status == "" {
+		client.Status = utils.ClientStatusActive
+	}
+
+	if err := doc.syncInbound(client.Id, client); err != nil {
+		return err
+	}
+	userObject := object{}
+	if err := userObject.merge(client); err != nil {
+		return err
+	}
+	doc.userObjects = append(doc.userObjects, userObject)
+	doc.users = append(doc.users, client)
+	return doc.save()
+}
+
+// Update replaces the client with the given id by the given client.
+func (repo *FileClientRepository) Update(id string, client utils.Client) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	doc, err := load()
+	if err != nil {
+		return err
+	}
+	userIndex, err := doc.find(id)
+	if err != nil {
+		return err
+	}
+	return doc.update(userIndex, id, client)
+}
+
+// Modify changes the client with the given id by the modify in the same transaction as reading it.
+func (repo *FileClientRepository) Modify(id string, modify func(client *utils.Client) error) (utils.Client, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	doc, err := load()
+	if err != nil {
+		return utils.Client{}, err
+	}
+	userIndex, err := doc.find(id)
+	if err != nil {
+		return utils.Client{}, err
+	}
+
+	client := doc.users[userIndex]
+	if err := modify(&client); err != nil {
+		return utils.Client{}, err
+	}
+	client.Id = id
+	if client.Status == "" {
+		client.Status = utils.ClientStatusActive
+	}
+	return client, doc.update(userIndex, id, client)
+}
+
+// Delete removes the client with the given id from both files, returning the deleted client.
+// The client is kept if the confirm returns an error.
+func (repo *FileClientRepository) Delete(id string, confirm func(utils.Client) error) (utils.Client, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	doc, err := load()
+	if err != nil {
+		return utils.Client{}, err
+	}
+	userIndex, err := doc.find(id)
+	if err != nil {
+		return utils.Client{}, err
+	}
+
+	deleted := doc.users[userIndex]
+	if confirm != nil {
+		if err := confirm(deleted); err != nil {
+			return utils.Client{}, err
+		}
+	}
+	if inboundIndex := doc.inboundIndex(id); inboundIndex >= 0 {
+		doc.clients = append(doc.clients[:inboundIndex], doc.clients[inboundIndex+1:]...)
+	}
+	doc.userObjects = append(doc.userObjects[:userIndex], doc.userObjects[userIndex+1:]...)
+	doc.users = append(doc.users[:userIndex], doc.users[userIndex+1:]...)
+	return deleted, doc.save()
+}
+
+// SetStatus changes the status of the clients with the given ids in a single transaction, skipping
+// the ids that aren't in the users file.
+func (repo *FileClientRepository) SetStatus(ids []string, status string) ([]utils.Client, []string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	doc, err := load()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	changed := make([]utils.Client, 0, len(ids))
+	var skipped []string
+	for _, id := range ids {
+		// NOTE: not doc.find, the active clients missing from the inbound are put back or left out by the syncInbound.
+		userIndex := doc.userIndex(id)
+		if userIndex < 0 {
+			skipped = append(skipped, id)
+			continue
+		}
+		client := doc.users[userIndex]
+		client.Status = status
+
+		if err := doc.syncInbound(id, client); err != nil {
+			return nil, nil, err
+		}
+		if err := doc.userObjects[userIndex].set("status", status); err != nil {
+			return nil, nil, err
+		}
+		doc.users[userIndex] = client
+		changed = append(changed, client)
+	}
+	if len(changed) == 0 {
+		return changed, skipped, nil
+	}
+	return changed, skipped, doc.save()
+}
+
+// Inbound returns the first inbound of the config file that the clients are served on.
+func (repo *FileClientRepository) Inbound() (utils.Inbound, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	doc, err := load()
+	if err != nil {
+		return utils.Inbound{}, err
+	}
+	raw, err := doc.inbounds[0].MarshalJSON()
+	if err != nil {
+		return utils.Inbound{}, err
+	}
+	var inbound utils.Inbound
+	if err := json.Unmarshal(raw, &inbound); err != nil {
+		return utils.Inbound{}, fmt.Errorf("unmarshalling inbound: %w", err)
+	}
+	return inbound, nil
+}
+
+// load reads and unmarshals both files.
+// CAUTION: the caller should hold the mu.
+func load() (*document, error) {
+	configData, err := os.ReadFile(*config.ConfigFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	userData, err := os.ReadFile(*config.UserFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading users file: %w", err)
+	}
+
+	doc := &document{
+		configNewline: bytes.HasSuffix(configData, []byte("\n")),
+		userNewline:   bytes.HasSuffix(userData, []byte("\n")),
+	}
+	if err := json.Unmarshal(configData, &doc.config); err != nil {
+		return nil, fmt.Errorf("unmarshalling config file: %w", err)
+	}
+	if err := doc.config.decodeKey("inbounds", &doc.inbounds); err != nil {
+		return nil, fmt.Errorf("unmarshalling 'inbounds': %w", err)
+	}
+	if len(doc.inbounds) == 0 {
+		return nil, ErrNoInbound
+	}
+	if err := doc.inbounds[0].decodeKey("settings", &doc.settings); err != nil {
+		return nil, fmt.Errorf("unmarshalling inbound 'settings': %w", err)
+	}
+	// an inbound without any client yet is fine.
+	if _, ok := doc.settings.get("clients"); ok {
+		if err := doc.settings.decodeKey("clients", &doc.clients); err != nil {
+			return nil, fmt.Errorf("unmarshalling inbound 'clients': %w", err)
+		}
+	}
+
+	if err := json.Unmarshal(userData, &doc.userFile); err != nil {
+		return nil, fmt.Errorf("unmarshalling users file: %w", err)
+	}
+	if _, ok := doc.userFile.get("clients"); ok {
+		if err := doc.userFile.decodeKey("clients", &doc.userObjects); err != nil {
+			return nil, fmt.Errorf("unmarshalling 'clients': %w", err)
+		}
+	}
+	doc.users = make([]utils.Client, len(doc.userObjects))
+	for i, userObject := range doc.userObjects {
+		raw, err := userObject.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(raw, &doc.users[i]); err != nil {
+			return nil, fmt.Errorf("unmarshalling 'clients': %w", err)
+		}
+	}
+	return doc, nil
+}
+
+// save puts the modified objects back in place and writes both files as one transaction.
+// CAUTION: the caller should hold the mu.
+func (doc *document) save() error {
+	if doc.clients == nil {
+		doc.clients = []object{}
+	}
+	if doc.userObjects == nil {
+		doc.userObjects = []object{}
+	}
+
+	if err := doc.settings.set("clients", doc.clients); err != nil {
+		return err
+	}
+	if err := doc.inbounds[0].set("settings", doc.settings); err != nil {
+		return err
+	}
+	if err := doc.config.set("inbounds", doc.inbounds); err != nil {
+		return err
+	}
+	if err := doc.userFile.set("clients", doc.userObjects); err != nil {
+		return err
+	}
+
+	finalConfigJSON, err := encode(doc.config, "  ")
+	if err != nil {
+		return err
+	}
+	if doc.configNewline {
+		finalConfigJSON = append(finalConfigJSON, '\n')
+	}
+	finalUserJSON, err := encode(doc.userFile, " ")
+	if err != nil {
+		return err
+	}
+	if doc.userNewline {
+		finalUserJSON = append(finalUserJSON, '\n')
+	}
+	return utils.ApplyConfig(finalConfigJSON, finalUserJSON)
+}
+
+// update replaces the client at the userIndex, which has the given id, by the given client.
+func (doc *document) update(userIndex int, id string, client utils.Client) error {
+	if client.Id != id && (doc.userIndex(client.Id) >= 0 || doc.inboundIndex(client.Id) >= 0) {
+		return ErrClientExists
+	}
+	if client.Status == "" {
+		client.Status = utils.ClientStatusActive
+	}
+
+	if err := doc.syncInbound(id, client); err != nil {
+		return err
+	}
+	if err := doc.userObjects[userIndex].merge(client); err != nil {
+		return err
+	}
+	doc.users[userIndex] = client
+	return doc.save()
+}
+
+// find returns the index of the client with the given id in the users file. Active clients should
+// also be in the v2ray inbound, otherwise the files are out of sync for that client.
+// Returns ErrClientNotFound if the client is missing from either of them.
+func (doc *document) find(id string) (int, error) {
+	userIndex := doc.userIndex(id)
+	if userIndex < 0 {
+		return -1, ErrClientNotFound
+	}
+	if doc.users[userIndex].Active() && doc.inboundIndex(id) < 0 {
+		return -1, ErrClientNotFound
+	}
+	return userIndex, nil
+}
+
+// syncInbound puts the given client into the v2ray inbound in place of the client with the given id
+// if the given client is active, or takes the client with the given id out of the inbound otherwise.
+// Only the known fields are replaced, e.g. "email" and "level" of the existing one are kept as they are.
+func (doc *document) syncInbound(id string, client utils.Client) error {
+	inboundIndex := doc.inboundIndex(id)
+	v2rayClient := utils.V2rayClient{Id: client.Id, AlterId: client.AlterId}
+
+	switch {
+	case client.Active() && inboundIndex >= 0:
+		return doc.clients[inboundIndex].merge(v2rayClient)
+	case client.Active():
+		newClient := object{}
+		if err := newClient.merge(v2rayClient); err != nil {
+			return err
+		}
+		doc.clients = append(doc.clients, newClient)
+	case inboundIndex >= 0:
+		doc.clients = append(doc.clients[:inboundIndex], doc.clients[inboundIndex+1:]...)
+	}
+	return nil
+}
+
+// userIndex returns the index of the client with the given id in the users file, -1 if there's none.
+func (doc *document) userIndex(id string) int {
+	for i, user := range doc.users {
+		if user.Id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// inboundIndex returns the index of the client with the given id in the v2ray inbound, -1 if there's none.
+func (doc *document) inboundIndex(id string) int {
+	for i, client := range doc.clients {
+		var v2rayClient utils.V2rayClient
+		raw, err := client.MarshalJSON()
+		if err != nil || json.Unmarshal(raw, &v2rayClient) != nil {
+			continue
+		}
+		if v2rayClient.Id == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,134 @@
+// This runs the background jobs that keep the v2ray inbound in line with the client dates.
+package scheduler
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/htetmyatthar/server-manager/internal/config"
+	"github.com/htetmyatthar/server-manager/internal/repository"
+	"github.com/htetmyatthar/server-manager/internal/utils"
+)
+
+// ClientScheduler activates the pending clients on their start dates and takes the expired
+// clients out of the v2ray inbound at every interval.
+type ClientScheduler struct {
+	clients  repository.ClientRepository
+	interval time.Duration
+
+	// activated and expired are the batches that are written but not applied to the v2ray server yet,
+	// as the restart has failed. The restart and their notifications are retried on the next run.
+	activated []utils.Client
+	expired   []utils.Client
+}
+
+// NewClientScheduler initializes a new ClientScheduler that checks the given clients at every interval.
+func NewClientScheduler(clients repository.ClientRepository, interval time.Duration) *ClientScheduler {
+	return &ClientScheduler{
+		clients:  clients,
+		interval: interval,
+	}
+}
+
+// Start runs the first check right away and then starts a goroutine to check at every interval.
+func (s *ClientScheduler) Start() {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			if err := s.Run(time.Now()); err != nil {
+				log.Println("ERROR: Scheduling the clients gone wrong.", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// Run brings every client to the status it should have at the given time as batches.
+//
+// 1. pending clients whose start date has come are put into the v2ray inbound.
+// 2. active or pending clients whose expire date has passed are taken out of the v2ray inbound,
+// keeping their records in the users file with utils.ClientStatusExpired.
+//
+// The v2ray server is validated and restarted once for all the batches, and a summary
+// notification is sent for each batch. If the restart fails, the written batches are restarted and notified
+// on the next run. Expired clients are never brought back, renewing them is up to the admins.
+func (s *ClientScheduler) Run(now time.Time) error {
+	clients, err := s.clients.List()
+	if err != nil {
+		return err
+	}
+
+	var activateIds, expireIds []string
+	for _, client := range clients {
+		if client.Status == utils.ClientStatusExpired {
+			continue
+		}
+		switch client.StatusAt(now) {
+		case utils.ClientStatusExpired:
+			expireIds = append(expireIds, client.Id)
+		case utils.ClientStatusActive:
+			if !client.Active() {
+				activateIds = append(activateIds, client.Id)
+			}
+		}
+	}
+
+	// utils.ApplyConfig validates the config before it's written. Each written batch is kept until the restart
+	// succeeds, so that the batch is still restarted and notified on the next run if the other one fails.
+	if len(activateIds) > 0 {
+		activated, skipped, err := s.clients.SetStatus(activateIds, utils.ClientStatusActive)
+		if err != nil {
+			return err
+		}
+		s.activated = append(s.activated, activated...)
+		logSkipped(skipped, "activating")
+	}
+	if len(expireIds) > 0 {
+		expired, skipped, err := s.clients.SetStatus(expireIds, utils.ClientStatusExpired)
+		if err != nil {
+			return err
+		}
+		s.expired = append(s.expired, expired...)
+		logSkipped(skipped, "expiring")
+	}
+	if len(s.activated) == 0 && len(s.expired) == 0 {
+		return nil
+	}
+	if err := utils.RestartService(); err != nil {
+		return err
+	}
+	log.Println("Scheduled clients are applied to the v2ray server. activated:", len(s.activated), "expired:", len(s.expired))
+
+	notify(s.activated, " users activated", " started on ", func(c utils.Client) string { return c.StartDate })
+	notify(s.expired, " users expired", " expired on ", func(c utils.Client) string { return c.ExpireDate })
+	s.activated, s.expired = nil, nil
+	return nil
+}
+
+// logSkipped logs the ids of the clients that are gone from the users file in the middle of the run.
+func logSkipped(ids []string, action string) {
+	if len(ids) > 0 {
+		log.Println("WARN: Skipped "+action+" the clients that aren't in the users file:", strings.Join(ids, ", "))
+	}
+}
+
+// notify sends a summary push notification of the given batch of clients, if there's any.
+func notify(clients []utils.Client, titleSuffix, verb string, date func(utils.Client) string) {
+	if len(clients) == 0 {
+		return
+	}
+
+	lines := make([]string, 0, len(clients))
+	for _, client := range clients {
+		lines = append(lines, client.Username+"@"+*config.WebHostIP+" with [["+client.Id+"]]"+verb+date(client))
+	}
+	title := *config.WebHost + " - " + strconv.Itoa(len(clients)) + titleSuffix
+	message := strings.Join(lines, "\n")
+	for _, key := range config.GotifyAPIKeys {
+		utils.SendNoti(*config.GotifyServer, key, title, message, 5)
+	}
+}
@@ -0,0 +1,214 @@
+package utils
+
+import (
+	"errors"
+	"log"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+
+	. "github.com/htetmyatthar/server-manager/internal/config"
+	. "github.com/htetmyatthar/server-manager/internal/database"
+)
+
+const (
+	// StrikeCSRF is the strike of an invalid CSRF token, see the BanCSRFFailures.
+	StrikeCSRF string = "csrf"
+
+	// StrikeLockout is the strike of a lockout caused by an IP address, see the BanLockouts.
+	StrikeLockout string = "lockout"
+
+	// banStrikeWindow is how long the strikes of an IP address are counted toward the ban.
+	banStrikeWindow time.Duration = time.Hour
+)
+
+// strike is the count of the strikes of a kind from an IP address since the first one in the window.
+type strike struct {
+	count int
+	since time.Time
+}
+
+// IPBanner guards the panel by the IP addresses. Only the addresses in the allowlist can open the admin
+// panel, and the banned ones can't open anything. The addresses are banned by the admins or automatically
+// after the repeated CSRF failures or lockouts in an hour.
+type IPBanner struct {
+	store   BanStore
+	allow   []netip.Prefix // empty to allow all.
+	mu      sync.Mutex
+	strikes map[string]strike // the kind and the prefix of the IP address to its strikes.
+}
+
+// NewIPBanner initializes a new IPBanner keeping the bans in the given store. The allow is the allowlist of
+// the IP addresses and CIDR ranges seperated by comma(,), empty to allow all.
+func NewIPBanner(store BanStore, allow string) (*IPBanner, error) {
+	prefixes, err := ParsePrefixes(allow)
+	if err != nil {
+		return nil, err
+	}
+	banner := &IPBanner{store: store, allow: prefixes, strikes: make(map[string]strike)}
+
+	// Start the cleanup goroutine
+	go banner.cleanup()
+
+	return banner, nil
+}
+
+// Allowed reports whether the IP address is in the allowlist of the admin panel.
+func (b *IPBanner) Allowed(ip string) bool {
+	if len(b.allow) == 0 {
+		return true
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range b.allow {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowlist returns the CIDR ranges that can open the admin panel, empty if all can.
+func (b *IPBanner) Allowlist() []netip.Prefix {
+	return b.allow
+}
+
+// Banned returns the ban that covers the IP address, false if it's not banned.
+func (b *IPBanner) Banned(ip string) (Ban, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return Ban{}, false
+	}
+	ban, err := b.store.FindBan(addr, time.Now())
+	if err != nil {
+		if !errors.Is(err, ErrBanNotFound) {
+			log.Println("Error finding the ban:", err)
+		}
+		return Ban{}, false
+	}
+	return ban, true
+}
+
+// Strike counts a strike of the kind, StrikeCSRF or StrikeLockout, from the IP address, and bans it for the
+// BanDuration when it reaches the limit of the kind in an hour. The addresses in the allowlist are never
+// banned automatically, so that the admins can't be locked out of the panel by their own mistakes.
+func (b *IPBanner) Strike(ip, kind string) {
+	limit := *BanCSRFFailures
+	if kind == StrikeLockout {
+		limit = *BanLockouts
+	}
+	addr, err := netip.ParseAddr(ip)
+	if limit <= 0 || err != nil || (len(b.allow) > 0 && b.Allowed(ip)) {
+		return
+	}
+	prefix := hostPrefix(addr)
+
+	b.mu.Lock()
+	now := time.Now().UTC()
+	key := kind + ":" + prefix.String()
+	s := b.strikes[key]
+	if now.Sub(s.since) > banStrikeWindow {
+		s = strike{since: now}
+	}
+	s.count++
+	b.strikes[key] = s
+	if s.count < limit {
+		b.mu.Unlock()
+		return
+	}
+	delete(b.strikes, key)
+	b.mu.Unlock()
+
+	var duration time.Duration
+	if *BanDuration > 0 {
+		duration = time.Duration(*BanDuration) * time.Minute
+	}
+	reason := strconv.Itoa(s.count) + " invalid CSRF tokens in an hour"
+	if kind == StrikeLockout {
+		reason = strconv.Itoa(s.count) + " lockouts in an hour"
+	}
+	ban, err := b.Ban(prefix.String(), reason, "", duration)
+	if err != nil {
+		log.Println("Error banning the IP address:", err)
+		return
+	}
+	log.Printf("%s has been banned due to %s.", ban.Prefix, ban.Reason)
+
+	// prepare and send a notification
+	title := *WebHost + " - IP address banned"
+	message := "IP address " + ban.Prefix + " is banned due to " + ban.Reason
+	for _, key := range GotifyAPIKeys {
+		SendNoti(*GotifyServer, key, title, message, 9)
+	}
+}
+
+// Ban bans the IP address or the CIDR range for the duration, 0 to ban it until it's unbanned. The by is
+// the panel user who bans it, empty for the automatic bans.
+func (b *IPBanner) Ban(prefix, reason, by string, duration time.Duration) (Ban, error) {
+	parsed, err := ParsePrefix(prefix)
+	if err != nil {
+		return Ban{}, err
+	}
+	ban := Ban{Prefix: parsed.String(), Reason: reason, CreatedBy: by, CreatedAt: time.Now().UTC().Truncate(time.Second)}
+	if duration > 0 {
+		ban.ExpiresAt = ban.CreatedAt.Add(duration)
+	}
+	return ban, b.store.SetBan(ban)
+}
+
+// Unban removes the ban with the given prefix.
+func (b *IPBanner) Unban(prefix string) error {
+	return b.store.DeleteBan(prefix)
+}
+
+// Bans returns the bans that haven't expired, the latest first.
+func (b *IPBanner) Bans() ([]Ban, error) {
+	bans, err := b.store.ListBans()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	active := bans[:0:0]
+	for _, ban := range bans {
+		if ban.ActiveAt(now) {
+			active = append(active, ban)
+		}
+	}
+	return active, nil
+}
+
+// cleanup periodically removes the expired bans and the strikes out of the window.
+func (b *IPBanner) cleanup() {
+	ticker := time.NewTicker(30 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		<-ticker.C
+		now := time.Now()
+		b.mu.Lock()
+		for key, s := range b.strikes {
+			if now.Sub(s.since) > banStrikeWindow {
+				delete(b.strikes, key)
+			}
+		}
+		b.mu.Unlock()
+		if err := b.store.DeleteExpiredBans(now); err != nil {
+			log.Println("Error cleaning up the expired bans:", err)
+		}
+	}
+}
+
+// hostPrefix returns the prefix that a single host usually gets, the address itself for IPv4 and
+// the /64 for IPv6.
+func hostPrefix(addr netip.Addr) netip.Prefix {
+	addr = addr.Unmap()
+	if addr.Is6() {
+		prefix, _ := addr.Prefix(64)
+		return prefix
+	}
+	return netip.PrefixFrom(addr, addr.BitLen())
+}
@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"github.com/htetmyatthar/server-manager/internal/captcha"
+	. "github.com/htetmyatthar/server-manager/internal/config"
+)
+
+// NewCaptchaVerifier returns the CAPTCHA of the login form from the flags, nil if it's not configured.
+func NewCaptchaVerifier() (captcha.Verifier, error) {
+	switch *Captcha {
+	case "":
+		return nil, nil
+	case captcha.KindProofOfWork:
+		return captcha.NewProofOfWork(captcha.DefaultDifficulty)
+	default:
+		return captcha.NewHTTPVerifier(*Captcha, *CaptchaSiteKey, *CaptchaSecret, *CaptchaEndpoint)
+	}
+}
+
+// CaptchaRequired reports whether the login form from the IP address should ask for the CAPTCHA, after the
+// CaptchaAfter number of failed attempts from it.
+func CaptchaRequired(verifier captcha.Verifier, userLocker *LockedOutRateLimiter, ip string) bool {
+	return verifier != nil && userLocker.IPFailures(ip) >= *CaptchaAfter
+}
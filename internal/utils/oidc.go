@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"errors"
+	"net"
+	"slices"
+	"strings"
+
+	. "github.com/htetmyatthar/server-manager/internal/config"
+	. "github.com/htetmyatthar/server-manager/internal/database"
+	"github.com/htetmyatthar/server-manager/internal/oidc"
+)
+
+var (
+	ErrEmailNotVerified = errors.New("Email of the single sign-on is not verified.")
+	ErrNoOIDCRole       = errors.New("No panel role is given by the single sign-on.")
+)
+
+// OIDCMapping maps the claims of the ID tokens of the single sign-on onto the panel users and their roles.
+type OIDCMapping struct {
+	Claim       string          // the claim that is the panel username, e.g. "email".
+	RoleClaim   string          // the claim that sets the role, empty to keep the roles set in the panel.
+	Roles       map[string]Role // the values of the RoleClaim to the roles.
+	Provision   bool            // whether the missing panel users are created on their first login.
+	DefaultRole Role            // the role of the created panel users without the RoleClaim.
+}
+
+// PanelOrigin returns the origin of the panel that the browsers see, e.g. https://panel.example.com:8888
+func PanelOrigin() string {
+	origin := "https://" + *WebHost
+	if _, port, err := net.SplitHostPort(*WebPort); err == nil && port != "443" {
+		origin += ":" + port
+	}
+	return origin
+}
+
+// NewOIDCProvider returns the identity provider of the single sign-on from the flags, nil if it's not configured.
+func NewOIDCProvider() (*oidc.Provider, error) {
+	if *OIDCIssuer == "" {
+		return nil, nil
+	}
+	return oidc.NewProvider(oidc.Config{
+		Issuer:       *OIDCIssuer,
+		ClientID:     *OIDCClientID,
+		ClientSecret: *OIDCClientSecret,
+		RedirectURL:  PanelOrigin() + "/admin/login/oidc/callback",
+		Scopes:       strings.Fields(*OIDCScopes),
+	})
+}
+
+// InitOIDCMapping parses the mapping of the single sign-on from the flags.
+// The -oidcroles are the values of the role claim with the role seperated by tilde(~), and for each value
+// seperated by comma(,). If it's empty, the role names themselves are the values.
+func InitOIDCMapping() (OIDCMapping, error) {
+	mapping := OIDCMapping{
+		Claim:       *OIDCClaim,
+		RoleClaim:   *OIDCRoleClaim,
+		Roles:       make(map[string]Role),
+		Provision:   *OIDCProvision,
+		DefaultRole: Role(*OIDCDefaultRole),
+	}
+	if mapping.Claim == "" {
+		return OIDCMapping{}, errors.New("Invalid oidcclaim. It can't be empty.")
+	}
+	if !slices.Contains(Roles, mapping.DefaultRole) {
+		return OIDCMapping{}, ErrInvalidRole
+	}
+
+	if *OIDCRoles == "" {
+		for _, role := range Roles {
+			mapping.Roles[string(role)] = role
+		}
+		return mapping, nil
+	}
+	for _, entry := range strings.Split(*OIDCRoles, ",") {
+		value, role, ok := strings.Cut(entry, "~")
+		if !ok || value == "" || !slices.Contains(Roles, Role(role)) {
+			return OIDCMapping{}, errors.New("Invalid oidcroles. Please check the values and the roles.")
+		}
+		mapping.Roles[value] = Role(role)
+	}
+	return mapping, nil
+}
+
+// Username returns the panel username of the claims. The emails have to be verified by the identity
+// provider if it says so, so that anyone can't take over a panel user by signing up with its email.
+func (m OIDCMapping) Username(claims oidc.Claims) (string, error) {
+	username, err := claims.String(m.Claim)
+	if err != nil {
+		return "", err
+	}
+	if m.Claim == "email" {
+		if verified, ok := claims["email_verified"].(bool); ok && !verified {
+			return "", ErrEmailNotVerified
+		}
+	}
+	return username, nil
+}
+
+// Role returns the highest role that the values of the role claim are mapped to. Returns false if there's
+// no RoleClaim configured, and ErrNoOIDCRole if none of the values are mapped to a role.
+func (m OIDCMapping) Role(claims oidc.Claims) (Role, bool, error) {
+	if m.RoleClaim == "" {
+		return "", false, nil
+	}
+
+	highest := -1
+	for _, value := range claims.Strings(m.RoleClaim) {
+		if role, ok := m.Roles[value]; ok {
+			highest = max(highest, slices.Index(Roles, role))
+		}
+	}
+	if highest < 0 {
+		return "", true, ErrNoOIDCRole
+	}
+	return Roles[highest], true, nil
+}
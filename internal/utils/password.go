@@ -0,0 +1,166 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// argon2id parameters of the new password hashes, the second recommended option of RFC 9106.
+// The hashes with the older parameters are still verified and upgraded on the next login.
+const (
+	argon2Time    uint32 = 3
+	argon2Memory  uint32 = 64 * 1024 // in KiB
+	argon2Threads uint8  = 2
+	argon2KeyLen  uint32 = 32
+	argon2SaltLen int    = 16
+
+	// prefix of the argon2id hashes in the PHC string format.
+	// e.g. $argon2id$v=19$m=65536,t=3,p=2$<base64 salt>$<base64 hash>
+	argon2Prefix string = "$argon2id$"
+)
+
+var ErrUnknownHash = errors.New("Unknown password hash format.")
+
+// VerifyPassword verify the password Given with the correct Password.
+// This method can be used to check the input password is the correct u's Password or not,
+// while returning an error if there's any. The correct password should be a hash made by
+// HashPassword.
+//
+// The password is a correct password, only if the boolean is "true", and error is "nil".
+func VerifyPassword(password string, correct string) (bool, error) {
+	var hash, expected []byte
+	switch {
+	case correct == "":
+		// the panel users that are created by the single sign-on have no password.
+		return false, ErrWrongPassword
+	case strings.HasPrefix(correct, argon2Prefix):
+		var params argon2Params
+		var err error
+		params, expected, err = parseArgon2(correct)
+		if err != nil {
+			return false, err
+		}
+		hash = argon2.IDKey([]byte(password), params.salt, params.time, params.memory, params.threads, uint32(len(expected)))
+	default:
+		return false, ErrUnknownHash
+	}
+
+	if subtle.ConstantTimeCompare(hash, expected) == 1 {
+		return true, nil
+	}
+	return false, ErrWrongPassword
+}
+
+// HashPassword hashes the given password string with argon2id and a random salt, returning the
+// hash in the PHC string format. Returns error only if the internal CSPRNG is broken.
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	hash := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2Prefix, argon2.Version, argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(hash)), nil
+}
+
+// IsPasswordHash reports whether the given value is a password hash that VerifyPassword accepts,
+// rather than a plaintext password.
+func IsPasswordHash(value string) bool {
+	return strings.HasPrefix(value, argon2Prefix)
+}
+
+// NeedsRehash reports whether the given password hash is made with the older argon2id parameters,
+// so that it should be replaced with a new HashPassword one.
+func NeedsRehash(hash string) bool {
+	params, key, err := parseArgon2(hash)
+	if err != nil {
+		return true
+	}
+	return params.time != argon2Time || params.memory != argon2Memory || params.threads != argon2Threads ||
+		len(params.salt) != argon2SaltLen || len(key) != int(argon2KeyLen)
+}
+
+// argon2Params are the parameters of an argon2id hash.
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+}
+
+// parseArgon2 parses the argon2id hash in the PHC string format returning its parameters and the hash itself.
+func parseArgon2(encoded string) (argon2Params, []byte, error) {
+	// "", "argon2id", "v=19", "m=65536,t=3,p=2", salt, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return argon2Params{}, nil, ErrUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return argon2Params{}, nil, ErrUnknownHash
+	}
+
+	var params argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return argon2Params{}, nil, ErrUnknownHash
+	}
+
+	var err error
+	params.salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return argon2Params{}, nil, ErrUnknownHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return argon2Params{}, nil, ErrUnknownHash
+	}
+	return params, key, nil
+}
+
+// InitPanelUsers returns the panel users map that each username maps to each password which is hashed already.
+// Each user should be seperated by comma(,).
+// Username and password of each user should be seperated by tilde(~).
+// The password can be a hash made by the "hash-password" command, which is recommended so that the
+// plaintext passwords don't show up in the process list. The plaintext ones are hashed on startup.
+// The users are only used to seed the panel users file on the first start, see data.NewFilePanelUserStore.
+// NOTE: commas in the argon2id hashes, e.g. "m=65536,t=3,p=2", don't seperate the users as they don't have a tilde(~).
+func InitPanelUsers(admins string) map[string]string {
+	users := make(map[string]string)
+
+	var entries []string
+	for _, entry := range strings.Split(admins, ",") {
+		if !strings.Contains(entry, "~") && len(entries) > 0 {
+			entries[len(entries)-1] += "," + entry
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	for _, entry := range entries {
+		username, password, ok := strings.Cut(entry, "~")
+		if !ok || username == "" || password == "" {
+			panic("Invalid panel user. Please check panel username and passwords.")
+		}
+		if IsPasswordHash(password) {
+			users[username] = password
+			continue
+		}
+
+		log.Println("WARN: plaintext password of the panel user", username, "is given, use the hash-password command instead.")
+		// maps the username to the hashed password.
+		hash, err := HashPassword(password)
+		if err != nil {
+			panic("Can't hash the user passwords. Please check panel username and passwords.")
+		}
+		users[username] = hash
+	}
+	return users
+}
@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	. "github.com/htetmyatthar/server-manager/internal/config"
+)
+
+// TOTP parameters of RFC 6238, the defaults that every authenticator app supports.
+const (
+	totpPeriod    int64 = 30 // in seconds
+	totpDigits    int   = 6
+	totpSecretLen int   = 20 // bytes, the length of the HMAC-SHA1 output as RFC 4226 recommends.
+
+	// totpSkew is the number of the time steps before and after the current one that are accepted,
+	// for the clock drifts of the phones and the time it takes to type in the code.
+	totpSkew int64 = 1
+
+	// RecoveryCodeCount is the number of the one-time recovery codes given on the TOTP enrollment.
+	RecoveryCodeCount int = 10
+)
+
+// totpEncoding is the base32 encoding of the TOTP secrets in the otpauth URIs.
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a new random TOTP secret encoded in base32.
+func GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, totpSecretLen)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// TOTPURI returns the otpauth URI of the secret for the given panel user, which is encoded in
+// the QR code that the authenticator apps scan.
+// e.g. otpauth://totp/panel.example.com:admin?secret=...&issuer=panel.example.com
+func TOTPURI(secret, username string) string {
+	issuer := *WebHost
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+	uri := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + username,
+		RawQuery: query.Encode(),
+	}
+	return uri.String()
+}
+
+// VerifyTOTP checks the code against the secret at the given time, accepting the codes of the
+// nearby time steps too. Returns the time step of the matched code so that the same code can't be
+// used twice, see data.PanelUserStore.UseTOTPStep.
+// The code is a correct code, only if the boolean is "true", and error is "nil".
+func VerifyTOTP(secret, code string, now time.Time) (int64, bool, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false, err
+	}
+
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) != totpDigits {
+		return 0, false, nil
+	}
+
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if hmac.Equal([]byte(totpCode(key, step)), []byte(code)) {
+			return step, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// totpCode returns the code of the given time step, the dynamic truncation of RFC 4226.
+func totpCode(key []byte, step int64) string {
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for range totpDigits {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%modulo)
+}
+
+// GenerateRecoveryCodes returns the one-time recovery codes to be shown to the panel user once, with
+// their hashes to be stored. e.g. "k3f9a-2mxq7"
+func GenerateRecoveryCodes() (codes []string, hashes []string, err error) {
+	for range RecoveryCodeCount {
+		random := make([]byte, 7)
+		if _, err := rand.Read(random); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(totpEncoding.EncodeToString(random))[:10]
+		code = code[:5] + "-" + code[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode returns the hex encoded sha-256 hash of the recovery code, ignoring the case,
+// spaces and dashes as they are typed in by hand.
+// NOTE: the random codes have enough entropy with the lockouts that a slow password hash is not needed.
+func HashRecoveryCode(code string) string {
+	code = strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,204 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	. "github.com/htetmyatthar/server-manager/internal/config"
+	. "github.com/htetmyatthar/server-manager/internal/database"
+)
+
+var (
+	// applyMu makes sure only one transaction is touching the config and users files at a time.
+	applyMu sync.Mutex
+
+	ErrConfigRejected = errors.New("Candidate config is rejected by v2ray")
+)
+
+// backupSuffix is appended to the config and users file names for the previous good copies.
+const backupSuffix = ".bak"
+
+// journalSuffix is appended to the config file name for the transaction journal. The journal
+// only exists while the files are being swapped, so seeing it at startup means the process
+// died in the middle of a transaction.
+const journalSuffix = ".txn"
+
+// journal records the backup files that have to be restored if a transaction is interrupted.
+type journal struct {
+	ConfigBackup string `json:"configBackup"`
+	UserBackup   string `json:"userBackup"`
+}
+
+// ApplyConfig replaces the v2ray config file and the users file with the given contents as
+// a single transaction. Both candidates are staged into temporary files, the config candidate is
+// checked with v2ray, and only then both are renamed into place. The previous pair is kept as
+// "<file>.bak" and is restored if any of the steps fails. Returns ErrConfigRejected wrapped with
+// the v2ray output if the candidate config is invalid.
+//
+// CAUTION: this doesn't restart the v2ray server, call RestartService for the changes to take effect.
+func ApplyConfig(configJSON []byte, userJSON []byte) error {
+	applyMu.Lock()
+	defer applyMu.Unlock()
+
+	configTmp, err := stageFile(*ConfigFile, configJSON)
+	if err != nil {
+		return fmt.Errorf("staging config file: %w", err)
+	}
+	defer os.Remove(configTmp)
+
+	userTmp, err := stageFile(*UserFile, userJSON)
+	if err != nil {
+		return fmt.Errorf("staging users file: %w", err)
+	}
+	defer os.Remove(userTmp)
+
+	// check the candidate before anything is touched.
+	if err := ValidateConfigFile(configTmp); err != nil {
+		return fmt.Errorf("%w: %v", ErrConfigRejected, err)
+	}
+
+	// keep the current pair as the backup.
+	configBackup := *ConfigFile + backupSuffix
+	userBackup := *UserFile + backupSuffix
+	if err := copyFile(*ConfigFile, configBackup); err != nil {
+		return fmt.Errorf("backing up config file: %w", err)
+	}
+	if err := copyFile(*UserFile, userBackup); err != nil {
+		return fmt.Errorf("backing up users file: %w", err)
+	}
+
+	// from here on, a crash leaves the journal behind for RecoverConfig.
+	journalFile := *ConfigFile + journalSuffix
+	journalJSON, err := json.Marshal(journal{ConfigBackup: configBackup, UserBackup: userBackup})
+	if err != nil {
+		return err
+	}
+	if err := writeFileSync(journalFile, journalJSON, 0600); err != nil {
+		return fmt.Errorf("writing transaction journal: %w", err)
+	}
+
+	if err := os.Rename(configTmp, *ConfigFile); err != nil {
+		rollback(configBackup, userBackup, journalFile)
+		return fmt.Errorf("replacing config file: %w", err)
+	}
+	if err := os.Rename(userTmp, *UserFile); err != nil {
+		rollback(configBackup, userBackup, journalFile)
+		return fmt.Errorf("replacing users file: %w", err)
+	}
+	syncDir(filepath.Dir(*ConfigFile))
+	syncDir(filepath.Dir(*UserFile))
+
+	if err := os.Remove(journalFile); err != nil {
+		log.Println("WARN: removing transaction journal gone wrong.", err)
+	}
+	return nil
+}
+
+// RecoverConfig restores the backup pair if the previous process died while a transaction from
+// ApplyConfig was swapping the files. It is a no-op when there's no unfinished transaction.
+// Should be called once at startup before serving any request.
+func RecoverConfig() error {
+	applyMu.Lock()
+	defer applyMu.Unlock()
+
+	journalFile := *ConfigFile + journalSuffix
+	journalJSON, err := os.ReadFile(journalFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var j journal
+	if err := json.Unmarshal(journalJSON, &j); err != nil {
+		return fmt.Errorf("corrupted transaction journal %s: %w", journalFile, err)
+	}
+
+	log.Println("WARN: found an unfinished config transaction, restoring the backups.")
+	if err := restoreFile(j.ConfigBackup, *ConfigFile); err != nil {
+		return err
+	}
+	if err := restoreFile(j.UserBackup, *UserFile); err != nil {
+		return err
+	}
+	return os.Remove(journalFile)
+}
+
+// rollback restores both files from their backups and clears the journal.
+// Errors are only logged as there's nothing more to fall back to.
+func rollback(configBackup, userBackup, journalFile string) {
+	if err := restoreFile(configBackup, *ConfigFile); err != nil {
+		log.Println("DANGER: restoring config backup gone wrong.", err)
+		return
+	}
+	if err := restoreFile(userBackup, *UserFile); err != nil {
+		log.Println("DANGER: restoring users backup gone wrong.", err)
+		return
+	}
+	if err := os.Remove(journalFile); err != nil {
+		log.Println("WARN: removing transaction journal gone wrong.", err)
+	}
+}
+
+// restoreFile atomically replaces dst with the contents of the backup file.
+func restoreFile(backup, dst string) error {
+	return copyFile(backup, dst)
+}
+
+// stageFile writes the data into a new temporary file next to dst with the StageFile, so it can be
+// renamed over dst later. The temporary file gets the same permissions as dst.
+// Returns the temporary file path.
+func stageFile(dst string, data []byte) (string, error) {
+	return StageFile(dst, data, filePerm(dst))
+}
+
+// copyFile copies src into dst through a temporary file, so dst is never half written.
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return ReplaceFile(dst, data, filePerm(dst))
+}
+
+// filePerm returns the permissions of the file, or 0644 if it doesn't exist yet.
+func filePerm(name string) fs.FileMode {
+	if info, err := os.Stat(name); err == nil {
+		return info.Mode().Perm()
+	}
+	return 0644
+}
+
+// writeFileSync is os.WriteFile that also flushes the file to the disk.
+func writeFileSync(name string, data []byte, perm fs.FileMode) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir flushes the directory entries so the renames survive a power loss.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer d.Close()
+	d.Sync()
+}
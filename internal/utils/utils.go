@@ -2,20 +2,22 @@ package utils
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
-	"crypto/subtle"
 	"encoding/base64"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
 	"log"
+	"net"
 	"net/http"
+	"net/netip"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
 	"sync"
@@ -27,6 +29,8 @@ import (
 )
 
 // V2rayClient is to add or remove the users from the v2ray config.
+// Only the managed fields are declared, the others like "email" and "level" are kept
+// untouched by the repository.
 type V2rayClient struct {
 	Id      string `json:"id"`
 	AlterId int    `json:"alterId"`
@@ -40,6 +44,87 @@ type Client struct {
 	DeviceId   string `json:"deviceId"`
 	StartDate  string `json:"startDate"`
 	ExpireDate string `json:"expireDate"`
+	Status     string `json:"status,omitempty"` // one of the ClientStatus values, empty is ClientStatusActive.
+}
+
+const (
+	// ClientStatusActive is the status of the clients that are served in the v2ray inbound.
+	ClientStatusActive string = "active"
+
+	// ClientStatusExpired is the status of the clients that are taken out of the v2ray inbound
+	// because of their expire date. Their records are kept in the users file.
+	ClientStatusExpired string = "expired"
+
+	// ClientStatusPending is the status of the clients whose start date is still in the future.
+	// They are kept in the users file but not in the v2ray inbound until the start date.
+	ClientStatusPending string = "pending"
+
+	// DateLayout is the layout of the client start and expire dates.
+	DateLayout string = "2006-01-02"
+)
+
+// Active reports whether the client should be served in the v2ray inbound.
+func (c Client) Active() bool {
+	return c.Status == "" || c.Status == ClientStatusActive
+}
+
+// Validate checks the client's fields returning the problems mapped by the JSON field names.
+// The client is valid only if the returned map is empty.
+func (c Client) Validate() map[string]string {
+	problems := make(map[string]string)
+	if strings.TrimSpace(c.Username) == "" {
+		problems["username"] = "is required"
+	}
+	if !uuidPattern.MatchString(c.Id) {
+		problems["id"] = "should be a UUID"
+	}
+	if c.DeviceId != "" && !uuidPattern.MatchString(c.DeviceId) {
+		problems["deviceId"] = "should be a UUID"
+	}
+	startDate, startErr := time.Parse(DateLayout, c.StartDate)
+	if startErr != nil {
+		problems["startDate"] = "should be in the YYYY-MM-DD format"
+	}
+	expireDate, expireErr := time.Parse(DateLayout, c.ExpireDate)
+	if expireErr != nil {
+		problems["expireDate"] = "should be in the YYYY-MM-DD format"
+	}
+	if startErr == nil && expireErr == nil && !expireDate.After(startDate) {
+		problems["expireDate"] = "should be after the start date"
+	}
+	return problems
+}
+
+// StatusAt returns the status that the client should have at the given time according to its dates.
+func (c Client) StatusAt(now time.Time) string {
+	if c.ExpiredAt(now) {
+		return ClientStatusExpired
+	}
+	if !c.StartedAt(now) {
+		return ClientStatusPending
+	}
+	return ClientStatusActive
+}
+
+// StartedAt reports whether the client's start date has come at the given time, starting from the
+// beginning of that day in the server's time zone. Clients with an invalid start date are always started.
+func (c Client) StartedAt(now time.Time) bool {
+	startDate, err := time.ParseInLocation(DateLayout, c.StartDate, time.Local)
+	if err != nil {
+		return true
+	}
+	return !now.Before(startDate)
+}
+
+// ExpiredAt reports whether the client's expire date has passed at the given time. The client is
+// valid before its expire date, so it is expired from the start of that day in the server's time zone.
+// Clients with an invalid expire date are never expired.
+func (c Client) ExpiredAt(now time.Time) bool {
+	expireDate, err := time.ParseInLocation(DateLayout, c.ExpireDate, time.Local)
+	if err != nil {
+		return false
+	}
+	return !now.Before(expireDate)
 }
 
 type InboundSettings struct {
@@ -55,15 +140,14 @@ type Inbound struct {
 }
 
 var (
+	// uuidPattern matches the UUIDs in the canonical textual form.
+	uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
 	// parse the templates from config
 	// templates = InitTemplates()
 	apologyTemplate, templates = InitEmbedTemplates()
 
 	ErrWrongPassword = errors.New("Wrong password")
-	ErrUserLockedOut = errors.New("User is locked out")
-
-	// Init the panel users
-	PanelUsers = InitPanelUsers(*Admins)
 )
 
 // CAUTION: Before calling this function always ensure to provided the status code with w.WriteHeader().
@@ -158,6 +242,15 @@ func JSONRespondError(w http.ResponseWriter, code int, msg string) {
 	JSONRespond(w, code, map[string]string{"error": msg})
 }
 
+// JSONRespondFieldErrors responds with the validation errors in JSON format, which is the same
+// shape as JSONRespondError with the "fields" that maps each invalid field to its problem.
+func JSONRespondFieldErrors(w http.ResponseWriter, code int, msg string, fields map[string]string) {
+	if code == http.StatusOK {
+		panic("You can't use http status ok(200) for error responses.")
+	}
+	JSONRespond(w, code, map[string]any{"error": msg, "fields": fields})
+}
+
 // Function to restart V2Ray service
 func RestartService() error {
 	cmd := exec.Command("sudo", "systemctl", "restart", "v2ray")
@@ -170,7 +263,12 @@ func RestartService() error {
 
 // Function to validate V2Ray configuration
 func ValidateConfig() error {
-	cmd := exec.Command("v2ray", "-test", "-config", *ConfigFile)
+	return ValidateConfigFile(*ConfigFile)
+}
+
+// ValidateConfigFile validates the given V2Ray configuration file without touching the running server.
+func ValidateConfigFile(path string) error {
+	cmd := exec.Command("v2ray", "-test", "-config", path)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("Config test failed: %s, %v", string(output), err)
@@ -191,6 +289,18 @@ func GenerateSessionId(n int) (string, error) {
 	return base64.URLEncoding.EncodeToString(b), nil
 }
 
+// NewUUID returns a random(version 4) UUID in the canonical textual form.
+// Returns error only if the internal CSPRNG is broken.
+func NewUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // variant 10
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
 // SessionValidate validates the session from the given request if there's any.
 // Session id of the given request is valid(present in the cache) if return error is nil.
 // CAUTION: type of the session is not validated as there are different type of sessions
@@ -198,25 +308,63 @@ func GenerateSessionId(n int) (string, error) {
 //
 // for e.g.(pre-session<public>, private<authenticated>)
 //
-// Return the result(value) string(probably user id) that is stored inside dbRedis cache.
-// If result string is "NaN", it is utils.SessionPublic
-func SessionValidate(r *http.Request, sessionStore SessionStore) (string, func(http.ResponseWriter) error) {
+// Return the session that is stored inside the session store, the zero Session if the request has no session.
+// If the session has no username, it is a public session.
+func SessionValidate(r *http.Request, sessionStore SessionStore) (Session, func(http.ResponseWriter) error) {
 	session, err := r.Cookie(SessionCookieName)
 	if err != nil {
-		return "", nil
+		return Session{}, nil
 	}
 	result, err := sessionStore.GetSession(session.Value)
 	if err != nil {
-		return "", func(w http.ResponseWriter) error {
+		return Session{}, func(w http.ResponseWriter) error {
 			DeleteAllCookies(w, r)
 			return err
 		}
 	}
-	return result.Data, nil
+	return result, nil
+}
+
+// sessionContextKey is the context key of the session of the logged in requests.
+type sessionContextKey struct{}
+
+// WithSession returns the shallow copy of the request that carries the given session in its context.
+func WithSession(r *http.Request, session Session) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), sessionContextKey{}, session))
+}
+
+// RequestSession returns the session of the request that is set by the LoginRequired middleware,
+// false if the request is not logged in with a session(e.g. the API tokens).
+func RequestSession(r *http.Request) (Session, bool) {
+	session, ok := r.Context().Value(sessionContextKey{}).(Session)
+	return session, ok
+}
+
+// RequestUsername returns the panel username of the logged in request, empty if there's no session.
+func RequestUsername(r *http.Request) string {
+	session, _ := RequestSession(r)
+	return session.Username
+}
+
+// roleContextKey is the context key of the role of the panel user of the logged in requests.
+type roleContextKey struct{}
+
+// WithRole returns the shallow copy of the request that carries the given role in its context.
+func WithRole(r *http.Request, role Role) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), roleContextKey{}, role))
+}
+
+// RequestRole returns the role of the panel user that is set by the RoleRequired middleware,
+// empty if the request hasn't passed through it.
+func RequestRole(r *http.Request) Role {
+	role, _ := r.Context().Value(roleContextKey{}).(Role)
+	return role
 }
 
 // DeleteAllCookies deletes the cookies in the following paths to be deleted.
 // ["/", "/admin/login"]
+// NOTE: the domain should be the same as the one the cookies are set with, otherwise the browsers
+// treat them as different cookies and keep the old ones.
 func DeleteAllCookies(w http.ResponseWriter, r *http.Request) {
 	cookies := r.Cookies()
 	paths := []string{"/", "/admin/login"}
@@ -224,10 +372,14 @@ func DeleteAllCookies(w http.ResponseWriter, r *http.Request) {
 	for _, cookie := range cookies {
 		for _, path := range paths {
 			http.SetCookie(w, &http.Cookie{
-				Name:   cookie.Name,
-				Value:  "",
-				Path:   path,
-				MaxAge: -1,
+				Name:     cookie.Name,
+				Value:    "",
+				Path:     path,
+				Domain:   *WebHost,
+				MaxAge:   -1,
+				Secure:   true,
+				HttpOnly: true,
+				SameSite: http.SameSiteStrictMode,
 			})
 		}
 	}
@@ -251,15 +403,67 @@ func SessionSetPath(w http.ResponseWriter, path string, sessionStore SessionStor
 	expireTime := *SessionDuration * 60
 
 	// creating a public session record.
-	sessionStore.CreateSession(sessionString, SessionPublic)
+	sessionStore.CreateSession(sessionString, Session{})
 
 	// create new session cookie
-	session := &http.Cookie{
+	session := newSessionCookie(sessionString, path, expireTime)
+
+	http.SetCookie(w, session)
+	return session, sessionString, nil
+}
+
+// SessionRefresh slides the idle timeout of the given logged in session of the request, keeping the
+// session store and the cookie MaxAge in sync. The session is only refreshed if it gets extended by
+// a minute or more, so that the stores are not written on every request.
+// Returns the refreshed session, or the error of the session store, e.g. data.ErrSessionNotFound if
+// the session is revoked in the meantime.
+func SessionRefresh(w http.ResponseWriter, r *http.Request, session Session, sessionStore SessionStore) (Session, error) {
+	cookie, err := r.Cookie(SessionCookieName)
+	if err != nil {
+		return Session{}, err
+	}
+
+	now := time.Now()
+	if SessionExpiresAt(session.CreatedAt, now).Sub(session.ExpiresAt) < time.Minute {
+		return session, nil
+	}
+
+	session, err = sessionStore.TouchSession(cookie.Value)
+	if err != nil {
+		return Session{}, err
+	}
+	http.SetCookie(w, newSessionCookie(cookie.Value, "/", int(session.ExpiresAt.Sub(now).Seconds())))
+	return session, nil
+}
+
+// Reauthenticated reports whether the panel user of the session authenticated within the -reauthduration,
+// which unlocks the sensitive actions.
+func Reauthenticated(session Session) bool {
+	return time.Since(session.ReauthAt) < time.Duration(*ReauthDuration)*time.Minute
+}
+
+// SessionReauth records the step-up re-authentication of the panel user in the session of the request.
+func SessionReauth(r *http.Request, sessionStore SessionStore) error {
+	cookie, err := r.Cookie(SessionCookieName)
+	if err != nil {
+		return err
+	}
+	session, err := sessionStore.GetSession(cookie.Value)
+	if err != nil {
+		return err
+	}
+	session.ReauthAt = time.Now().UTC()
+	return sessionStore.CreateSession(cookie.Value, session)
+}
+
+// newSessionCookie returns the session cookie with the given value for the given path that expires after maxAge seconds.
+func newSessionCookie(value, path string, maxAge int) *http.Cookie {
+	return &http.Cookie{
 		Name:   SessionCookieName,
-		Value:  sessionString,
+		Value:  value,
 		Path:   path,
 		Domain: *WebHost,
-		MaxAge: expireTime,
+		MaxAge: maxAge,
 		// WARN: use true only with https
 		Secure: true,
 		// for the http request only.
@@ -267,9 +471,6 @@ func SessionSetPath(w http.ResponseWriter, path string, sessionStore SessionStor
 		// don't allow even the subdomain this can help stop csrf attacks.
 		SameSite: http.SameSiteStrictMode,
 	}
-
-	http.SetCookie(w, session)
-	return session, sessionString, nil
 }
 
 // generateHMACHash returns the hash value of HMAC with the given secret and message
@@ -282,11 +483,29 @@ func generateHMACHash(message []byte, secret []byte) ([]byte, error) {
 	return hasher.Sum(nil), nil
 }
 
+// csrfKeys are the secret keys of the CSRF tokens, loaded by InitCSRFKeys.
+var csrfKeys *CSRFKeyRing
+
+// InitCSRFKeys loads the CSRF keys from the csrfkeyfile, creating it with a random key if it doesn't exist.
+func InitCSRFKeys() error {
+	ring, err := NewFileCSRFKeyRing(*CSRFKeyFile, time.Duration(*CSRFKeyWindow)*time.Minute)
+	if err != nil {
+		return err
+	}
+	csrfKeys = ring
+	return nil
+}
+
+// ReloadCSRFKeys loads the CSRF keys again after they are rotated by the rotate-csrf-key command.
+func ReloadCSRFKeys() error {
+	return csrfKeys.Reload()
+}
+
 // GenerateCSRF generate CSRF tokens for state changing that needed to be guarded,
 // using the given sessionId. Return error if the random number generation is failing or
 // creating MAC hash is failing. Given sessionId should be in the form of base64.URLEncoding
 //
-// full process: token => b64(HMAC(sessionId + "!" + b64(random_bytes), CsrfSecretBytes))+"."+(sessionId+"!"+b64(random_bytes))
+// full process: token => b64(HMAC(sessionId + "!" + b64(random_bytes), current_key))+"."+(sessionId+"!"+b64(random_bytes))
 // simplify: token=b64(HMAC)+"."+(sessionId + "!" + b64(random_bytes))
 func GenerateCSRF(sessionId string) (token string, err error) {
 	var buf bytes.Buffer
@@ -316,7 +535,7 @@ func GenerateCSRF(sessionId string) (token string, err error) {
 	buf.Reset() // reset to clear out the values
 
 	// generate HMAC hash value
-	hash, err := generateHMACHash(messageBytes, CsrfSecretBytes)
+	hash, err := generateHMACHash(messageBytes, csrfKeys.Current())
 	if err != nil {
 		return
 	}
@@ -329,10 +548,14 @@ func GenerateCSRF(sessionId string) (token string, err error) {
 	return
 }
 
-// VerifyCSRF verifies the CSRF token is valid or not using the request.
+// VerifyCSRF verifies the CSRF token is valid or not using the request. The tokens signed with the
+// retired CSRF keys are still valid until the rotation window is over.
 // The given csrf token is valid only if there's no error.
 func VerifyCSRF(token string, r *http.Request) (bool, error) {
 	tokenValues := strings.Split(token, ".")
+	if len(tokenValues) != 2 {
+		return false, errors.New("Malformed CSRF token")
+	}
 	messageValues := strings.Split(tokenValues[1], "!")
 
 	// be aware of the same site strict policy in cookies.
@@ -353,105 +576,122 @@ func VerifyCSRF(token string, r *http.Request) (bool, error) {
 		return false, err
 	}
 
-	// regerating hash with the given info
-	hash, err := generateHMACHash([]byte(tokenValues[1]), CsrfSecretBytes)
-	if err != nil {
-		return false, err
-	}
+	// regerating hash with the given info, with the retired keys too during their rotation window.
+	for _, key := range csrfKeys.Keys() {
+		hash, err := generateHMACHash([]byte(tokenValues[1]), key)
+		if err != nil {
+			return false, err
+		}
 
-	// only true if the HMAC hashes are the same
-	if hmac.Equal(hash, tokenHash) {
-		return true, nil
+		// only true if the HMAC hashes are the same
+		if hmac.Equal(hash, tokenHash) {
+			return true, nil
+		}
 	}
 	return false, errors.New("DANGER: Internal Server error.")
 }
 
-// SessionSetPrivate sets the session to the given path while also adding to the sessionStore cache.
+// SessionSetPrivate sets the logged in session of the given panel user to the "/" path while also adding to
+// the sessionStore cache. The IP address and the user agent of the request are recorded with the session.
 // Return error if there's problem with creating random session strings or sessionStore cache problem.
-func SessionSetPrivate(w http.ResponseWriter, path string, sessionStore SessionStore) error {
+func SessionSetPrivate(w http.ResponseWriter, r *http.Request, username string, sessionStore SessionStore) error {
 	// create session string
 	sessionString, err := GenerateSessionId(32)
 	if err != nil {
 		return err
 	}
 
-	// HACK: used the configured session duration with seconds.
-	expireTime := *SessionDuration * 60
+	// the idle timeout, or the maximum lifetime if it's shorter.
+	now := time.Now()
+	expireTime := int(SessionExpiresAt(now, now).Sub(now).Seconds())
 
-	// emmpty string to add the default data which is the id.
-	sessionStore.CreateSession(sessionString, "")
+	ip, err := RemoteIP(r)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	err = sessionStore.CreateSession(sessionString, Session{
+		Username:  username,
+		IP:        ip,
+		UserAgent: r.UserAgent(),
+		ReauthAt:  now.UTC(),
+	})
+	if err != nil {
+		return err
+	}
 
 	// create new session cookie
-	session := &http.Cookie{
-		Name:   SessionCookieName,
-		Value:  sessionString,
-		Path:   "/",
-		Domain: *WebHost,
-		MaxAge: expireTime,
-		// WARN: use true only with https
-		Secure: true,
-		// for the http request only.
-		HttpOnly: true,
-		// don't allow even the subdomain this can help stop csrf attacks.
-		SameSite: http.SameSiteStrictMode,
-	}
+	session := newSessionCookie(sessionString, "/", expireTime)
 
 	// only set at the end for ensuring the safety
 	http.SetCookie(w, session)
 	return nil
 }
 
-// VerifyPassword verify the password Given with the correct Password.
-// This method can be used to check the input password is the correct u's Password or not,
-// while returning an error if there's any.
-//
-// The password is a correct password, only if the boolean is "true", and error is "nil".
-func VerifyPassword(password string, correct string) (bool, error) {
-	_, hashBytes, err := HashPassword(password)
-	if err != nil {
-		return false, err
-	}
-	userPassword, err := hex.DecodeString(correct)
-	if err != nil {
-		return false, err
-	}
-	if subtle.ConstantTimeCompare(hashBytes, userPassword) == 1 {
-		return true, nil
-	}
-	return false, ErrWrongPassword
+// clientIPContextKey is the context key of the IP address of the client resolved by the middleware.ClientIP.
+type clientIPContextKey struct{}
+
+// WithClientIP returns the shallow copy of the request that carries the IP address of the client in its context.
+func WithClientIP(r *http.Request, ip string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), clientIPContextKey{}, ip))
 }
 
-// HashPassword hashes the given password string to sha-256 hash returning the hashed values
-// as a hex-dec value string and also in the form of byte slice.
-func HashPassword(password string) (string, []byte, error) {
-	hasher := sha256.New()
-	_, err := hasher.Write([]byte(password))
-	if err != nil {
-		return "", nil, err
+// RemoteIP returns the IP address of the client of the request without the port. It's the one resolved from
+// the forwarded headers of the trusted proxies by the middleware.ClientIP, the peer of the connection otherwise.
+func RemoteIP(r *http.Request) (string, error) {
+	if ip, ok := r.Context().Value(clientIPContextKey{}).(string); ok {
+		return ip, nil
 	}
-	hashedBytes := hasher.Sum(nil)
-	// hex is easier to maintain
-	return hex.EncodeToString(hashedBytes), hashedBytes, err
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	return ip, err
 }
 
-// LoginAttempt tracks failed login attempts and lockout status
-type LoginAttempt struct {
-	FailedCount int
-	LockedUntil time.Time
+// adminDeniedContextKey is the context key that marks the requests from the IP addresses out of the admin
+// allowlist, see the middleware.IPFilter.
+type adminDeniedContextKey struct{}
+
+// WithAdminDenied returns the shallow copy of the request that is marked as coming from an IP address out of
+// the admin allowlist, so that it's rejected if it's session-authenticated.
+func WithAdminDenied(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), adminDeniedContextKey{}, true))
 }
 
-// LockedOutRateLimiter manages login attempts and lockouts on usernames.
-type LockedOutRateLimiter struct {
-	// maps the account owner usernames to the login attempts.
-	attempts map[string]*LoginAttempt
-	mu       sync.Mutex
+// AdminDenied reports whether the request comes from an IP address out of the admin allowlist.
+func AdminDenied(r *http.Request) bool {
+	denied, _ := r.Context().Value(adminDeniedContextKey{}).(bool)
+	return denied
 }
 
-// NewRateLimiter initializes a new RateLimiter
-func NewLockedOutRateLimiter() *LockedOutRateLimiter {
-	rl := &LockedOutRateLimiter{
-		attempts: make(map[string]*LoginAttempt),
+// ParsePrefixes parses the IP addresses and the CIDR ranges seperated by comma(,), see ParsePrefix.
+func ParsePrefixes(list string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, value := range strings.Split(list, ",") {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		prefix, err := ParsePrefix(value)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix)
 	}
+	return prefixes, nil
+}
+
+// LockedOutRateLimiter throttles the failed authentications on both the usernames and the IP addresses, so
+// that neither guessing the password of a user nor spraying many usernames from an IP address gets far.
+// After MaxFailedAttempts failures of a username, or MaxFailedAttemptsIP of an IP address, every further
+// failure locks it out for the LockOutDuration doubled for each failure before it, up to the LockOutMax.
+// The failures are forgotten after the LockOutMax without any, and kept in the store through the restarts.
+type LockedOutRateLimiter struct {
+	store  LockoutStore
+	banner *IPBanner // counts the lockouts toward the bans of the IP addresses, nil to not ban.
+	mu     sync.Mutex
+}
+
+// NewLockedOutRateLimiter initializes a new LockedOutRateLimiter keeping the failures in the given store.
+// The lockouts are counted toward the bans of the IP addresses that cause them by the banner if it's not nil.
+func NewLockedOutRateLimiter(store LockoutStore, banner *IPBanner) *LockedOutRateLimiter {
+	rl := &LockedOutRateLimiter{store: store, banner: banner}
 
 	// Start the cleanup goroutine
 	go rl.cleanup()
@@ -459,61 +699,89 @@ func NewLockedOutRateLimiter() *LockedOutRateLimiter {
 	return rl
 }
 
-// RecordFailedAttempt increments the failed attempt count and locks out the user if necessary.
-// Returns ErrUserLockedOut if the user is being locked out for too many failed attempts.
-func (rl *LockedOutRateLimiter) RecordFailedAttempt(username string) error {
+// RecordFailedAttempt counts the failed attempt of the username from the IP address, either can be empty,
+// e.g. the username is not counted if it doesn't exist. Returns the lockouts that start with this attempt.
+func (rl *LockedOutRateLimiter) RecordFailedAttempt(username, ip string) []Lockout {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
-	attempt, exists := rl.attempts[username]
-	if !exists {
-		attempt = &LoginAttempt{
-			FailedCount: 1,
-			LockedUntil: time.Time{},
+	var lockouts []Lockout
+	now := time.Now().UTC()
+	for _, key := range lockoutKeys(username, ip) {
+		lockout, _ := rl.store.GetLockout(key)
+		lockout.Key = key
+		lockout.Failures++
+		lockout.LastFailure = now
+
+		threshold := MaxFailedAttempts
+		if lockout.Kind() == LockoutIP {
+			threshold = MaxFailedAttemptsIP
+		}
+		if lockout.Failures >= threshold {
+			lockout.LockedUntil = now.Add(lockoutDuration(lockout.Failures - threshold))
+			lockouts = append(lockouts, lockout)
+			log.Printf("%s has been locked out until %s due to too many failed login attempts.", lockout.Key, lockout.LockedUntil.Format(time.RFC1123))
 		}
-		rl.attempts[username] = attempt
-		return nil
-	}
 
-	attempt.FailedCount++
-	if attempt.FailedCount >= MaxFailedAttempts {
-		attempt.LockedUntil = time.Now().Add(time.Duration(*LockOutDuration) * time.Minute)
-		log.Printf("User %s has been locked out until %s due to too many failed login attempts.", username, attempt.LockedUntil.Format(time.RFC1123))
-		return ErrUserLockedOut
+		// NOTE: the lockout is still in memory if the store can't save it.
+		if err := rl.store.SetLockout(lockout); err != nil {
+			log.Println("Error saving the failed login attempt:", err)
+		}
 	}
-	return nil
+	if len(lockouts) > 0 && rl.banner != nil {
+		rl.banner.Strike(ip, StrikeLockout)
+	}
+	return lockouts
 }
 
-// ResetAttempts resets the failed attempt count for a user
+// ResetAttempts forgets the failed attempts of the username after it has logged in. The failures of the
+// IP address are kept, otherwise logging into an own account would reset the spraying of the others.
 func (rl *LockedOutRateLimiter) ResetAttempts(username string) {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
-	if _, exists := rl.attempts[username]; exists {
-		delete(rl.attempts, username)
+	err := rl.store.DeleteLockout(LockoutKey(LockoutUser, username))
+	if err == nil {
 		log.Printf("User %s has successfully logged in. Failed attempts reset.", username)
+	} else if !errors.Is(err, ErrLockoutNotFound) {
+		log.Println("Error resetting the failed login attempts:", err)
 	}
 }
 
-// IsLockedOut checks if a user is currently locked out
-func (rl *LockedOutRateLimiter) IsLockedOut(username string) bool {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
-	attempt, exists := rl.attempts[username]
-	if !exists {
-		return false
+// IsLockedOut checks if the username or the IP address is currently locked out, either can be empty.
+func (rl *LockedOutRateLimiter) IsLockedOut(username, ip string) bool {
+	now := time.Now()
+	for _, key := range lockoutKeys(username, ip) {
+		if lockout, ok := rl.store.GetLockout(key); ok && lockout.LockedAt(now) {
+			return true
+		}
 	}
+	return false
+}
 
-	if time.Now().Before(attempt.LockedUntil) {
-		return true
+// IPFailures returns the number of the failed attempts from the IP address that aren't forgotten yet.
+func (rl *LockedOutRateLimiter) IPFailures(ip string) int {
+	for _, key := range lockoutKeys("", ip) {
+		if lockout, ok := rl.store.GetLockout(key); ok {
+			return lockout.Failures
+		}
 	}
+	return 0
+}
 
-	// If lockout period has passed, but user still has failed attempts
-	return false
+// Lockouts returns the usernames and the IP addresses with the failed attempts, the latest failure first.
+func (rl *LockedOutRateLimiter) Lockouts() ([]Lockout, error) {
+	return rl.store.ListLockouts()
+}
+
+// Unlock forgets the failed attempts of the lockout with the given key, e.g. when an admin unlocks it.
+func (rl *LockedOutRateLimiter) Unlock(key string) error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.store.DeleteLockout(key)
 }
 
-// cleanup periodically removes old entries to prevent memory leaks
+// cleanup periodically forgets the failures that are older than the LockOutMax.
 func (rl *LockedOutRateLimiter) cleanup() {
 	ticker := time.NewTicker(30 * time.Minute)
 	defer ticker.Stop()
@@ -521,16 +789,48 @@ func (rl *LockedOutRateLimiter) cleanup() {
 	for {
 		<-ticker.C
 		rl.mu.Lock()
-		for username, attempt := range rl.attempts {
-			if time.Now().After(attempt.LockedUntil) && attempt.FailedCount == 0 {
-				delete(rl.attempts, username)
-				log.Printf("Cleaned up session for user %s.", username)
-			}
-		}
+		err := rl.store.DeleteLockoutsBefore(time.Now().Add(-time.Duration(*LockOutMax) * time.Minute))
 		rl.mu.Unlock()
+		if err != nil {
+			log.Println("Error cleaning up the failed login attempts:", err)
+		}
 	}
 }
 
+// lockoutKeys returns the lockout keys of the non-empty username and IP address. The IPv6 addresses
+// are counted by their /64 prefix, as a single host usually gets the whole prefix.
+func lockoutKeys(username, ip string) []string {
+	var keys []string
+	if username != "" {
+		keys = append(keys, LockoutKey(LockoutUser, username))
+	}
+	if addr, err := netip.ParseAddr(ip); err == nil {
+		addr = addr.Unmap()
+		if addr.Is6() {
+			ip = hostPrefix(addr).String()
+		} else {
+			ip = addr.String()
+		}
+	}
+	if ip != "" {
+		keys = append(keys, LockoutKey(LockoutIP, ip))
+	}
+	return keys
+}
+
+// lockoutDuration returns the LockOutDuration doubled the given times, up to the LockOutMax.
+func lockoutDuration(doublings int) time.Duration {
+	duration := time.Duration(*LockOutDuration) * time.Minute
+	maximum := time.Duration(*LockOutMax) * time.Minute
+	for range doublings {
+		if duration >= maximum {
+			break
+		}
+		duration *= 2
+	}
+	return min(duration, maximum)
+}
+
 // Message data for the gotify server.
 type GotifyMessage struct {
 	Title    string `json:"title"`
@@ -579,21 +879,3 @@ func SendNoti(gotifyServer, appToken, title, message string, priority int) error
 
 	return nil
 }
-
-// InitPanelUsers returns the panel users map that each username maps to each password which is hashed already.
-// Each user should be seperated by comma(,).
-// Username and password of each user should be seperated by tilde(~).
-func InitPanelUsers(string) map[string]string {
-	users := make(map[string]string)
-	admins := strings.Split(*Admins, ",")
-	for _, admin := range admins {
-		info := strings.Split(admin, "~")
-		// maps the username to the hashed password.
-		password, _, err := HashPassword(info[1])
-		if err != nil {
-			panic("Can't hash the user passwords. Please check panel username and passwords.")
-		}
-		users[info[0]] = password
-	}
-	return users
-}
@@ -0,0 +1,184 @@
+package vmess
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strings"
+	"sync"
+
+	"github.com/skip2/go-qrcode"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// layout of the QR code images which is the same for both the PNG and the SVG ones.
+const (
+	canvasSize  = 1024 // width and height of the image.
+	padding     = 40   // space between the border and the edge of the image.
+	borderWidth = 2    // width of the border line.
+	qrSize      = 750  // width and height of the QR code itself.
+	fontSize    = 36   // size of the labels.
+	labelGap    = 20   // space between the username label and the QR code.
+)
+
+var (
+	textColor = color.RGBA{R: 0xFF, A: 0xFF} // red labels.
+
+	// labelFace is parsed once on the first use.
+	labelFace     font.Face
+	labelFaceErr  error
+	labelFaceOnce sync.Once
+
+	// faceMu guards the labelFace as font.Face is not safe for concurrent use.
+	faceMu sync.Mutex
+)
+
+// PNG returns the QR code of the given link as a PNG image with the label on the top and
+// the remark at the bottom.
+func PNG(uri, label, remark string) ([]byte, error) {
+	bitmap, err := bitmap(uri)
+	if err != nil {
+		return nil, err
+	}
+	face, err := face()
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, canvasSize, canvasSize))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	// border with padding.
+	outer := image.Rect(padding, padding, canvasSize-padding, canvasSize-padding)
+	inner := outer.Inset(borderWidth)
+	draw.Draw(img, outer, image.Black, image.Point{}, draw.Src)
+	draw.Draw(img, inner, image.White, image.Point{}, draw.Src)
+
+	labelY, qrY, remarkY := positions()
+
+	// the QR code, each module is scaled to the nearest pixel.
+	qrX := (canvasSize - qrSize) / 2
+	modules := len(bitmap)
+	for y := 0; y < modules; y++ {
+		for x := 0; x < modules; x++ {
+			if !bitmap[y][x] {
+				continue
+			}
+			r := image.Rect(
+				qrX+x*qrSize/modules, qrY+y*qrSize/modules,
+				qrX+(x+1)*qrSize/modules, qrY+(y+1)*qrSize/modules,
+			)
+			draw.Draw(img, r, image.Black, image.Point{}, draw.Src)
+		}
+	}
+
+	drawCentered(img, face, label, labelY)
+	drawCentered(img, face, remark, remarkY)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SVG returns the QR code of the given link as a SVG image with the label on the top and
+// the remark at the bottom.
+func SVG(uri, label, remark string) ([]byte, error) {
+	bitmap, err := bitmap(uri)
+	if err != nil {
+		return nil, err
+	}
+	labelY, qrY, remarkY := positions()
+	qrX := (canvasSize - qrSize) / 2
+	modules := len(bitmap)
+
+	// one path for every dark module in the module units.
+	var path strings.Builder
+	for y := 0; y < modules; y++ {
+		for x := 0; x < modules; x++ {
+			if bitmap[y][x] {
+				fmt.Fprintf(&path, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`, canvasSize, canvasSize, canvasSize, canvasSize)
+	fmt.Fprintf(&buf, `<rect width="100%%" height="100%%" fill="#fff"/>`)
+	fmt.Fprintf(&buf, `<rect x="%d" y="%d" width="%d" height="%d" fill="none" stroke="#000" stroke-width="%d"/>`,
+		padding+borderWidth/2, padding+borderWidth/2, canvasSize-2*padding-borderWidth, canvasSize-2*padding-borderWidth, borderWidth)
+	fmt.Fprintf(&buf, `<path transform="translate(%d %d) scale(%g)" shape-rendering="crispEdges" fill="#000" d="%s"/>`,
+		qrX, qrY, float64(qrSize)/float64(modules), path.String())
+	for _, text := range []struct {
+		y     int
+		value string
+	}{{labelY, label}, {remarkY, remark}} {
+		fmt.Fprintf(&buf, `<text x="%d" y="%d" fill="#FF0000" font-family="'Roboto', 'Open Sans', 'Noto Serif', sans-serif" font-size="%d" text-anchor="middle">%s</text>`,
+			canvasSize/2, text.y, fontSize, html.EscapeString(text.value))
+	}
+	buf.WriteString(`</svg>`)
+	return buf.Bytes(), nil
+}
+
+// positions returns the baseline of the label, the top of the QR code and the baseline of the remark,
+// so that the whole content is vertically centered.
+func positions() (labelY, qrY, remarkY int) {
+	contentHeight := qrSize + fontSize*2
+	topSpace := (canvasSize - contentHeight) / 2
+	labelY = topSpace + fontSize
+	qrY = labelY + labelGap
+	remarkY = qrY + qrSize + fontSize
+	return
+}
+
+// bitmap returns the QR code modules of the given link including the quiet zone.
+func bitmap(uri string) ([][]bool, error) {
+	q, err := qrcode.New(uri, qrcode.Medium)
+	if err != nil {
+		return nil, err
+	}
+	return q.Bitmap(), nil
+}
+
+// face returns the font face for the labels.
+func face() (font.Face, error) {
+	labelFaceOnce.Do(func() {
+		f, err := opentype.Parse(goregular.TTF)
+		if err != nil {
+			labelFaceErr = err
+			return
+		}
+		labelFace, labelFaceErr = opentype.NewFace(f, &opentype.FaceOptions{
+			Size:    fontSize,
+			DPI:     72,
+			Hinting: font.HintingFull,
+		})
+	})
+	return labelFace, labelFaceErr
+}
+
+// drawCentered draws the text horizontally centered on the given baseline.
+func drawCentered(img draw.Image, face font.Face, text string, baseline int) {
+	faceMu.Lock()
+	defer faceMu.Unlock()
+
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(textColor),
+		Face: face,
+	}
+	width := d.MeasureString(text)
+	d.Dot = fixed.Point26_6{
+		X: fixed.I(canvasSize/2) - width/2,
+		Y: fixed.I(baseline),
+	}
+	d.DrawString(text)
+}
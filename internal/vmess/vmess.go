@@ -0,0 +1,202 @@
+// This generates the vmess links and their QR codes for the clients, which are compatible
+// with the v2box application. Both the opened links and the device-locked ones are supported.
+package vmess
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/htetmyatthar/server-manager/internal/config"
+	"github.com/htetmyatthar/server-manager/internal/utils"
+)
+
+const (
+	// prefix of every vmess link.
+	vmessPrefix string = "vmess://"
+
+	// prefix of the device-locked links that wraps the vmess link for v2box.
+	lockedPrefix string = "v2box://locked="
+
+	// device id of the clients that are not locked to any device.
+	emptyDeviceId string = "00000000-0000-0000-0000-000000000000"
+)
+
+var ErrNoDeviceId = errors.New("Unable to generate locked link without device id.")
+
+// link is the version 2 vmess link format. The fields are in the same order as the links
+// that the dashboard used to generate in the browser.
+type link struct {
+	Add      string `json:"add"`
+	Aid      string `json:"aid"`
+	Alpn     string `json:"alpn"`
+	Fp       string `json:"fp"`
+	Host     string `json:"host"`
+	DeviceId string `json:"deviceID,omitempty"`
+	Id       string `json:"id"`
+	Net      string `json:"net"`
+	Path     string `json:"path"`
+	Port     string `json:"port"`
+	Ps       string `json:"ps"`
+	Scy      string `json:"scy"`
+	Sni      string `json:"sni"`
+	Tls      string `json:"tls"`
+	Type     string `json:"type"`
+	V        string `json:"v"`
+}
+
+// streamSettings is the part of the v2ray inbound streamSettings that the links depend on.
+type streamSettings struct {
+	Network     string `json:"network"`
+	Security    string `json:"security"`
+	TlsSettings struct {
+		ServerName string   `json:"serverName"`
+		Alpn       []string `json:"alpn"`
+	} `json:"tlsSettings"`
+	TcpSettings struct {
+		Header struct {
+			Type    string `json:"type"`
+			Request struct {
+				Path    []string                   `json:"path"`
+				Headers map[string]json.RawMessage `json:"headers"` // either a string or a list of strings
+			} `json:"request"`
+		} `json:"header"`
+	} `json:"tcpSettings"`
+	WsSettings struct {
+		Path    string            `json:"path"`
+		Headers map[string]string `json:"headers"`
+	} `json:"wsSettings"`
+}
+
+// URI returns the opened vmess link of the client that is served on the given inbound.
+// The link points to the config.WebHostIP and config.V2rayPort.
+func URI(client utils.Client, inbound utils.Inbound) (string, error) {
+	l, err := newLink(client, inbound)
+	if err != nil {
+		return "", err
+	}
+	return l.encode()
+}
+
+// LockedURI returns the device-locked vmess link of the client that is served on the given inbound.
+// Returns ErrNoDeviceId if the client is not locked to any device.
+func LockedURI(client utils.Client, inbound utils.Inbound) (string, error) {
+	if client.DeviceId == "" || client.DeviceId == emptyDeviceId {
+		return "", ErrNoDeviceId
+	}
+	l, err := newLink(client, inbound)
+	if err != nil {
+		return "", err
+	}
+	l.DeviceId = client.DeviceId
+	opened, err := l.encode()
+	if err != nil {
+		return "", err
+	}
+	return lockedPrefix + base64.StdEncoding.EncodeToString([]byte(opened)), nil
+}
+
+// Label returns the username label of the QR code, the device-locked ones end with
+// the last 4 digits of the device id.
+func Label(client utils.Client, locked bool) string {
+	if locked {
+		return client.Username + " " + last4(client.DeviceId)
+	}
+	return client.Username
+}
+
+// Remark returns the remark label of the QR code, which is the sub domain of the server
+// and the last 4 digits of the client id.
+func Remark(client utils.Client) string {
+	return subDomain() + " - " + last4(client.Id)
+}
+
+// newLink fills the link with the client and the stream settings of the inbound.
+func newLink(client utils.Client, inbound utils.Inbound) (*link, error) {
+	l := &link{
+		Add:  *config.WebHostIP,
+		Aid:  "1",
+		Id:   client.Id,
+		Net:  "tcp",
+		Path: "/",
+		Port: *config.V2rayPort,
+		Ps:   "valid before (" + client.ExpireDate + ") " + subDomain() + "-" + *config.WebHostRegion + "-" + last4(client.Id),
+		Scy:  "none",
+		Type: "none",
+		V:    "2",
+	}
+
+	if len(inbound.StreamSettings) == 0 {
+		return l, nil
+	}
+	var settings streamSettings
+	if err := json.Unmarshal(inbound.StreamSettings, &settings); err != nil {
+		return nil, err
+	}
+
+	if settings.Network != "" {
+		l.Net = settings.Network
+	}
+	if settings.Security == "tls" {
+		l.Tls = "tls"
+		l.Sni = settings.TlsSettings.ServerName
+		l.Alpn = strings.Join(settings.TlsSettings.Alpn, ",")
+	}
+
+	switch l.Net {
+	case "tcp":
+		header := settings.TcpSettings.Header
+		if header.Type != "" {
+			l.Type = header.Type
+		}
+		if len(header.Request.Path) > 0 {
+			l.Path = header.Request.Path[0]
+		}
+		l.Host = firstString(header.Request.Headers["Host"])
+	case "ws":
+		if settings.WsSettings.Path != "" {
+			l.Path = settings.WsSettings.Path
+		}
+		l.Host = settings.WsSettings.Headers["Host"]
+	}
+	return l, nil
+}
+
+// encode returns the link as base64 encoded JSON with the vmess prefix.
+func (l *link) encode() (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(l); err != nil {
+		return "", err
+	}
+	return vmessPrefix + base64.StdEncoding.EncodeToString(bytes.TrimSuffix(buf.Bytes(), []byte("\n"))), nil
+}
+
+// firstString returns the given JSON string, or the first one if it is a list of strings.
+func firstString(raw json.RawMessage) string {
+	var value string
+	if json.Unmarshal(raw, &value) == nil {
+		return value
+	}
+	var values []string
+	if json.Unmarshal(raw, &values) == nil && len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// subDomain returns the first label of the config.WebHost.
+func subDomain() string {
+	return strings.Split(*config.WebHost, ".")[0]
+}
+
+// last4 returns the last 4 characters of the given string.
+func last4(s string) string {
+	if len(s) <= 4 {
+		return s
+	}
+	return s[len(s)-4:]
+}
@@ -0,0 +1,136 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// maxCBORDepth is the maximum nesting of the CBOR arrays and maps, so that the malicious
+// inputs can't exhaust the stack.
+const maxCBORDepth int = 16
+
+var ErrInvalidCBOR = errors.New("Invalid CBOR data.")
+
+// decodeCBOR decodes the first CBOR data item of the data, returning the rest of the data.
+// Only the definite length items that the authenticators send are supported: the integers as int64,
+// the byte strings as []byte, the text strings as string, the arrays as []any, the maps as
+// map[any]any with the integer or text keys, and the simple values false, true and null.
+// NOTE: this is not a general purpose decoder, e.g. the floats and the tags are rejected.
+func decodeCBOR(data []byte) (any, []byte, error) {
+	return decodeItem(data, 0)
+}
+
+// decodeItem decodes a CBOR data item at the given nesting depth.
+func decodeItem(data []byte, depth int) (any, []byte, error) {
+	if depth > maxCBORDepth || len(data) == 0 {
+		return nil, nil, ErrInvalidCBOR
+	}
+
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+	data = data[1:]
+
+	// the simple values have no argument.
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, data, nil
+		case 21:
+			return true, data, nil
+		case 22:
+			return nil, data, nil
+		default:
+			return nil, nil, ErrInvalidCBOR
+		}
+	}
+
+	argument, data, err := decodeArgument(info, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case 0: // unsigned integer
+		if argument > math.MaxInt64 {
+			return nil, nil, ErrInvalidCBOR
+		}
+		return int64(argument), data, nil
+	case 1: // negative integer
+		if argument > math.MaxInt64 {
+			return nil, nil, ErrInvalidCBOR
+		}
+		return -1 - int64(argument), data, nil
+	case 2, 3: // byte string, text string
+		if argument > uint64(len(data)) {
+			return nil, nil, ErrInvalidCBOR
+		}
+		value := data[:argument]
+		if major == 3 {
+			return string(value), data[argument:], nil
+		}
+		return append([]byte(nil), value...), data[argument:], nil
+	case 4: // array
+		// each item is at least a byte long.
+		if argument > uint64(len(data)) {
+			return nil, nil, ErrInvalidCBOR
+		}
+		array := make([]any, 0, argument)
+		for range argument {
+			var item any
+			item, data, err = decodeItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			array = append(array, item)
+		}
+		return array, data, nil
+	case 5: // map
+		if argument > uint64(len(data))/2 {
+			return nil, nil, ErrInvalidCBOR
+		}
+		object := make(map[any]any, argument)
+		for range argument {
+			var key, value any
+			key, data, err = decodeItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, ErrInvalidCBOR
+			}
+			if _, exists := object[key]; exists {
+				return nil, nil, ErrInvalidCBOR
+			}
+			value, data, err = decodeItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			object[key] = value
+		}
+		return object, data, nil
+	default: // tags
+		return nil, nil, ErrInvalidCBOR
+	}
+}
+
+// decodeArgument decodes the argument of the CBOR data item head with the additional info,
+// returning the rest of the data. The indefinite lengths are rejected.
+func decodeArgument(info byte, data []byte) (uint64, []byte, error) {
+	switch {
+	case info < 24:
+		return uint64(info), data, nil
+	case info == 24 && len(data) >= 1:
+		return uint64(data[0]), data[1:], nil
+	case info == 25 && len(data) >= 2:
+		return uint64(binary.BigEndian.Uint16(data)), data[2:], nil
+	case info == 26 && len(data) >= 4:
+		return uint64(binary.BigEndian.Uint32(data)), data[4:], nil
+	case info == 27 && len(data) >= 8:
+		return binary.BigEndian.Uint64(data), data[8:], nil
+	default:
+		return 0, nil, ErrInvalidCBOR
+	}
+}
@@ -0,0 +1,123 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+// COSE algorithm identifiers of the supported public keys, in the order of preference.
+const (
+	AlgES256 int64 = -7   // ECDSA with P-256 and SHA-256, supported by every authenticator.
+	AlgEdDSA int64 = -8   // Ed25519
+	AlgRS256 int64 = -257 // RSASSA-PKCS1-v1_5 with SHA-256, e.g. Windows Hello.
+)
+
+// COSE key parameters, RFC 9053.
+const (
+	coseKty int64 = 1
+	coseAlg int64 = 3
+	coseCrv int64 = -1 // also the modulus n of the RSA keys.
+	coseX   int64 = -2 // also the exponent e of the RSA keys.
+	coseY   int64 = -3
+
+	coseKtyOKP int64 = 1
+	coseKtyEC2 int64 = 2
+	coseKtyRSA int64 = 3
+
+	coseCrvP256    int64 = 1
+	coseCrvEd25519 int64 = 6
+
+	// minRSABits is the minimum size of the RSA keys that are accepted.
+	minRSABits int = 2048
+)
+
+var (
+	ErrUnsupportedKey   = errors.New("Unsupported public key.")
+	ErrInvalidSignature = errors.New("Invalid signature.")
+)
+
+// publicKey is a parsed COSE public key of a credential.
+type publicKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+// parsePublicKey parses the CBOR encoded COSE_Key of a credential. Only the ES256, EdDSA and RS256 keys
+// are supported which are the ones that are asked in the CreationOptions.
+func parsePublicKey(cose []byte) (publicKey, error) {
+	item, rest, err := decodeCBOR(cose)
+	if err != nil {
+		return publicKey{}, err
+	}
+	object, ok := item.(map[any]any)
+	if !ok || len(rest) != 0 {
+		return publicKey{}, ErrUnsupportedKey
+	}
+
+	kty, _ := object[coseKty].(int64)
+	alg, _ := object[coseAlg].(int64)
+	switch {
+	case kty == coseKtyEC2 && alg == AlgES256:
+		crv, _ := object[coseCrv].(int64)
+		x, _ := object[coseX].([]byte)
+		y, _ := object[coseY].([]byte)
+		if crv != coseCrvP256 || len(x) != 32 || len(y) != 32 {
+			return publicKey{}, ErrUnsupportedKey
+		}
+		// NOTE: ecdh checks that the point is on the curve which ecdsa doesn't.
+		point := append(append([]byte{4}, x...), y...)
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return publicKey{}, ErrUnsupportedKey
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		return publicKey{alg: alg, key: key}, nil
+
+	case kty == coseKtyOKP && alg == AlgEdDSA:
+		crv, _ := object[coseCrv].(int64)
+		x, _ := object[coseX].([]byte)
+		if crv != coseCrvEd25519 || len(x) != ed25519.PublicKeySize {
+			return publicKey{}, ErrUnsupportedKey
+		}
+		return publicKey{alg: alg, key: ed25519.PublicKey(x)}, nil
+
+	case kty == coseKtyRSA && alg == AlgRS256:
+		n, _ := object[coseCrv].([]byte)
+		e, _ := object[coseX].([]byte)
+		modulus := new(big.Int).SetBytes(n)
+		exponent := new(big.Int).SetBytes(e)
+		if modulus.BitLen() < minRSABits || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return publicKey{}, ErrUnsupportedKey
+		}
+		return publicKey{alg: alg, key: &rsa.PublicKey{N: modulus, E: int(exponent.Int64())}}, nil
+
+	default:
+		return publicKey{}, ErrUnsupportedKey
+	}
+}
+
+// verify checks the signature of the message with the public key.
+func (k publicKey) verify(message, signature []byte) error {
+	digest := sha256.Sum256(message)
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		if ecdsa.VerifyASN1(key, digest[:], signature) {
+			return nil
+		}
+	case ed25519.PublicKey:
+		if ed25519.Verify(key, message, signature) {
+			return nil
+		}
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
@@ -0,0 +1,370 @@
+// Package webauthn implements the relying party side of the Web Authentication(passkeys) ceremonies
+// that the panel needs: registering the credentials and verifying the assertions of the logins.
+// See https://www.w3.org/TR/webauthn-2/
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// challengeLen is the number of the random bytes of the challenges.
+const challengeLen int = 32
+
+// authenticator data flags.
+const (
+	flagUserPresent  byte = 0x01
+	flagUserVerified byte = 0x04
+	flagAttested     byte = 0x40
+)
+
+var (
+	ErrInvalidResponse  = errors.New("Invalid authenticator response.")
+	ErrChallenge        = errors.New("Challenge doesn't match.")
+	ErrOrigin           = errors.New("Origin doesn't match.")
+	ErrRelyingParty     = errors.New("Relying party doesn't match.")
+	ErrUserPresence     = errors.New("User presence is required.")
+	ErrUserVerification = errors.New("User verification is required.")
+	ErrSignCount        = errors.New("Sign count didn't increase, the authenticator may be cloned.")
+)
+
+// Base64URL is the binary data that is encoded as an unpadded base64url string in JSON, the way the
+// browsers' ArrayBuffers are sent to and from the server.
+type Base64URL []byte
+
+// MarshalJSON encodes the data as an unpadded base64url string.
+func (b Base64URL) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+// UnmarshalJSON decodes the base64url string, with or without the padding.
+func (b *Base64URL) UnmarshalJSON(data []byte) error {
+	var encoded string
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// String returns the unpadded base64url encoding of the data, e.g. the credential ID.
+func (b Base64URL) String() string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// RelyingParty is the website that the credentials are scoped to.
+type RelyingParty struct {
+	ID     string // the domain name, e.g. panel.example.com
+	Name   string // shown to the users by the browsers.
+	Origin string // e.g. https://panel.example.com:8888
+}
+
+// NewChallenge returns a new random challenge encoded in base64url, to be kept on the server until
+// the response of the ceremony comes back.
+func NewChallenge() (string, error) {
+	challenge := make([]byte, challengeLen)
+	if _, err := rand.Read(challenge); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(challenge), nil
+}
+
+// CredentialParameter is a type of the public key credential that the relying party accepts.
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+// CredentialDescriptor identifies a credential of the user.
+type CredentialDescriptor struct {
+	Type string    `json:"type"`
+	ID   Base64URL `json:"id"`
+}
+
+// CreationOptions is the publicKey option of navigator.credentials.create() in JSON.
+type CreationOptions struct {
+	Challenge string `json:"challenge"`
+	RP        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          Base64URL `json:"id"`
+		Name        string    `json:"name"`
+		DisplayName string    `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+	Attestation string `json:"attestation"`
+	Timeout     int    `json:"timeout"` // in milliseconds
+}
+
+// RequestOptions is the publicKey option of navigator.credentials.get() in JSON.
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+	Timeout          int                    `json:"timeout"` // in milliseconds
+}
+
+// RegistrationResponse is the PublicKeyCredential that navigator.credentials.create() returns, in JSON.
+type RegistrationResponse struct {
+	ID       string    `json:"id"`
+	RawID    Base64URL `json:"rawId"`
+	Type     string    `json:"type"`
+	Response struct {
+		ClientDataJSON    Base64URL `json:"clientDataJSON"`
+		AttestationObject Base64URL `json:"attestationObject"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the PublicKeyCredential that navigator.credentials.get() returns, in JSON.
+type AssertionResponse struct {
+	ID       string    `json:"id"`
+	RawID    Base64URL `json:"rawId"`
+	Type     string    `json:"type"`
+	Response struct {
+		ClientDataJSON    Base64URL `json:"clientDataJSON"`
+		AuthenticatorData Base64URL `json:"authenticatorData"`
+		Signature         Base64URL `json:"signature"`
+		UserHandle        Base64URL `json:"userHandle,omitempty"`
+	} `json:"response"`
+}
+
+// Credential is a verified new credential to be stored for the user.
+type Credential struct {
+	ID           Base64URL
+	PublicKey    []byte // the CBOR encoded COSE_Key.
+	SignCount    uint32
+	UserVerified bool
+}
+
+// clientData is the client data that the browser signs along with the authenticator data.
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// authenticatorData is the parsed authenticator data.
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte // only with the flagAttested.
+	publicKey    []byte // only with the flagAttested.
+}
+
+// UserID returns the opaque user handle of the username that is given to the authenticators,
+// so that the username itself isn't stored in them as the ID.
+func UserID(username string) Base64URL {
+	sum := sha256.Sum256([]byte(username))
+	return Base64URL(sum[:16])
+}
+
+// CreationOptions returns the options of registering a new credential for the user with the challenge.
+// The existing credential IDs are excluded so that the same authenticator isn't registered twice.
+func (rp RelyingParty) CreationOptions(challenge, username string, existing [][]byte) CreationOptions {
+	var options CreationOptions
+	options.Challenge = challenge
+	options.RP.ID = rp.ID
+	options.RP.Name = rp.Name
+	options.User.ID = UserID(username)
+	options.User.Name = username
+	options.User.DisplayName = username
+	options.PubKeyCredParams = []CredentialParameter{
+		{Type: "public-key", Alg: AlgES256},
+		{Type: "public-key", Alg: AlgEdDSA},
+		{Type: "public-key", Alg: AlgRS256},
+	}
+	options.ExcludeCredentials = descriptors(existing)
+	// NOTE: the discoverable credentials are needed for the logins without the username.
+	options.AuthenticatorSelection.ResidentKey = "preferred"
+	options.AuthenticatorSelection.UserVerification = "preferred"
+	options.Attestation = "none"
+	options.Timeout = 5 * 60 * 1000
+	return options
+}
+
+// RequestOptions returns the options of a login with the challenge. The empty allowed credentials lets
+// the user pick any discoverable credential of the relying party.
+func (rp RelyingParty) RequestOptions(challenge string, allowed [][]byte, userVerification string) RequestOptions {
+	return RequestOptions{
+		Challenge:        challenge,
+		RPID:             rp.ID,
+		AllowCredentials: descriptors(allowed),
+		UserVerification: userVerification,
+		Timeout:          5 * 60 * 1000,
+	}
+}
+
+// VerifyRegistration verifies the response of registering a new credential against the challenge,
+// returning the credential to be stored.
+// NOTE: the attestation is not verified, as "none" is asked in the CreationOptions. The panel trusts the
+// logged in user to pick the authenticator, not the authenticator's make and model.
+func (rp RelyingParty) VerifyRegistration(challenge string, response RegistrationResponse) (Credential, error) {
+	if response.Type != "public-key" {
+		return Credential{}, ErrInvalidResponse
+	}
+	if err := rp.verifyClientData(response.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return Credential{}, err
+	}
+
+	item, rest, err := decodeCBOR(response.Response.AttestationObject)
+	if err != nil {
+		return Credential{}, err
+	}
+	attestation, ok := item.(map[any]any)
+	if !ok || len(rest) != 0 {
+		return Credential{}, ErrInvalidResponse
+	}
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return Credential{}, ErrInvalidResponse
+	}
+
+	authData, err := rp.verifyAuthenticatorData(rawAuthData, false)
+	if err != nil {
+		return Credential{}, err
+	}
+	if authData.flags&flagAttested == 0 {
+		return Credential{}, ErrInvalidResponse
+	}
+	if !bytes.Equal(authData.credentialID, response.RawID) {
+		return Credential{}, ErrInvalidResponse
+	}
+	// the key is checked now, so that the unusable credentials aren't stored.
+	if _, err := parsePublicKey(authData.publicKey); err != nil {
+		return Credential{}, err
+	}
+
+	return Credential{
+		ID:           authData.credentialID,
+		PublicKey:    authData.publicKey,
+		SignCount:    authData.signCount,
+		UserVerified: authData.flags&flagUserVerified != 0,
+	}, nil
+}
+
+// VerifyAssertion verifies the response of a login against the challenge with the stored public key
+// and sign count of the credential, returning the new sign count to be stored.
+// The user verification(e.g. the PIN or the fingerprint) is required if requireUV is true.
+func (rp RelyingParty) VerifyAssertion(challenge string, response AssertionResponse, publicKey []byte, signCount uint32, requireUV bool) (uint32, error) {
+	if response.Type != "public-key" {
+		return 0, ErrInvalidResponse
+	}
+	if err := rp.verifyClientData(response.Response.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	authData, err := rp.verifyAuthenticatorData(response.Response.AuthenticatorData, requireUV)
+	if err != nil {
+		return 0, err
+	}
+
+	key, err := parsePublicKey(publicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(response.Response.ClientDataJSON)
+	message := append(bytes.Clone(response.Response.AuthenticatorData), clientDataHash[:]...)
+	if err := key.verify(message, response.Response.Signature); err != nil {
+		return 0, err
+	}
+
+	// NOTE: the authenticators that don't count(e.g. the synced passkeys) always send 0.
+	if (authData.signCount != 0 || signCount != 0) && authData.signCount <= signCount {
+		return 0, ErrSignCount
+	}
+	return authData.signCount, nil
+}
+
+// verifyClientData checks the type, challenge and origin of the client data.
+func (rp RelyingParty) verifyClientData(raw []byte, ceremony, challenge string) error {
+	var client clientData
+	if err := json.Unmarshal(raw, &client); err != nil {
+		return ErrInvalidResponse
+	}
+	if client.Type != ceremony {
+		return ErrInvalidResponse
+	}
+	if challenge == "" || subtle.ConstantTimeCompare([]byte(client.Challenge), []byte(challenge)) != 1 {
+		return ErrChallenge
+	}
+	if client.Origin != rp.Origin || client.CrossOrigin {
+		return ErrOrigin
+	}
+	return nil
+}
+
+// verifyAuthenticatorData parses the authenticator data and checks the relying party and the user flags.
+func (rp RelyingParty) verifyAuthenticatorData(raw []byte, requireUV bool) (authenticatorData, error) {
+	// rpIdHash(32) flags(1) signCount(4)
+	if len(raw) < 37 {
+		return authenticatorData{}, ErrInvalidResponse
+	}
+	authData := authenticatorData{
+		rpIDHash:  raw[:32],
+		flags:     raw[32],
+		signCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(authData.rpIDHash, rpIDHash[:]) != 1 {
+		return authenticatorData{}, ErrRelyingParty
+	}
+	if authData.flags&flagUserPresent == 0 {
+		return authenticatorData{}, ErrUserPresence
+	}
+	if requireUV && authData.flags&flagUserVerified == 0 {
+		return authenticatorData{}, ErrUserVerification
+	}
+
+	if authData.flags&flagAttested != 0 {
+		// aaguid(16) credentialIdLength(2) credentialId publicKey
+		attested := raw[37:]
+		if len(attested) < 18 {
+			return authenticatorData{}, ErrInvalidResponse
+		}
+		idLen := int(binary.BigEndian.Uint16(attested[16:18]))
+		attested = attested[18:]
+		if idLen == 0 || idLen > 1023 || len(attested) < idLen {
+			return authenticatorData{}, ErrInvalidResponse
+		}
+		authData.credentialID = bytes.Clone(attested[:idLen])
+		attested = attested[idLen:]
+
+		_, rest, err := decodeCBOR(attested)
+		if err != nil {
+			return authenticatorData{}, err
+		}
+		authData.publicKey = bytes.Clone(attested[:len(attested)-len(rest)])
+	}
+	return authData, nil
+}
+
+// descriptors returns the credential descriptors of the credential IDs.
+func descriptors(ids [][]byte) []CredentialDescriptor {
+	result := make([]CredentialDescriptor, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, CredentialDescriptor{Type: "public-key", ID: id})
+	}
+	return result
+}
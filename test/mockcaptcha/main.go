@@ -0,0 +1,64 @@
+// mockcaptcha is a minimal stand-in for the siteverify endpoint of reCAPTCHA and hCaptcha for trying out the
+// CAPTCHA of the login form locally. The responses listed in -pass are accepted, everything else is rejected.
+// CAUTION: never use it for anything but testing.
+//
+//	go run ./test/mockcaptcha -secret secret -pass solved
+//	server-manager -captcha recaptcha -captchasitekey site -captchasecret secret -captchaendpoint http://127.0.0.1:9998/siteverify ...
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+var (
+	addr   = flag.String("addr", "127.0.0.1:9998", "address to listen on, the endpoint is http://<addr>/siteverify")
+	secret = flag.String("secret", "secret", "secret of the panel")
+	pass   = flag.String("pass", "solved", "responses that are accepted seperated by comma(,)")
+)
+
+func main() {
+	flag.Parse()
+	passed := strings.Split(*pass, ",")
+
+	http.HandleFunc("POST /siteverify", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			respond(w, false, "bad-request")
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.PostForm.Get("secret")), []byte(*secret)) != 1 {
+			respond(w, false, "invalid-input-secret")
+			return
+		}
+		response := r.PostForm.Get("response")
+		if response == "" {
+			respond(w, false, "missing-input-response")
+			return
+		}
+		if !slices.Contains(passed, response) {
+			log.Println("Rejected the response from", r.PostForm.Get("remoteip"))
+			respond(w, false, "invalid-input-response")
+			return
+		}
+		log.Println("Accepted the response from", r.PostForm.Get("remoteip"))
+		respond(w, true, "")
+	})
+
+	log.Println("Mock siteverify endpoint is listening at", "http://"+*addr+"/siteverify")
+	log.Fatalln(http.ListenAndServe(*addr, nil))
+}
+
+// respond writes the siteverify result in JSON.
+func respond(w http.ResponseWriter, success bool, code string) {
+	result := map[string]any{"success": success}
+	if code != "" {
+		result["error-codes"] = []string{code}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,197 @@
+// mockidp is a minimal OpenID Connect identity provider for trying out the single sign-on of the panel
+// locally. It logs everyone in as the configured user without asking anything.
+// CAUTION: never use it for anything but testing.
+//
+//	go run ./test/mockidp -email admin@example.com -groups panel-admins
+//	server-manager -oidcissuer http://127.0.0.1:9999 -oidcclientid panel -oidcroleclaim groups ...
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// authorization is an issued authorization code waiting for the token request.
+type authorization struct {
+	clientID    string
+	redirectURI string
+	nonce       string
+	challenge   string
+	email       string
+	expiresAt   time.Time
+}
+
+var (
+	addr          = flag.String("addr", "127.0.0.1:9999", "address to listen on, the issuer is http://<addr>")
+	clientID      = flag.String("clientid", "panel", "client id of the panel")
+	clientSecret  = flag.String("clientsecret", "", "client secret of the panel, empty for a public client")
+	email         = flag.String("email", "admin@example.com", "email of the user that everyone is logged in as, the login_hint parameter overrides it")
+	emailVerified = flag.Bool("emailverified", true, "email_verified claim of the user")
+	groups        = flag.String("groups", "", "groups claim of the user seperated by comma(,)")
+
+	key   *rsa.PrivateKey
+	keyID string // new on every start, so that the panel fetches the new key.
+
+	mu    sync.Mutex
+	codes = make(map[string]authorization)
+)
+
+func main() {
+	flag.Parse()
+
+	var err error
+	key, err = rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatalln("Generating the signing key gone wrong: ", err)
+	}
+	keyID = random()[:8]
+	issuer := "http://" + *addr
+
+	http.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, http.StatusOK, map[string]any{
+			"issuer":                                issuer,
+			"authorization_endpoint":                issuer + "/authorize",
+			"token_endpoint":                        issuer + "/token",
+			"jwks_uri":                              issuer + "/jwks",
+			"response_types_supported":              []string{"code"},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+			"code_challenge_methods_supported":      []string{"S256"},
+		})
+	})
+
+	http.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, http.StatusOK, map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+
+	http.HandleFunc("GET /authorize", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		redirectURI, err := url.Parse(query.Get("redirect_uri"))
+		if err != nil || query.Get("client_id") != *clientID || query.Get("response_type") != "code" ||
+			query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+			http.Error(w, "invalid authorization request", http.StatusBadRequest)
+			return
+		}
+
+		user := *email
+		if hint := query.Get("login_hint"); hint != "" {
+			user = hint
+		}
+		code := random()
+		mu.Lock()
+		codes[code] = authorization{
+			clientID:    *clientID,
+			redirectURI: redirectURI.String(),
+			nonce:       query.Get("nonce"),
+			challenge:   query.Get("code_challenge"),
+			email:       user,
+			expiresAt:   time.Now().Add(time.Minute),
+		}
+		mu.Unlock()
+		log.Println("Logged in as", user)
+
+		callback := redirectURI.Query()
+		callback.Set("code", code)
+		callback.Set("state", query.Get("state"))
+		redirectURI.RawQuery = callback.Encode()
+		http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+	})
+
+	http.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		auth, ok := codes[r.FormValue("code")]
+		delete(codes, r.FormValue("code"))
+		mu.Unlock()
+
+		id, secret, basic := r.BasicAuth()
+		if !basic {
+			id = r.FormValue("client_id")
+		}
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+		verifier := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		switch {
+		case !ok || time.Now().After(auth.expiresAt) || r.FormValue("grant_type") != "authorization_code":
+			respond(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+			return
+		case id != auth.clientID || subtle.ConstantTimeCompare([]byte(secret), []byte(*clientSecret)) != 1:
+			respond(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+			return
+		case r.FormValue("redirect_uri") != auth.redirectURI || base64.RawURLEncoding.EncodeToString(verifier[:]) != auth.challenge:
+			respond(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "wrong redirect_uri or code_verifier"})
+			return
+		}
+
+		now := time.Now()
+		claims := map[string]any{
+			"iss":            issuer,
+			"sub":            auth.email,
+			"aud":            auth.clientID,
+			"exp":            now.Add(5 * time.Minute).Unix(),
+			"iat":            now.Unix(),
+			"nonce":          auth.nonce,
+			"email":          auth.email,
+			"email_verified": *emailVerified,
+		}
+		if *groups != "" {
+			claims["groups"] = strings.Split(*groups, ",")
+		}
+		respond(w, http.StatusOK, map[string]any{
+			"access_token": random(),
+			"token_type":   "Bearer",
+			"expires_in":   300,
+			"id_token":     sign(claims),
+		})
+	})
+
+	log.Println("Mock identity provider is listening at", issuer)
+	log.Fatalln(http.ListenAndServe(*addr, nil))
+}
+
+// sign returns the RS256 signed JWT of the claims.
+func sign(claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": keyID})
+	payload, _ := json.Marshal(claims)
+	message := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(message))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		log.Fatalln("Signing the ID token gone wrong: ", err)
+	}
+	return message + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// random returns a random base64url string.
+func random() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// respond responds the data in JSON.
+func respond(w http.ResponseWriter, code int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,35 @@
+// mockredis runs the in-memory stand-in for redis of the test/mockredis for trying out the redis session
+// store of the panel locally.
+// CAUTION: never use it for anything but testing.
+//
+//	go run ./test/mockredis/cmd/mockredis -password secret
+//	server-manager -sessionstore redis -redisaddr 127.0.0.1:6380 -redispassword secret ...
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+
+	"github.com/htetmyatthar/server-manager/test/mockredis"
+)
+
+var (
+	addr     = flag.String("addr", "127.0.0.1:6380", "address to listen on")
+	password = flag.String("password", "", "password that the clients have to AUTH with, empty for no authentication")
+	verbose  = flag.Bool("verbose", false, "log every command without the values")
+)
+
+func main() {
+	flag.Parse()
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatalln("Listening gone wrong: ", err)
+	}
+	server := mockredis.NewServer(*password)
+	server.Verbose = *verbose
+
+	log.Println("Mock redis is listening at", listener.Addr())
+	log.Fatalln(server.Serve(listener))
+}
@@ -0,0 +1,441 @@
+// Package mockredis is a minimal in-memory stand-in for redis for testing the redis session store of the panel
+// without a redis server. It speaks RESP2 and the commands that the session store sends, with the key TTLs,
+// the sets and the pipelining, and nothing is written to the disk. Run it with the cmd/mockredis, or start it
+// on a loopback listener in the tests.
+// CAUTION: never use it for anything but testing.
+//
+//	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+//	go mockredis.NewServer("secret").Serve(listener)
+//	defer listener.Close()
+package mockredis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// entry is the value of a key, either a string or a set.
+type entry struct {
+	value     *string
+	set       map[string]struct{}
+	expiresAt time.Time // zero if it has no TTL.
+}
+
+// reply is a RESP2 reply that is already encoded.
+type reply string
+
+const (
+	ok        reply = "+OK\r\n"
+	null      reply = "$-1\r\n"
+	wrongType reply = "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"
+	noAuth    reply = "-NOAUTH Authentication required.\r\n"
+	syntaxErr reply = "-ERR syntax error\r\n"
+	notInt    reply = "-ERR value is not an integer or out of range\r\n"
+)
+
+// Server is the in-memory redis server.
+type Server struct {
+	password  string
+	databases int
+
+	// Verbose logs every command without the values.
+	Verbose bool
+
+	mu  sync.Mutex
+	dbs map[int]map[string]*entry
+}
+
+// NewServer initializes a new Server with 16 databases, which the clients have to AUTH with the password
+// unless it's empty.
+func NewServer(password string) *Server {
+	return &Server{password: password, databases: 16, dbs: make(map[int]map[string]*entry)}
+}
+
+// Serve serves the connections accepted by the listener until it's closed.
+func (s *Server) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.serve(conn)
+	}
+}
+
+// Keys returns the unexpired keys of the database, sorted.
+func (s *Server) Keys(db int) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var keys []string
+	for key, e := range s.dbs[db] {
+		if e.expiresAt.IsZero() || now.Before(e.expiresAt) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// serve reads the commands of the connection and writes their replies until it's closed.
+// The replies are flushed only when there's no more pipelined command to read.
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	session := &client{server: s, authed: s.password == ""}
+
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Println("Error reading the command:", err)
+				w.WriteString("-ERR Protocol error: " + err.Error() + "\r\n")
+				w.Flush()
+			}
+			return
+		}
+		if s.Verbose {
+			log.Println(conn.RemoteAddr(), strings.ToUpper(args[0]), len(args)-1, "args")
+		}
+		w.WriteString(string(session.execute(args)))
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readCommand reads a command sent as an array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("expected '*', got %q", line)
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid multibulk length %q", line)
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, fmt.Errorf("expected '$', got %q", line)
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid bulk length %q", line)
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+// readLine reads a line without the CRLF.
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
+
+// client is the state of a connection.
+type client struct {
+	server *Server
+	authed bool
+	db     int
+}
+
+// execute runs the command and returns its reply.
+func (c *client) execute(args []string) reply {
+	name := strings.ToUpper(args[0])
+	args = args[1:]
+	switch name {
+	case "PING":
+		return "+PONG\r\n"
+	case "AUTH":
+		if len(args) != 1 {
+			return wrongArgs(name)
+		}
+		if c.server.password == "" {
+			return "-ERR AUTH <password> called without any password configured for the default user.\r\n"
+		}
+		if args[0] != c.server.password {
+			return "-WRONGPASS invalid username-password pair or user is disabled.\r\n"
+		}
+		c.authed = true
+		return ok
+	}
+	if !c.authed {
+		return noAuth
+	}
+	if name == "SELECT" {
+		if len(args) != 1 {
+			return wrongArgs(name)
+		}
+		db, err := strconv.Atoi(args[0])
+		if err != nil || db < 0 || db >= c.server.databases {
+			return "-ERR DB index is out of range\r\n"
+		}
+		c.db = db
+		return ok
+	}
+
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+	keys := c.server.dbs[c.db]
+	if keys == nil {
+		keys = make(map[string]*entry)
+		c.server.dbs[c.db] = keys
+	}
+	now := time.Now()
+	// lookup returns the unexpired entry of the key, removing it if it's expired.
+	lookup := func(key string) *entry {
+		e, exists := keys[key]
+		if !exists {
+			return nil
+		}
+		if !e.expiresAt.IsZero() && !now.Before(e.expiresAt) {
+			delete(keys, key)
+			return nil
+		}
+		return e
+	}
+
+	switch name {
+	case "SET":
+		if len(args) < 2 {
+			return wrongArgs(name)
+		}
+		e := &entry{value: &args[1]}
+		for i := 2; i < len(args); i++ {
+			option := strings.ToUpper(args[i])
+			if (option != "PX" && option != "EX") || i+1 >= len(args) {
+				return syntaxErr
+			}
+			ttl, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return notInt
+			}
+			if ttl <= 0 {
+				return "-ERR invalid expire time in 'set' command\r\n"
+			}
+			unit := time.Millisecond
+			if option == "EX" {
+				unit = time.Second
+			}
+			e.expiresAt = now.Add(time.Duration(ttl) * unit)
+			i++
+		}
+		keys[args[0]] = e
+		return ok
+
+	case "GET":
+		if len(args) != 1 {
+			return wrongArgs(name)
+		}
+		e := lookup(args[0])
+		if e == nil {
+			return null
+		}
+		if e.value == nil {
+			return wrongType
+		}
+		return bulk(*e.value)
+
+	case "DEL":
+		if len(args) < 1 {
+			return wrongArgs(name)
+		}
+		deleted := 0
+		for _, key := range args {
+			if lookup(key) != nil {
+				delete(keys, key)
+				deleted++
+			}
+		}
+		return integer(deleted)
+
+	case "PEXPIRE", "EXPIRE":
+		if len(args) != 2 {
+			return wrongArgs(name)
+		}
+		ttl, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return notInt
+		}
+		e := lookup(args[0])
+		if e == nil {
+			return integer(0)
+		}
+		unit := time.Millisecond
+		if name == "EXPIRE" {
+			unit = time.Second
+		}
+		e.expiresAt = now.Add(time.Duration(ttl) * unit)
+		if ttl <= 0 {
+			delete(keys, args[0])
+		}
+		return integer(1)
+
+	case "PERSIST":
+		if len(args) != 1 {
+			return wrongArgs(name)
+		}
+		e := lookup(args[0])
+		if e == nil || e.expiresAt.IsZero() {
+			return integer(0)
+		}
+		e.expiresAt = time.Time{}
+		return integer(1)
+
+	case "PTTL", "TTL":
+		if len(args) != 1 {
+			return wrongArgs(name)
+		}
+		e := lookup(args[0])
+		switch {
+		case e == nil:
+			return integer(-2)
+		case e.expiresAt.IsZero():
+			return integer(-1)
+		case name == "TTL":
+			return integer(int((e.expiresAt.Sub(now) + time.Second/2) / time.Second))
+		default:
+			return integer(int(e.expiresAt.Sub(now).Milliseconds()))
+		}
+
+	case "SADD", "SREM":
+		if len(args) < 2 {
+			return wrongArgs(name)
+		}
+		e := lookup(args[0])
+		if e != nil && e.set == nil {
+			return wrongType
+		}
+		if e == nil {
+			if name == "SREM" {
+				return integer(0)
+			}
+			e = &entry{set: make(map[string]struct{})}
+			keys[args[0]] = e
+		}
+		changed := 0
+		for _, member := range args[1:] {
+			_, exists := e.set[member]
+			switch {
+			case name == "SADD" && !exists:
+				e.set[member] = struct{}{}
+				changed++
+			case name == "SREM" && exists:
+				delete(e.set, member)
+				changed++
+			}
+		}
+		// redis removes the empty sets.
+		if len(e.set) == 0 {
+			delete(keys, args[0])
+		}
+		return integer(changed)
+
+	case "SMEMBERS":
+		if len(args) != 1 {
+			return wrongArgs(name)
+		}
+		e := lookup(args[0])
+		if e == nil {
+			return array(nil)
+		}
+		if e.set == nil {
+			return wrongType
+		}
+		members := make([]string, 0, len(e.set))
+		for member := range e.set {
+			members = append(members, member)
+		}
+		slices.Sort(members)
+		return array(members)
+
+	case "SCAN":
+		// NOTE: every key is returned in a single page, the cursor is always 0.
+		if len(args) < 1 {
+			return wrongArgs(name)
+		}
+		pattern := "*"
+		for i := 1; i+1 < len(args); i += 2 {
+			if strings.ToUpper(args[i]) == "MATCH" {
+				pattern = args[i+1]
+			}
+		}
+		var matched []string
+		for key := range keys {
+			if lookup(key) == nil {
+				continue
+			}
+			if ok, _ := path.Match(pattern, key); ok {
+				matched = append(matched, key)
+			}
+		}
+		slices.Sort(matched)
+		return reply("*2\r\n") + bulk("0") + array(matched)
+
+	case "FLUSHDB":
+		c.server.dbs[c.db] = make(map[string]*entry)
+		return ok
+
+	default:
+		return reply("-ERR unknown command '" + strings.ToLower(name) + "'\r\n")
+	}
+}
+
+// wrongArgs returns the error reply for the wrong number of the arguments.
+func wrongArgs(name string) reply {
+	return reply("-ERR wrong number of arguments for '" + strings.ToLower(name) + "' command\r\n")
+}
+
+// integer returns the integer reply.
+func integer(n int) reply {
+	return reply(":" + strconv.Itoa(n) + "\r\n")
+}
+
+// bulk returns the bulk string reply.
+func bulk(s string) reply {
+	return reply("$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n")
+}
+
+// array returns the array reply of the bulk strings.
+func array(values []string) reply {
+	var b strings.Builder
+	b.WriteString("*" + strconv.Itoa(len(values)) + "\r\n")
+	for _, value := range values {
+		b.WriteString(string(bulk(value)))
+	}
+	return reply(b.String())
+}
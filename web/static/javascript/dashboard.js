@@ -1,13 +1,3 @@
-class QRInfo {
-	constructor(userNumber, username, deviceID, id, expDate) {
-		this.userNumber = userNumber;
-		this.username = username;
-		this.expDate = expDate;
-		this.id = id;
-		this.deviceID = deviceID;
-	}
-}
-
 class Modal {
 	constructor(modalSelector, openBtnSelector, closeBtnSelector) {
 		this.modal = document.querySelector(modalSelector);
@@ -25,12 +15,13 @@ class Modal {
 		});
 	}
 
+	// NOTE: the modal might not be rendered for the role of the panel user.
 	open() {
-		this.modal.showModal();
+		this.modal?.showModal();
 	}
 
 	close() {
-		this.modal.close();
+		this.modal?.close();
 	}
 }
 
@@ -53,25 +44,23 @@ class Server {
 		}
 	}
 
-	async restartServer(adminUsername, adminPassword, token) {
+	async restartServer(token) {
 		try {
-			const password = adminPassword.trim();
-			const username = adminUsername.trim();
 			const response = await fetch('/server', {
 				method: 'POST',
 				headers: {
 					'Content-Type': 'application/json',
 					'token': token,
 				},
-				body: JSON.stringify({ "adminUsername": username, "adminPassword": password }),
 			});
 
 			if (!response.ok) {
 				if (response.status === 429) {
 					alert("Too many request. Try again later.")
 				}
+				// restarting needs a recent re-authentication.
 				if (response.status === 401) {
-					alert('Failed to restart the server. Please check your password.');
+					window.location.href = "/admin/reauth?next=/admin/dashboard";
 				}
 				if (response.status === 500) {
 					alert('Server Error. Contact the Administrator to fix this.');
@@ -89,129 +78,55 @@ class Server {
 class QRGenerator {
 	constructor() {
 		this.qrCodeElement = document.getElementById('qrCode');
-		this.usernameElement = document.getElementById('qrUsername');
-		this.remarksElement = document.getElementById('qrRemarks');
-
-		// Defined defaults for canvas
-		this.fontFamily = "'Roboto', 'Open Sans', 'Noto Serif', sans-serif";
-		this.fontSize = '36px';
-		this.textColor = '#FF0000';	// RED color
+		this.qrURL = "";
 	}
 
 	async cleanQR() {
 		this.qrCodeElement.innerHTML = "";
-		this.usernameElement.innerHTML = "";
-		this.remarksElement.innerHTML = "";
+		this.qrURL = "";
 	}
 
-	async generateQR(qrData, generateURIFunc, isLocked) {
-		if (!qrData) {
-			console.error("There's no QR data to be encoded.");
-			return;
-		}
-		const encodedData = generateURIFunc(qrData);
+	// generateQR shows the labelled QR code that is generated by the server.
+	async generateQR(id, isLocked) {
+		const qrURL = `/admin/accounts/${encodeURIComponent(id)}/qr?locked=${isLocked}`;
 		try {
-			const svg = await QRCode.toString(encodedData, { type: 'svg' });
-			this.qrCodeElement.innerHTML = svg;
-
-			if (isLocked) {
-				this.usernameElement.innerText = `${qrData.username} ${qrData.deviceID.slice(-4)}`;
-			} else {
-				this.usernameElement.innerText = qrData.username;
+			const response = await fetch(`${qrURL}&format=svg`);
+			if (!response.ok) {
+				const data = await response.json();
+				alert(data.error || "Failed to generate QR code.");
+				return false;
 			}
-
-			const subDomain = window.location.hostname.split(".")[0];
-			this.remarksElement.innerText = `${subDomain} - ${qrData.id.slice(-4)}`;
+			this.qrCodeElement.innerHTML = await response.text();
+			this.qrURL = qrURL;
+			return true;
 		} catch (error) {
 			console.error(error);
 			alert("Failed to generate QR code.");
+			return false;
 		}
 	}
 
+	// downloadQR downloads the PNG version of the current QR code.
 	downloadQR() {
-		return new Promise((resolve, reject) => {
-			const svgElement = this.qrCodeElement.querySelector('svg');
-			if (!svgElement) {
-				reject(new Error("No QR code found to download."));
-				return;
-			}
+		if (this.qrURL === "") {
+			throw new Error("No QR code found to download.");
+		}
+		const downloadLink = document.createElement('a');
+		downloadLink.href = `${this.qrURL}&format=png&download=true`;
+		document.body.appendChild(downloadLink);
+		downloadLink.click();
+		document.body.removeChild(downloadLink);
+	}
+}
 
-			document.fonts.load(this.fontSize + ' ' + this.fontFamily).then(() => {
-				const canvas = document.createElement('canvas');
-				const ctx = canvas.getContext('2d');
-
-				// Larger canvas size for better quality
-				const canvasWidth = 1024;
-				const canvasHeight = 1024;
-				const padding = 40; // Padding for border and canvas edge
-
-				canvas.width = canvasWidth;
-				canvas.height = canvasHeight;
-
-				const img = new Image();
-				const svgData = new XMLSerializer().serializeToString(svgElement);
-				const svgBlob = new Blob([svgData], { type: 'image/svg+xml;charset=utf-8' });
-				const url = URL.createObjectURL(svgBlob);
-
-				img.onload = () => {
-					// Fill white background
-					ctx.fillStyle = 'white';
-					ctx.fillRect(0, 0, canvasWidth, canvasHeight);
-
-					// Draw border with padding
-					ctx.strokeStyle = 'black';
-					ctx.lineWidth = 2;
-					ctx.strokeRect(padding, padding, canvasWidth - (padding * 2), canvasHeight - (padding * 2));
-
-					// Set up text styling
-					ctx.fillStyle = this.textColor;
-					ctx.textAlign = 'center';
-					ctx.font = `${this.fontSize} ${this.fontFamily}`;
-
-					// Calculate positions for balanced layout
-					const qrSize = 750; // Larger QR code
-					const qrX = (canvasWidth - qrSize) / 2;
-					const contentHeight = qrSize + (this.fontSize.replace('px', '') * 2); // QR height + 2 lines of text
-					const topSpace = (canvasHeight - contentHeight) / 2;
-
-					// Draw username at the top with equal spacing
-					const username = this.usernameElement.innerText;
-					const textY = topSpace + parseInt(this.fontSize); // Position for top text
-					ctx.fillText(username, canvasWidth / 2, textY);
-
-					// Draw the QR code
-					const qrY = textY + 20; // Small gap after username
-					ctx.drawImage(img, qrX, qrY, qrSize, qrSize);
-
-					// Draw remarks at the bottom with equal spacing
-					const remarks = this.remarksElement.innerText;
-					const bottomTextY = qrY + qrSize + parseInt(this.fontSize); // Position for bottom text
-					ctx.fillText(remarks, canvasWidth / 2, bottomTextY);
-
-					// Convert to blob and download
-					canvas.toBlob((blob) => {
-						const downloadUrl = URL.createObjectURL(blob);
-						const downloadLink = document.createElement('a');
-						downloadLink.href = downloadUrl;
-						downloadLink.download = `qr-code-${username || 'user'}.png`;
-						document.body.appendChild(downloadLink);
-						downloadLink.click();
-						document.body.removeChild(downloadLink);
-						URL.revokeObjectURL(downloadUrl);
-						URL.revokeObjectURL(url);
-						resolve();
-					}, 'image/png');
-				};
-
-				img.onerror = () => {
-					URL.revokeObjectURL(url);
-					reject(new Error("Failed to load QR code image."));
-				};
-
-				img.src = url;
-			});
-		});
+// fetchLink returns the vmess link of the user that is generated by the server.
+async function fetchLink(id, isLocked) {
+	const response = await fetch(`/admin/accounts/${encodeURIComponent(id)}/link?locked=${isLocked}`);
+	const data = await response.json();
+	if (!response.ok) {
+		throw new Error(data.error || "Failed to get the link.");
 	}
+	return data.uri;
 }
 
 document.addEventListener("DOMContentLoaded", () => {
@@ -360,44 +275,25 @@ document.addEventListener("DOMContentLoaded", () => {
 	const today = new Date();
 	today.setDate(today.getDate());
 
-	// default value start date.
+	// default value start date, the form is only shown to the operators.
 	const dateInput = document.getElementById("formStartDate");
-	dateInput.valueAsDate = today;
+	if (dateInput) {
+		dateInput.valueAsDate = today;
+	}
 
 	// qr code generations logic
 	const handleQRButtonClick = async (event) => {
 		const button = event.target;
-		const userNumber = document.getElementById("qrUserNumber").dataset.value;
-		if (userNumber === "") {
-			console.log("Error trying to find the qrUserNumber.")
+		const serverUUID = document.getElementById("qrUserNumber").dataset.value;
+		if (serverUUID === "") {
+			console.log("Error trying to find the server uuid of the qr.")
 			return;
 		}
 
-		let generateURIFunc;
-		let isLocked = true;
-		if (button.classList.contains("open")) {
-			isLocked = false;
-			generateURIFunc = generateURI;
-		} else {
-			generateURIFunc = generateLockedURI;
+		const isLocked = !button.classList.contains("open");
+		if (await qrGenerator.generateQR(serverUUID, isLocked)) {
+			qrModal.open();
 		}
-
-		// convert data-value and userNumber to the same type
-		const userRow = Array.from(document.querySelectorAll('.user-table tbody tr')).find(row => {
-			const rowNumber = row.cells[0].dataset.value.trim(); // Make sure there are no spaces
-			return rowNumber === userNumber; // Compare as strings
-		});
-
-		// the user row will be definitely found.
-		const qrData = new QRInfo(
-			userRow.cells[0].dataset.value,
-			userRow.cells[1].innerText,
-			userRow.cells[2].innerText,
-			userRow.cells[3].innerText,
-			userRow.cells[5].innerText,
-		);
-		await qrGenerator.generateQR(qrData, generateURIFunc, isLocked);
-		qrModal.open();
 	};
 
 	// opened qr code generation handler
@@ -417,7 +313,6 @@ document.addEventListener("DOMContentLoaded", () => {
 		button.addEventListener("click", () => {
 			// alert("Feature is not supported yet.")
 			const row = button.closest("tr");
-			const numberCell = row.querySelector("[data-cell='Number']");
 			const startDateCell = row.querySelector("[data-cell='Start date']")
 			const expireDateCell = row.querySelector("[data-cell='Expire date']")
 			const serverUUIDCell = row.querySelector("[data-cell='Server UUID']");
@@ -425,15 +320,14 @@ document.addEventListener("DOMContentLoaded", () => {
 			console.log(deviceUUIDCell);
 			const usernameCell = row.querySelector("[data-cell='Username']");
 
-			const userNumber = numberCell ? numberCell.dataset.value : "not found";
 			const startDate = startDateCell ? startDateCell.dataset.value : "not found";
 			const expireDate = expireDateCell ? expireDateCell.dataset.value : "not found";
 			const serverUUID = serverUUIDCell ? serverUUIDCell.dataset.value : "not found";
 			const deviceUUID = deviceUUIDCell ? deviceUUIDCell.dataset.value : "not found";
 			const username = usernameCell ? usernameCell.dataset.value : "not found";
 
-			// userNumber
-			document.querySelector("#userUpdateUserNumber").value = userNumber;
+			// the user is addressed by the current server uuid.
+			document.querySelector("#userUpdateForm").action = `/admin/accounts/${encodeURIComponent(serverUUID)}/edit`;
 
 			// username
 			const usernameInput = document.querySelector("#userUpdateUsername");
@@ -467,9 +361,9 @@ document.addEventListener("DOMContentLoaded", () => {
 	document.querySelectorAll(".generateQRBtn").forEach((button) => {
 		button.addEventListener("click", () => {
 			const row = button.closest("tr");
-			const numberCell = row.querySelector("[data-cell='Number']");
-			const userNumber = numberCell ? numberCell.dataset.value : "not found";
-			document.querySelector("#qrUserNumber").dataset.value = userNumber;
+			const serverUUIDCell = row.querySelector("[data-cell='Server UUID']");
+			const serverUUID = serverUUIDCell ? serverUUIDCell.dataset.value : "";
+			document.querySelector("#qrUserNumber").dataset.value = serverUUID;
 			// open the modal to start deleting the user.
 			generateQRUserModal.open();
 		});
@@ -479,16 +373,14 @@ document.addEventListener("DOMContentLoaded", () => {
 	document.querySelectorAll(".deleteBtn").forEach((button) => {
 		button.addEventListener("click", () => {
 			const row = button.closest("tr");
-			const numberCell = row.querySelector("[data-cell='Number']");
 			const UUIDCell = row.querySelector("[data-cell='Server UUID']");
 			const usernameCell = row.querySelector("[data-cell='Username']");
 
-			const userNumber = numberCell ? numberCell.dataset.value : "not found";
 			const serverUUID = UUIDCell ? UUIDCell.dataset.value : "not found";
 			const username = usernameCell ? usernameCell.dataset.value : "not found";
 
 			document.querySelector("#userToBeDeleted").innerHTML = username;	// user
-			document.querySelector("#userNumberToBeDeleted").value = userNumber;	// usernumber
+			document.querySelector("#userDeleteForm").action = `/admin/accounts/${encodeURIComponent(serverUUID)}/delete`;
 
 			// uuid
 			const serverUUIDInput = document.querySelector("#serverUUIDToBeDeleted")
@@ -506,7 +398,7 @@ document.addEventListener("DOMContentLoaded", () => {
 
 
 	// user delete confirm form handler
-	document.getElementById("deleteUserModalBtn").addEventListener('click', async () => {
+	document.getElementById("deleteUserModalBtn")?.addEventListener('click', async () => {
 		const form = document.querySelector("#userDeleteForm");
 		const usernameInput = document.getElementById("usernameToBeDeleted");
 		const serverUUIDInput = document.getElementById("serverUUIDToBeDeleted");
@@ -553,13 +445,13 @@ document.addEventListener("DOMContentLoaded", () => {
 	});
 
 	// manually adding uuid button handler
-	document.getElementById("uuidManualButton").addEventListener("click", () => {
+	document.getElementById("uuidManualButton")?.addEventListener("click", () => {
 		document.querySelector("#serverUUID").value = "";
 		document.querySelector("#deviceUUID").value = "";
 	});
 
 	// auto generate server uuid when username is inputted.
-	document.getElementById("usernameInput").addEventListener("input", () => {
+	document.getElementById("usernameInput")?.addEventListener("input", () => {
 		if (usernameInput.value.trim() !== "") {
 			document.querySelector("#serverUUID").value = generateUUID();
 		}
@@ -572,24 +464,10 @@ document.addEventListener("DOMContentLoaded", () => {
 	document.getElementById("userRefreshBtn").addEventListener("click", () => window.location.reload());
 
 	// server restart button handler
-	document.getElementById("serverRestartBtn").addEventListener('click', async (event) => {
+	document.getElementById("serverRestartBtn")?.addEventListener('click', async (event) => {
 		event.preventDefault();
-		const adminPassword = document.getElementById("adminPassword").value;
-		if (adminPassword === "") {
-			alert("Password required!")
-			reStartModal.close();
-			return
-		}
-
-		const adminUsername = document.getElementById("adminUsername").value;
-		if (adminUsername === "") {
-			alert("Username required!")
-			reStartModal.close();
-			return
-		}
-
 		const token = document.getElementById("CSRFToken").value;
-		await server.restartServer(adminUsername, adminPassword, token);
+		await server.restartServer(token);
 		reStartModal.close();
 	});
 
@@ -597,8 +475,8 @@ document.addEventListener("DOMContentLoaded", () => {
 	document.getElementById("downloadQRBtn").addEventListener("click", async () => {
 		try {
 			if (document.getElementById("qrCode").innerHTML) {
-				await qrGenerator.downloadQR();  // Wait for download to complete
-				qrGenerator.cleanQR();  // Clean up only after successful download
+				qrGenerator.downloadQR();
+				qrGenerator.cleanQR();  // Clean up only after starting the download
 			}
 		} catch (error) {
 			console.error("Failed to download QR code:", error);
@@ -615,90 +493,23 @@ document.addEventListener("DOMContentLoaded", () => {
 
 	// copy config button handler
 	document.querySelectorAll(".copyBtn").forEach((copyBtn) => {
-		copyBtn.addEventListener("click", () => {
+		copyBtn.addEventListener("click", async () => {
 			const row = copyBtn.closest("tr");
-			const qrData = new QRInfo(
-				row.cells[0].dataset.value,
-				row.cells[1].innerText,
-				row.cells[2].innerText,
-				row.cells[3].innerText,
-				row.cells[5].innerText,
-			);
-			navigator.clipboard.writeText(generateURI(qrData))
-				.then(() => alert("Copied the text: " + generateURI(qrData)))
-				.catch(err => {
-					console.error('Failed to copy: ', err);
-					alert("Failed to copy the text.");
-				});
+			const serverUUID = row.querySelector("[data-cell='Server UUID']").dataset.value;
+			try {
+				const uri = await fetchLink(serverUUID, false);
+				await navigator.clipboard.writeText(uri);
+				alert("Copied the text: " + uri);
+			} catch (err) {
+				console.error('Failed to copy: ', err);
+				alert("Failed to copy the text.");
+			}
 		});
 	});
 
 
 });
 
-function generateURI(qrData) {
-	const prefix = "vmess://";
-	const address = window.location.hostname;
-	const subDomain = address.split(".")[0];
-	const port = document.getElementById("v2rayServerPort").dataset.port;
-	const region = document.getElementById("serverRegion").dataset.region;
-
-	const vmessTemplate = {
-		add: address,
-		aid: "1",
-		alpn: "",
-		fp: "",
-		host: "www.youtube.com",
-		id: qrData.id,
-		net: "tcp",
-		path: "/",
-		port: port,
-		ps: `valid before (${qrData.expDate}) ${subDomain}-${region}-${qrData.id.slice(-4)}`,
-		scy: "none",
-		sni: "",
-		tls: "",
-		type: "http",
-		v: "2"
-	};
-
-	return `${prefix}${btoa(JSON.stringify(vmessTemplate))}`;
-}
-
-function generateLockedURI(qrData) {
-	if (qrData.deviceID === "") {
-		alert("Unable to generate locked QR without device id.")
-		return
-	}
-	const prefix = "vmess://";
-	const lockPrefix = "v2box://locked=";
-	const address = window.location.hostname;
-	const subDomain = address.split(".")[0];
-	const port = document.getElementById("v2rayServerPort").dataset.port;
-	const region = document.getElementById("serverRegion").dataset.region;
-
-	const vmessTemplate = {
-		add: address,
-		aid: "1",
-		alpn: "",
-		fp: "",
-		host: "www.youtube.com",
-		deviceID: qrData.deviceID,
-		id: qrData.id,
-		net: "tcp",
-		path: "/",
-		port: port,
-		ps: `valid before (${qrData.expDate}) ${subDomain}-${region}-${qrData.id.slice(-4)}`,
-		scy: "none",
-		sni: "",
-		tls: "",
-		type: "http",
-		v: "2"
-	};
-
-	const unlockedQR = `${prefix}${btoa(JSON.stringify(vmessTemplate))}`;
-	return `${lockPrefix}${btoa(unlockedQR)}`;
-}
-
 function generateUUID() {
 	return 'xxxxxxxx-xxxx-4xxx-yxxx-xxxxxxxxxxxx'.replace(/[xy]/g, function(c) {
 		const r = Math.random() * 16 | 0;
@@ -0,0 +1,221 @@
+document.addEventListener("DOMContentLoaded", () => {
+	const loginBtn = document.getElementById("passkeyLoginBtn");
+	if (loginBtn) {
+		if (!window.PublicKeyCredential) {
+			loginBtn.hidden = true;
+			return;
+		}
+		loginBtn.addEventListener("click", () => loginWithPasskey(loginBtn));
+	}
+
+	const reauthBtn = document.getElementById("passkeyReauthBtn");
+	if (reauthBtn) {
+		if (!window.PublicKeyCredential) {
+			reauthBtn.hidden = true;
+		} else {
+			reauthBtn.addEventListener("click", () => reauthWithPasskey(reauthBtn));
+		}
+	}
+
+	const registerForm = document.getElementById("passkeyRegisterForm");
+	if (registerForm) {
+		registerForm.addEventListener("submit", (event) => {
+			event.preventDefault();
+			registerPasskey(registerForm);
+		});
+	}
+});
+
+/**
+ * base64urlToBuffer decodes the unpadded base64url string that the server sends into an ArrayBuffer.
+ *
+ * @param {string} value - base64url encoded string.
+ * @returns {ArrayBuffer}
+ */
+function base64urlToBuffer(value) {
+	const base64 = value.replace(/-/g, "+").replace(/_/g, "/");
+	const binary = atob(base64 + "=".repeat((4 - base64.length % 4) % 4));
+	return Uint8Array.from(binary, (c) => c.charCodeAt(0)).buffer;
+}
+
+/**
+ * bufferToBase64url encodes the ArrayBuffer of the authenticator into an unpadded base64url string.
+ *
+ * @param {ArrayBuffer} buffer - binary data.
+ * @returns {string}
+ */
+function bufferToBase64url(buffer) {
+	const binary = String.fromCharCode(...new Uint8Array(buffer));
+	return btoa(binary).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+}
+
+/**
+ * postJSON posts the body as JSON with the CSRF token, and returns the response.
+ *
+ * @param {string} url - path to be posted to.
+ * @param {string} token - CSRF token of the page.
+ * @param {any} body - request body.
+ * @returns {Promise<Response>}
+ */
+function postJSON(url, token, body) {
+	return fetch(url, {
+		method: "POST",
+		headers: {
+			"Content-Type": "application/json",
+			"token": token,
+		},
+		body: JSON.stringify(body),
+	});
+}
+
+/**
+ * errorMessage returns the error message of the JSON error response.
+ *
+ * @param {Response} response - the failed response.
+ * @returns {Promise<string>}
+ */
+async function errorMessage(response) {
+	try {
+		const body = await response.json();
+		return body.error || response.statusText;
+	} catch {
+		return response.statusText;
+	}
+}
+
+/**
+ * loginWithPasskey logs in with a passkey, as a second factor after the password or without it.
+ *
+ * @param {HTMLButtonElement} btn - the button with the CSRF token in its data-token.
+ */
+async function loginWithPasskey(btn) {
+	const token = btn.dataset.token;
+	btn.disabled = true;
+	try {
+		const optionsResponse = await postJSON("/admin/login/passkey/options", token, {});
+		if (!optionsResponse.ok) {
+			alert(await errorMessage(optionsResponse));
+			return;
+		}
+		const options = await optionsResponse.json();
+		options.challenge = base64urlToBuffer(options.challenge);
+		options.allowCredentials = options.allowCredentials.map((c) => ({ ...c, id: base64urlToBuffer(c.id) }));
+
+		const credential = await navigator.credentials.get({ publicKey: options });
+		const response = await postJSON("/admin/login/passkey", token, {
+			id: credential.id,
+			rawId: bufferToBase64url(credential.rawId),
+			type: credential.type,
+			response: {
+				clientDataJSON: bufferToBase64url(credential.response.clientDataJSON),
+				authenticatorData: bufferToBase64url(credential.response.authenticatorData),
+				signature: bufferToBase64url(credential.response.signature),
+				userHandle: credential.response.userHandle ? bufferToBase64url(credential.response.userHandle) : undefined,
+			},
+		});
+
+		// the server redirects to the dashboard on success.
+		if (response.ok && response.redirected) {
+			window.location.href = response.url;
+			return;
+		}
+		alert(await errorMessage(response));
+	} catch (error) {
+		console.error("Error logging in with the passkey: ", error);
+		alert("Passkey login is cancelled or failed. Please try again.");
+	} finally {
+		btn.disabled = false;
+	}
+}
+
+/**
+ * reauthWithPasskey re-authenticates the logged in panel user with a passkey before the sensitive actions,
+ * and returns to the page of the action.
+ *
+ * @param {HTMLButtonElement} btn - the button with the CSRF token in its data-token and the page in its data-next.
+ */
+async function reauthWithPasskey(btn) {
+	const token = btn.dataset.token;
+	btn.disabled = true;
+	try {
+		const optionsResponse = await postJSON("/admin/reauth/passkey/options", token, {});
+		if (!optionsResponse.ok) {
+			alert(await errorMessage(optionsResponse));
+			return;
+		}
+		const options = await optionsResponse.json();
+		options.challenge = base64urlToBuffer(options.challenge);
+		options.allowCredentials = options.allowCredentials.map((c) => ({ ...c, id: base64urlToBuffer(c.id) }));
+
+		const credential = await navigator.credentials.get({ publicKey: options });
+		const response = await postJSON("/admin/reauth/passkey", token, {
+			id: credential.id,
+			rawId: bufferToBase64url(credential.rawId),
+			type: credential.type,
+			response: {
+				clientDataJSON: bufferToBase64url(credential.response.clientDataJSON),
+				authenticatorData: bufferToBase64url(credential.response.authenticatorData),
+				signature: bufferToBase64url(credential.response.signature),
+				userHandle: credential.response.userHandle ? bufferToBase64url(credential.response.userHandle) : undefined,
+			},
+		});
+		if (!response.ok) {
+			alert(await errorMessage(response));
+			return;
+		}
+		window.location.href = btn.dataset.next;
+	} catch (error) {
+		console.error("Error re-authenticating with the passkey: ", error);
+		alert("Passkey confirmation is cancelled or failed. Please try again.");
+	} finally {
+		btn.disabled = false;
+	}
+}
+
+/**
+ * registerPasskey registers a new passkey of the logged in panel user with the name of the form.
+ *
+ * @param {HTMLFormElement} form - the form with the name input and the CSRF token input.
+ */
+async function registerPasskey(form) {
+	const token = form.querySelector("input[type=hidden]").value;
+	const name = form.querySelector("input[name=name]").value;
+	try {
+		const optionsResponse = await postJSON("/admin/passkeys/options", token, {});
+		// adding a passkey needs a recent re-authentication.
+		if (optionsResponse.status === 401) {
+			window.location.href = "/admin/reauth?next=/admin/passkeys";
+			return;
+		}
+		if (!optionsResponse.ok) {
+			alert(await errorMessage(optionsResponse));
+			return;
+		}
+		const options = await optionsResponse.json();
+		options.challenge = base64urlToBuffer(options.challenge);
+		options.user.id = base64urlToBuffer(options.user.id);
+		options.excludeCredentials = options.excludeCredentials.map((c) => ({ ...c, id: base64urlToBuffer(c.id) }));
+
+		const credential = await navigator.credentials.create({ publicKey: options });
+		const response = await postJSON("/admin/passkeys", token, {
+			name: name,
+			credential: {
+				id: credential.id,
+				rawId: bufferToBase64url(credential.rawId),
+				type: credential.type,
+				response: {
+					clientDataJSON: bufferToBase64url(credential.response.clientDataJSON),
+					attestationObject: bufferToBase64url(credential.response.attestationObject),
+				},
+			},
+		});
+		if (!response.ok) {
+			alert(await errorMessage(response));
+			return;
+		}
+		window.location.reload();
+	} catch (error) {
+		console.error("Error registering the passkey: ", error);
+		alert("Passkey registration is cancelled or failed. Please try again.");
+	}
+}
@@ -0,0 +1,51 @@
+document.addEventListener("DOMContentLoaded", () => {
+	const captcha = document.getElementById("powCaptcha");
+	if (!captcha) {
+		return;
+	}
+	const loginBtn = document.getElementById("loginBtn");
+	const label = loginBtn.value;
+	loginBtn.disabled = true;
+	loginBtn.value = "Checking your browser...";
+	solveProofOfWork(captcha.dataset.challenge, Number(captcha.dataset.difficulty)).then((response) => {
+		captcha.value = response;
+		loginBtn.disabled = false;
+		loginBtn.value = label;
+	});
+});
+
+/**
+ * solveProofOfWork finds the solution that makes the sha-256 hash of "<challenge>.<solution>" start with
+ * the given number of zero bits, as the proof-of-work CAPTCHA of the login form asks.
+ *
+ * @param {string} challenge - signed challenge from the server.
+ * @param {number} difficulty - number of the leading zero bits.
+ * @returns {Promise<string>} the response to post in the form, "<challenge>.<solution>".
+ */
+async function solveProofOfWork(challenge, difficulty) {
+	const encoder = new TextEncoder();
+	for (let n = 0; ; n++) {
+		const response = challenge + "." + n.toString(36);
+		const hash = new Uint8Array(await crypto.subtle.digest("SHA-256", encoder.encode(response)));
+		if (leadingZeroBits(hash) >= difficulty) {
+			return response;
+		}
+	}
+}
+
+/**
+ * leadingZeroBits counts the leading zero bits of the bytes.
+ *
+ * @param {Uint8Array} bytes
+ * @returns {number}
+ */
+function leadingZeroBits(bytes) {
+	let count = 0;
+	for (const b of bytes) {
+		if (b !== 0) {
+			return count + Math.clz32(b) - 24;
+		}
+		count += 8;
+	}
+	return count;
+}